@@ -0,0 +1,233 @@
+// Package api serves the versioned JSON API used by the front desk app and partner sites
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/patrickoliveros/bookings/internal/config"
+	"github.com/patrickoliveros/bookings/internal/forms"
+	"github.com/patrickoliveros/bookings/internal/logging"
+	"github.com/patrickoliveros/bookings/internal/ratelimit"
+	"github.com/patrickoliveros/bookings/internal/repository"
+	"github.com/patrickoliveros/bookings/models"
+)
+
+// error codes, so clients don't have to match on messages
+const (
+	CodeBadRequest       = "bad_request"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeValidation       = "validation_failed"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeConflict         = "conflict"
+	CodeRateLimited      = "rate_limited"
+	CodeServerError      = "server_error"
+)
+
+const (
+	defaultPerPage = 20
+	maxPerPage     = 100
+
+	// maxBodySize is the largest request body that is read
+	maxBodySize = 1 << 20
+
+	// defaultRateLimit is used when the configuration sets no rate limit
+	defaultRateLimit = 60
+)
+
+var Repo *Repository
+
+// Repository is the repository of the api handlers
+type Repository struct {
+	App *config.AppConfig
+	DB  repository.DatabaseRepo
+
+	limiter *ratelimit.Limiter
+}
+
+// NewRepo creates a repository for the api handlers using db
+func NewRepo(a *config.AppConfig, db repository.DatabaseRepo) *Repository {
+	perMinute := a.APIRateLimit
+	if perMinute <= 0 {
+		perMinute = defaultRateLimit
+	}
+
+	return &Repository{
+		App:     a,
+		DB:      db,
+		limiter: ratelimit.New(perMinute),
+	}
+}
+
+// NewHandlers sets the repository for the handlers
+func NewHandlers(r *Repository) {
+	Repo = r
+}
+
+//region responses
+
+// NotFound answers requests for api routes that don't exist
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusNotFound, CodeNotFound, "no such endpoint", nil)
+}
+
+// MethodNotAllowed answers requests using a method the route doesn't support
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed,
+		fmt.Sprintf("%s is not allowed here", r.Method), nil)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	out, err := json.Marshal(v)
+	if err != nil {
+		logging.LocalServerError(err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(out)
+}
+
+func writeData(w http.ResponseWriter, status int, data interface{}) {
+	writeJSON(w, status, models.APIResponse{Data: data})
+}
+
+func writeList(w http.ResponseWriter, data interface{}, page models.APIPage) {
+	writeJSON(w, http.StatusOK, models.APIResponse{Data: data, Meta: &page})
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string, fields map[string][]string) {
+	writeJSON(w, status, models.APIErrorResponse{Error: models.APIError{
+		Code:    code,
+		Message: message,
+		Fields:  fields,
+	}})
+}
+
+// serverError logs err and answers without giving its details away
+func serverError(w http.ResponseWriter, err error) {
+	logging.LocalServerError(err)
+	writeError(w, http.StatusInternalServerError, CodeServerError, "something went wrong on our side", nil)
+}
+
+//endregion
+
+//region requests
+
+// readJSON decodes the request body into v, writing the error response if it can't
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(v)
+	if err == nil && dec.More() {
+		err = errors.New("body must hold a single JSON object")
+	}
+
+	if errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, CodeBadRequest, "body must not be empty", nil)
+		return false
+	} else if err != nil {
+		writeError(w, http.StatusBadRequest, CodeBadRequest, fmt.Sprintf("can't read body: %s", err), nil)
+		return false
+	}
+
+	return true
+}
+
+// pagination reads the page and per_page query parameters, writing the error response
+// if they are not valid
+func pagination(w http.ResponseWriter, r *http.Request) (models.APIPage, bool) {
+	page := models.APIPage{Page: 1, PerPage: defaultPerPage}
+	fields := map[string][]string{}
+
+	if v := r.URL.Query().Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			fields["page"] = append(fields["page"], "This field must be a number of at least 1")
+		}
+		page.Page = n
+	}
+
+	if v := r.URL.Query().Get("per_page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPerPage {
+			fields["per_page"] = append(fields["per_page"], fmt.Sprintf("This field must be a number from 1 to %d", maxPerPage))
+		}
+		page.PerPage = n
+	}
+
+	if len(fields) > 0 {
+		writeError(w, http.StatusBadRequest, CodeValidation, "invalid pagination", fields)
+		return page, false
+	}
+
+	return page, true
+}
+
+// bounds returns the slice indexes of the page in a list of total items, and sets the total
+func bounds(page *models.APIPage, total int) (int, int) {
+	page.Total = total
+
+	from := (page.Page - 1) * page.PerPage
+	if from > total {
+		from = total
+	}
+
+	to := from + page.PerPage
+	if to > total {
+		to = total
+	}
+
+	return from, to
+}
+
+//endregion
+
+func toAPIRoom(room models.Room) models.APIRoom {
+	amenities, photos := room.Amenities, room.Photos
+	if amenities == nil {
+		amenities = []string{}
+	}
+	if photos == nil {
+		photos = []string{}
+	}
+
+	return models.APIRoom{
+		ID:          room.ID,
+		Name:        room.RoomName,
+		Slug:        room.Slug,
+		Description: room.Description,
+		Capacity:    room.Capacity,
+		NightlyRate: room.NightlyRate,
+		WeekendRate: room.WeekendRate,
+		Amenities:   amenities,
+		Photos:      photos,
+	}
+}
+
+func toAPIReservation(res models.Reservation) models.APIReservation {
+	return models.APIReservation{
+		Reference:             res.Reference,
+		Status:                res.Status,
+		FirstName:             res.FirstName,
+		LastName:              res.LastName,
+		Email:                 res.Email,
+		Phone:                 res.Phone,
+		RoomID:                res.RoomID,
+		RoomName:              res.Room.RoomName,
+		StartDate:             res.StartDate.Format(forms.DateLayout),
+		EndDate:               res.EndDate.Format(forms.DateLayout),
+		CancellationRequested: !res.CancellationRequestedAt.IsZero(),
+		Quote:                 res.Quote,
+		CreatedAt:             res.CreatedAt,
+	}
+}
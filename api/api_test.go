@@ -0,0 +1,295 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/patrickoliveros/bookings/internal/config"
+	"github.com/patrickoliveros/bookings/internal/logging"
+	"github.com/patrickoliveros/bookings/internal/mailer"
+	"github.com/patrickoliveros/bookings/internal/ratelimit"
+	"github.com/patrickoliveros/bookings/internal/repository/dbrepo"
+	"github.com/patrickoliveros/bookings/models"
+)
+
+func newTestRepo() *Repository {
+	mailTemplates, err := mailer.CreateTemplateCache("../email-templates")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	app := &config.AppConfig{
+		InfoLog:       log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime),
+		ErrorLog:      log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime),
+		MailTemplates: mailTemplates,
+		FrontDesk:     "desk@here.com",
+		Pricing:       config.PricingConfig{Currency: "USD"},
+	}
+	logging.NewHelpers(app)
+	mailer.NewMailer(app, &mailer.Recorder{})
+
+	return NewRepo(app, dbrepo.NewMemoryRepo(app))
+}
+
+func newTestServer(m *Repository) http.Handler {
+	mux := chi.NewRouter()
+	mux.NotFound(NotFound)
+	mux.Get("/rooms", m.GetRooms)
+	mux.Get("/rooms/{id}", m.GetRoom)
+	mux.Get("/availability", m.GetAvailability)
+	mux.Post("/reservations", m.PostReservation)
+	mux.Get("/reservations/{reference}", m.GetReservation)
+	mux.Post("/reservations/{reference}/cancel", m.PostCancelReservation)
+
+	return mux
+}
+
+func do(t *testing.T, h http.Handler, method, target, body string, header ...string) (*httptest.ResponseRecorder, map[string]json.RawMessage) {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("%s %s: expected a JSON response, got %q", method, target, ct)
+	}
+
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(rr.Body.Bytes(), &envelope); err != nil {
+		t.Fatalf("%s %s: %s", method, target, err)
+	}
+
+	return rr, envelope
+}
+
+func TestAPI_Rooms(t *testing.T) {
+	h := newTestServer(newTestRepo())
+
+	var tests = []struct {
+		target string
+		status int
+	}{
+		{"/rooms", http.StatusOK},
+		{"/rooms?page=2&per_page=1", http.StatusOK},
+		{"/rooms?page=0", http.StatusBadRequest},
+		{"/rooms?per_page=101", http.StatusBadRequest},
+		{"/rooms/1", http.StatusOK},
+		{"/rooms/99", http.StatusNotFound},
+		{"/rooms/one", http.StatusNotFound},
+		{"/nowhere", http.StatusNotFound},
+	}
+
+	for _, e := range tests {
+		rr, envelope := do(t, h, "GET", e.target, "")
+		if rr.Code != e.status {
+			t.Errorf("%s: expected %d, got %d", e.target, e.status, rr.Code)
+		}
+
+		key := "data"
+		if e.status != http.StatusOK {
+			key = "error"
+		}
+		if _, ok := envelope[key]; !ok {
+			t.Errorf("%s: expected a %q envelope, got %s", e.target, key, rr.Body.String())
+		}
+	}
+
+	_, envelope := do(t, h, "GET", "/rooms?page=2&per_page=1", "")
+
+	var rooms []models.APIRoom
+	var page models.APIPage
+	_ = json.Unmarshal(envelope["data"], &rooms)
+	_ = json.Unmarshal(envelope["meta"], &page)
+
+	if len(rooms) != 1 || rooms[0].ID != 2 || page.Total != 2 || page.Page != 2 {
+		t.Errorf("expected the second of 2 rooms, got %v %+v", rooms, page)
+	}
+}
+
+func TestAPI_Reservations(t *testing.T) {
+	m := newTestRepo()
+	h := newTestServer(m)
+
+	sent := &mailer.Recorder{}
+	mailer.NewMailer(m.App, sent)
+
+	rr, envelope := do(t, h, "GET", "/availability?start_date=2030-03-01&end_date=2030-02-01", "")
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("availability with end before start: expected 400, got %d", rr.Code)
+	}
+
+	rr, envelope = do(t, h, "GET", "/availability?start_date=2030-03-01&end_date=2030-03-03", "")
+	var available []models.APIAvailableRoom
+	_ = json.Unmarshal(envelope["data"], &available)
+	if rr.Code != http.StatusOK || len(available) != 2 || len(available[0].Quote.Nights) != 2 {
+		t.Fatalf("expected 2 rooms priced for 2 nights, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	var tests = []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"empty", ``, http.StatusBadRequest},
+		{"not json", `room_id=1`, http.StatusBadRequest},
+		{"unknown field", `{"room":1}`, http.StatusBadRequest},
+		{"invalid", `{"room_id":1,"start_date":"2030-03-01","end_date":"2030-03-03","first_name":"Jo"}`, http.StatusUnprocessableEntity},
+		{"no such room", `{"room_id":99,"start_date":"2030-03-01","end_date":"2030-03-03","first_name":"Johnny","last_name":"Walker","email":"johnny@here.com","phone":"555"}`, http.StatusUnprocessableEntity},
+		{"booked", `{"room_id":1,"start_date":"2030-03-01","end_date":"2030-03-03","first_name":"Johnny","last_name":"Walker","email":"johnny@here.com","phone":"555"}`, http.StatusCreated},
+		{"taken", `{"room_id":1,"start_date":"2030-03-02","end_date":"2030-03-04","first_name":"Johnny","last_name":"Walker","email":"johnny@here.com","phone":"555"}`, http.StatusConflict},
+	}
+
+	var created models.APIReservation
+	for _, e := range tests {
+		rr, envelope := do(t, h, "POST", "/reservations", e.body)
+		if rr.Code != e.status {
+			t.Errorf("%s: expected %d, got %d %s", e.name, e.status, rr.Code, rr.Body.String())
+		}
+		if e.status == http.StatusCreated {
+			_ = json.Unmarshal(envelope["data"], &created)
+		}
+	}
+
+	if created.Reference == "" || created.Status != models.StatusPending || created.Quote.Total == 0 {
+		t.Fatalf("expected a pending, priced reservation, got %+v", created)
+	}
+
+	target := "/reservations/" + created.Reference
+	if rr, _ := do(t, h, "GET", target+"?email=JOHNNY@here.com", ""); rr.Code != http.StatusOK {
+		t.Errorf("read with the booking email: expected 200, got %d", rr.Code)
+	}
+	if rr, _ := do(t, h, "GET", target+"?email=someone@else.com", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("read with another email: expected 404, got %d", rr.Code)
+	}
+	if rr, _ := do(t, h, "GET", target, ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("read without email: expected 400, got %d", rr.Code)
+	}
+
+	for i := 0; i < 2; i++ {
+		rr, envelope := do(t, h, "POST", target+"/cancel", `{"email":"johnny@here.com"}`)
+
+		var res models.APIReservation
+		_ = json.Unmarshal(envelope["data"], &res)
+		if rr.Code != http.StatusOK || res.Status != models.StatusCancelled {
+			t.Errorf("cancel %d: expected the booking to be cancelled, got %d %s", i, rr.Code, rr.Body.String())
+		}
+	}
+
+	// cancelling frees the dates for other guests
+	start, _ := time.Parse("2006-01-02", created.StartDate)
+	end, _ := time.Parse("2006-01-02", created.EndDate)
+	if available, _ := m.DB.SearchAvailabilityByDatesByRoom(context.Background(), start, end, created.RoomID); !available {
+		t.Error("expected the cancelled booking's dates to be free")
+	}
+
+	mailer.Deliver(m.DB)
+
+	messages := sent.Messages()
+	if len(messages) != 3 {
+		t.Fatalf("expected the confirmation and one cancellation for the guest and the desk, got %d", len(messages))
+	}
+	if messages[0].To != "johnny@here.com" || !strings.Contains(messages[0].Subject, created.Reference) ||
+		!strings.Contains(messages[0].TextBody, "Generals Quarters") {
+		t.Errorf("expected the guest's confirmation, got %+v", messages[0])
+	}
+	if len(messages[0].Attachments) != 1 || !strings.Contains(string(messages[0].Attachments[0].Data), "UID:"+created.Reference+"@") {
+		t.Errorf("expected the confirmation to carry the booking's calendar invite, got %+v", messages[0].Attachments)
+	}
+	if messages[1].To != "johnny@here.com" || len(messages[1].Attachments) != 1 ||
+		!strings.Contains(string(messages[1].Attachments[0].Data), "METHOD:CANCEL") {
+		t.Errorf("expected the guest's cancellation to remove the calendar event, got %+v", messages[1])
+	}
+	if messages[2].To != "desk@here.com" {
+		t.Errorf("expected the front desk to hear about the cancellation, got %+v", messages[2])
+	}
+}
+
+func TestAPI_Authenticate(t *testing.T) {
+	m := newTestRepo()
+	m.limiter = ratelimit.New(2)
+
+	key, prefix, hash := NewKey()
+	id, _ := m.DB.InsertAPIKey(context.Background(), models.APIKey{
+		Name: "partner", Prefix: prefix, KeyHash: hash, Scopes: []string{models.ScopeReadAvailability}, CreatedBy: 1,
+	})
+
+	mux := chi.NewRouter()
+	mux.Use(m.Authenticate)
+	mux.With(RequireScope(models.ScopeReadAvailability)).Get("/rooms", m.GetRooms)
+	mux.With(RequireScope(models.ScopeWriteReservations)).Post("/reservations", m.PostReservation)
+
+	var tests = []struct {
+		name   string
+		method string
+		auth   string
+		status int
+	}{
+		{"no key", "GET", "", http.StatusUnauthorized},
+		{"unknown key", "GET", "Bearer " + KeyPrefix + "nope", http.StatusUnauthorized},
+		{"key", "GET", "Bearer " + key, http.StatusOK},
+		{"missing scope", "POST", "Bearer " + key, http.StatusForbidden},
+		{"over the limit", "GET", "Bearer " + key, http.StatusTooManyRequests},
+		{"address over the limit", "GET", "", http.StatusTooManyRequests},
+	}
+
+	for _, e := range tests {
+		target := "/rooms"
+		if e.method == "POST" {
+			target = "/reservations"
+		}
+
+		rr, envelope := do(t, mux, e.method, target, "{}", "Authorization", e.auth)
+		if rr.Code != e.status {
+			t.Errorf("%s: expected %d, got %d %s", e.name, e.status, rr.Code, rr.Body.String())
+		}
+		if _, ok := envelope["error"]; e.status != http.StatusOK && !ok {
+			t.Errorf("%s: expected an error envelope, got %s", e.name, rr.Body.String())
+		}
+		if e.status == http.StatusTooManyRequests && rr.Header().Get("Retry-After") == "" {
+			t.Errorf("%s: expected a Retry-After header", e.name)
+		}
+	}
+
+	_ = m.DB.RevokeAPIKey(context.Background(), id)
+	m.limiter = ratelimit.New(2)
+
+	if rr, _ := do(t, mux, "GET", "/rooms", "", "Authorization", "Bearer "+key); rr.Code != http.StatusUnauthorized {
+		t.Errorf("revoked key: expected 401, got %d", rr.Code)
+	}
+}
+
+func TestSpec(t *testing.T) {
+	out, err := json.Marshal(Spec())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spec := Spec()
+	for _, ref := range regexp.MustCompile(`"\$ref":"#/components/schemas/(\w+)"`).FindAllStringSubmatch(string(out), -1) {
+		if spec.Components.Schemas[ref[1]] == nil {
+			t.Errorf("%s is referred to but has no schema", ref[1])
+		}
+	}
+
+	available := spec.Components.Schemas["APIAvailableRoom"]
+	if available.Properties["name"] == nil || available.Properties["quote"] == nil {
+		t.Errorf("expected the embedded room to be inlined, got %+v", available.Properties)
+	}
+
+	rr := httptest.NewRecorder()
+	Docs(rr, httptest.NewRequest("GET", "/api/docs", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "/api/v1/reservations/{reference}/cancel") {
+		t.Errorf("expected the docs page to list the endpoints, got %d", rr.Code)
+	}
+}
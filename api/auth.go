@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/patrickoliveros/bookings/internal/helpers"
+	"github.com/patrickoliveros/bookings/models"
+)
+
+// KeyPrefix starts every API key, so a leaked key is easy to recognise
+const KeyPrefix = "bk_"
+
+// keyPrefixLength is how much of a key is stored in the clear to tell keys apart
+const keyPrefixLength = len(KeyPrefix) + 8
+
+// keyTouchInterval is how stale a key's last use may get before a request updates it
+const keyTouchInterval = time.Minute
+
+type contextKey string
+
+const apiKeyContextKey = contextKey("api_key")
+
+// NewKey returns a new API key with the prefix and hash that are stored for it.
+// The key itself is only shown once.
+func NewKey() (key, prefix, hash string) {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+
+	key = KeyPrefix + hex.EncodeToString(b)
+
+	return key, key[:keyPrefixLength], HashKey(key)
+}
+
+// HashKey returns the hash an API key is looked up by
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Authenticate lets through requests with an active API key in an "Authorization: Bearer"
+// header, and keeps each key within the rate limit. Requests with a missing or wrong key
+// are limited by address, so keys can't be guessed quickly.
+func (m *Repository) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, err := m.requestKey(r)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			serverError(w, err)
+			return
+		}
+
+		if errors.Is(err, sql.ErrNoRows) || !key.IsActive() {
+			if !m.allow(w, "ip:"+helpers.ClientIP(r)) {
+				return
+			}
+
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "a valid API key is needed", nil)
+			return
+		}
+
+		if !m.allow(w, fmt.Sprintf("key:%d", key.ID)) {
+			return
+		}
+
+		if time.Since(key.LastUsedAt) > keyTouchInterval {
+			if err := m.DB.TouchAPIKey(r.Context(), key.ID); err != nil {
+				serverError(w, err)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey, key)))
+	})
+}
+
+// RequireScope lets through requests whose API key was given scope
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, _ := r.Context().Value(apiKeyContextKey).(models.APIKey)
+
+			if !key.HasScope(scope) {
+				writeError(w, http.StatusForbidden, CodeForbidden,
+					fmt.Sprintf("this API key does not have the %s scope", scope), nil)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requestKey looks up the key of the request's Authorization header, giving
+// sql.ErrNoRows when there is none or it is unknown
+func (m *Repository) requestKey(r *http.Request) (models.APIKey, error) {
+	header := r.Header.Get("Authorization")
+	if len(header) < len("Bearer ") || !strings.EqualFold(header[:len("Bearer ")], "Bearer ") {
+		return models.APIKey{}, sql.ErrNoRows
+	}
+
+	key := strings.TrimSpace(header[len("Bearer "):])
+	if !strings.HasPrefix(key, KeyPrefix) {
+		return models.APIKey{}, sql.ErrNoRows
+	}
+
+	return m.DB.GetAPIKeyByHash(r.Context(), HashKey(key))
+}
+
+// allow takes a request from the allowance of client, answering with a 429 when it has none left
+func (m *Repository) allow(w http.ResponseWriter, client string) bool {
+	ok, wait := m.limiter.Allow(client, time.Now())
+	if !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		writeError(w, http.StatusTooManyRequests, CodeRateLimited, "too many requests, slow down", nil)
+	}
+
+	return ok
+}
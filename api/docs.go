@@ -0,0 +1,106 @@
+package api
+
+import (
+	_ "embed"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/patrickoliveros/bookings/internal/logging"
+)
+
+//go:embed docs.html
+var docsPage string
+
+var docsTemplate = template.Must(template.New("docs").Funcs(template.FuncMap{
+	"schemaName": schemaName,
+	"upper":      strings.ToUpper,
+}).Parse(docsPage))
+
+// methodOrder sorts the operations of a path the way they are usually read
+var methodOrder = map[string]int{"get": 0, "post": 1, "put": 2, "patch": 3, "delete": 4}
+
+// docsOperation is an operation with the path and method it is found at
+type docsOperation struct {
+	Path   string
+	Method string
+	*Operation
+}
+
+// docsTag is a tag with its operations, in the order the docs page shows them
+type docsTag struct {
+	Tag
+	Operations []docsOperation
+}
+
+// Docs serves a page describing the API, built from the same document as /api/openapi.json
+func Docs(w http.ResponseWriter, r *http.Request) {
+	spec := Spec()
+
+	tags := make([]docsTag, len(spec.Tags))
+	index := map[string]int{}
+	for i, tag := range spec.Tags {
+		tags[i].Tag = tag
+		index[tag.Name] = i
+	}
+
+	for path, item := range spec.Paths {
+		for method, op := range item {
+			i := index[op.Tags[0]]
+			tags[i].Operations = append(tags[i].Operations, docsOperation{Path: path, Method: method, Operation: op})
+		}
+	}
+
+	for _, tag := range tags {
+		ops := tag.Operations
+		sort.Slice(ops, func(i, j int) bool {
+			if ops[i].Path != ops[j].Path {
+				return ops[i].Path < ops[j].Path
+			}
+			return methodOrder[ops[i].Method] < methodOrder[ops[j].Method]
+		})
+	}
+
+	names := make([]string, 0, len(spec.Components.Schemas))
+	for name := range spec.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	err := docsTemplate.Execute(w, map[string]interface{}{
+		"spec":    spec,
+		"tags":    tags,
+		"schemas": names,
+	})
+	if err != nil {
+		logging.LocalServerError(err)
+	}
+}
+
+// schemaName describes a schema in a few words for the docs page
+func schemaName(s *Schema) string {
+	switch {
+	case s == nil:
+		return ""
+	case s.Ref != "":
+		return strings.TrimPrefix(s.Ref, "#/components/schemas/")
+	case s.Type == "array":
+		return schemaName(s.Items) + "[]"
+	case s.Type == "object" && s.AdditionalProperties != nil:
+		return "map of " + schemaName(s.AdditionalProperties)
+	case s.Type == "object" && s.Properties["data"] != nil:
+		if s.Properties["meta"] != nil {
+			return "{data: " + schemaName(s.Properties["data"]) + ", meta: " + schemaName(s.Properties["meta"]) + "}"
+		}
+		return "{data: " + schemaName(s.Properties["data"]) + "}"
+	case s.Format != "":
+		return s.Type + " (" + s.Format + ")"
+	case s.Type == "":
+		return "any"
+	}
+
+	return s.Type
+}
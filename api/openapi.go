@@ -0,0 +1,476 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/patrickoliveros/bookings/models"
+)
+
+// OpenAPIVersion is the version of the OpenAPI specification the document follows
+const OpenAPIVersion = "3.0.3"
+
+// Document is an OpenAPI document, with only the parts this API uses
+type Document struct {
+	OpenAPI    string                `json:"openapi"`
+	Info       Info                  `json:"info"`
+	Paths      map[string]PathItem   `json:"paths"`
+	Components Components            `json:"components"`
+	Tags       []Tag                 `json:"tags,omitempty"`
+	Security   []map[string][]string `json:"security,omitempty"`
+}
+
+// Info describes the API
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// Tag groups operations in the docs
+type Tag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem holds the operations of a path by lowercase method
+type PathItem map[string]*Operation
+
+// Operation is one method of one path
+type Operation struct {
+	Summary     string                `json:"summary"`
+	Description string                `json:"description,omitempty"`
+	OperationID string                `json:"operationId"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security"`
+	Deprecated  bool                  `json:"deprecated,omitempty"`
+
+	// Scope is the API key scope the operation needs, empty for public ones
+	Scope string `json:"x-scope,omitempty"`
+}
+
+// Parameter is a path or query parameter
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody is the body an operation reads
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response is one of the answers of an operation
+type Response struct {
+	Description string               `json:"description"`
+	Headers     map[string]Header    `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// Header is a response header
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// MediaType holds the schema of a body
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema describes a JSON value
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+}
+
+// Components holds the schemas and security schemes operations refer to
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+// SecurityScheme is how clients authenticate
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme"`
+	Description string `json:"description,omitempty"`
+}
+
+// bearerAuth is the name of the API key security scheme
+const bearerAuth = "bearerAuth"
+
+// OpenAPI serves the OpenAPI document of the API
+func OpenAPI(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, Spec())
+}
+
+// Spec returns the OpenAPI document of every endpoint under /api. The schemas are
+// generated from the models the handlers answer with, so they can't drift from them;
+// the paths are kept in step with routes.go by a test.
+func Spec() Document {
+	s := &specBuilder{schemas: map[string]*Schema{}}
+
+	room := s.ref(models.APIRoom{})
+	availableRoom := s.ref(models.APIAvailableRoom{})
+	reservation := s.ref(models.APIReservation{})
+	s.ref(models.JsonReservationResponse{})
+
+	pathID := Parameter{Name: "id", In: "path", Required: true, Description: "The room's id", Schema: &Schema{Type: "integer"}}
+	pathReference := Parameter{Name: "reference", In: "path", Required: true, Description: "The booking reference", Schema: &Schema{Type: "string"}}
+	startDate := Parameter{Name: "start_date", In: "query", Required: true, Description: "The day of arrival", Schema: &Schema{Type: "string", Format: "date"}}
+	endDate := Parameter{Name: "end_date", In: "query", Required: true, Description: "The day of departure, after start_date", Schema: &Schema{Type: "string", Format: "date"}}
+	email := Parameter{Name: "email", In: "query", Required: true, Description: "The email the booking was made with", Schema: &Schema{Type: "string", Format: "email"}}
+	paging := []Parameter{
+		{Name: "page", In: "query", Description: "The page to return, from 1", Schema: &Schema{Type: "integer"}},
+		{Name: "per_page", In: "query", Description: "How many items a page holds, 20 by default and at most 100", Schema: &Schema{Type: "integer"}},
+	}
+
+	return Document{
+		OpenAPI: OpenAPIVersion,
+		Info: Info{
+			Title:   "Bookings API",
+			Version: "1.0.0",
+			Description: "Rooms, availability and reservations for apps and partner sites. Dates are written as " +
+				"2006-01-02 and amounts are in cents. Every /api/v1 endpoint needs an API key with the scope it names.",
+		},
+		Tags: []Tag{
+			{Name: "rooms", Description: "The rooms guests can book and when they are free"},
+			{Name: "reservations", Description: "Booking, looking up and cancelling stays"},
+			{Name: "documentation", Description: "This document and its docs page"},
+			{Name: "articles", Description: "Sample data kept for older clients"},
+		},
+		Security: []map[string][]string{{bearerAuth: {}}},
+		Paths: map[string]PathItem{
+			"/api/v1/rooms": {
+				"get": s.operation(operation{
+					id:         "listRooms",
+					tag:        "rooms",
+					summary:    "List the rooms guests can book",
+					scope:      models.ScopeReadAvailability,
+					parameters: paging,
+					ok:         http.StatusOK,
+					data:       s.list(room),
+				}),
+			},
+			"/api/v1/rooms/{id}": {
+				"get": s.operation(operation{
+					id:         "getRoom",
+					tag:        "rooms",
+					summary:    "Show one room",
+					scope:      models.ScopeReadAvailability,
+					parameters: []Parameter{pathID},
+					ok:         http.StatusOK,
+					data:       s.item(room),
+					errors:     []int{http.StatusNotFound},
+				}),
+			},
+			"/api/v1/availability": {
+				"get": s.operation(operation{
+					id:         "searchAvailability",
+					tag:        "rooms",
+					summary:    "List the rooms free for a stay, with its price",
+					scope:      models.ScopeReadAvailability,
+					parameters: append([]Parameter{startDate, endDate}, paging...),
+					ok:         http.StatusOK,
+					data:       s.list(availableRoom),
+				}),
+			},
+			"/api/v1/reservations": {
+				"post": s.operation(operation{
+					id:          "createReservation",
+					tag:         "reservations",
+					summary:     "Book a room",
+					description: "The guest details follow the same rules as the booking form on the site. The guest is sent a confirmation email.",
+					scope:       models.ScopeWriteReservations,
+					body:        s.ref(models.APIReservationRequest{}),
+					ok:          http.StatusCreated,
+					data:        s.item(reservation),
+					errors:      []int{http.StatusUnprocessableEntity, http.StatusConflict},
+				}),
+			},
+			"/api/v1/reservations/{reference}": {
+				"get": s.operation(operation{
+					id:         "getReservation",
+					tag:        "reservations",
+					summary:    "Show a booking",
+					scope:      models.ScopeReadReservations,
+					parameters: []Parameter{pathReference, email},
+					ok:         http.StatusOK,
+					data:       s.item(reservation),
+					errors:     []int{http.StatusNotFound},
+				}),
+			},
+			"/api/v1/reservations/{reference}/cancel": {
+				"post": s.operation(operation{
+					id:          "cancelReservation",
+					tag:         "reservations",
+					summary:     "Cancel a booking",
+					description: "Frees the booking's dates and emails the guest a cancellation with its calendar invite. Cancelling again changes nothing. Bookings that have started or ended answer with a 409.",
+					scope:       models.ScopeWriteReservations,
+					parameters:  []Parameter{pathReference},
+					body:        s.ref(models.APICancellationRequest{}),
+					ok:          http.StatusOK,
+					data:        s.item(reservation),
+					errors:      []int{http.StatusNotFound, http.StatusConflict},
+				}),
+			},
+			"/api/articles": {
+				"get": s.operation(operation{
+					id:         "listArticles",
+					tag:        "articles",
+					summary:    "Sample articles",
+					deprecated: true,
+					ok:         http.StatusOK,
+					raw:        &Schema{Type: "array", Items: s.ref(models.Article{})},
+				}),
+			},
+			"/api/openapi.json": {
+				"get": s.operation(operation{
+					id:      "getOpenAPI",
+					tag:     "documentation",
+					summary: "This OpenAPI document",
+					ok:      http.StatusOK,
+					raw:     &Schema{Type: "object"},
+				}),
+			},
+			"/api/docs": {
+				"get": s.operation(operation{
+					id:      "getDocs",
+					tag:     "documentation",
+					summary: "A page describing this API",
+					ok:      http.StatusOK,
+					html:    true,
+				}),
+			},
+		},
+		Components: Components{
+			Schemas: s.schemas,
+			SecuritySchemes: map[string]SecurityScheme{
+				bearerAuth: {
+					Type:        "http",
+					Scheme:      "bearer",
+					Description: "An API key from Admin > API Keys, sent as \"Authorization: Bearer bk_...\"",
+				},
+			},
+		},
+	}
+}
+
+// operation is what varies between the operations of the document
+type operation struct {
+	id, tag, summary, description string
+
+	// scope is the API key scope needed, empty for public operations
+	scope      string
+	parameters []Parameter
+	body       *Schema
+	deprecated bool
+
+	// ok is the status of a successful answer, whose body is data, raw or an html page
+	ok     int
+	data   *Schema
+	raw    *Schema
+	html   bool
+	errors []int
+}
+
+// specBuilder collects the schemas the operations refer to
+type specBuilder struct {
+	schemas map[string]*Schema
+}
+
+func (s *specBuilder) operation(o operation) *Operation {
+	op := &Operation{
+		Summary:     o.summary,
+		Description: o.description,
+		OperationID: o.id,
+		Tags:        []string{o.tag},
+		Parameters:  o.parameters,
+		Deprecated:  o.deprecated,
+		Scope:       o.scope,
+		Responses:   map[string]Response{},
+		Security:    []map[string][]string{},
+	}
+
+	success := Response{Description: http.StatusText(o.ok)}
+	switch {
+	case o.html:
+		success.Content = map[string]MediaType{"text/html": {Schema: &Schema{Type: "string"}}}
+	case o.raw != nil:
+		success.Content = map[string]MediaType{"application/json": {Schema: o.raw}}
+	default:
+		success.Content = map[string]MediaType{"application/json": {Schema: o.data}}
+	}
+	op.Responses[strconv.Itoa(o.ok)] = success
+
+	if o.body != nil {
+		op.RequestBody = &RequestBody{
+			Required: true,
+			Content:  map[string]MediaType{"application/json": {Schema: o.body}},
+		}
+	}
+
+	statuses := o.errors
+	if o.body != nil || hasQuery(o.parameters) {
+		statuses = append([]int{http.StatusBadRequest}, statuses...)
+	}
+
+	if o.scope != "" {
+		op.Description = strings.TrimSpace(op.Description + " Needs an API key with the " + o.scope + " scope.")
+		op.Security = []map[string][]string{{bearerAuth: {}}}
+		statuses = append(statuses, http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests)
+	}
+
+	for _, status := range statuses {
+		op.Responses[strconv.Itoa(status)] = s.errorResponse(status)
+	}
+
+	return op
+}
+
+// hasQuery reports whether any of the parameters are read from the query string
+func hasQuery(parameters []Parameter) bool {
+	for _, p := range parameters {
+		if p.In == "query" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *specBuilder) errorResponse(status int) Response {
+	response := Response{
+		Description: http.StatusText(status),
+		Content:     map[string]MediaType{"application/json": {Schema: s.ref(models.APIErrorResponse{})}},
+	}
+
+	if status == http.StatusTooManyRequests {
+		response.Headers = map[string]Header{
+			"Retry-After": {Description: "Seconds until the next request is allowed", Schema: &Schema{Type: "integer"}},
+		}
+	}
+
+	return response
+}
+
+// item is the envelope of an answer holding one value
+func (s *specBuilder) item(data *Schema) *Schema {
+	return &Schema{
+		Type:       "object",
+		Properties: map[string]*Schema{"data": data},
+		Required:   []string{"data"},
+	}
+}
+
+// list is the envelope of an answer holding a page of a list
+func (s *specBuilder) list(item *Schema) *Schema {
+	return &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"data": {Type: "array", Items: item},
+			"meta": s.ref(models.APIPage{}),
+		},
+		Required: []string{"data", "meta"},
+	}
+}
+
+// ref adds the schema of v's struct type to the components and returns a reference to it
+func (s *specBuilder) ref(v interface{}) *Schema {
+	return s.schemaOf(reflect.TypeOf(v))
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (s *specBuilder) schemaOf(t reflect.Type) *Schema {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Struct:
+		if _, ok := s.schemas[t.Name()]; !ok {
+			// claim the name first, in case the type refers to itself
+			s.schemas[t.Name()] = &Schema{}
+			*s.schemas[t.Name()] = *s.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + t.Name()}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: s.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.schemaOf(t.Elem())}
+	}
+
+	// interface{} can hold anything
+	return &Schema{}
+}
+
+// structSchema describes a struct the way encoding/json writes it: embedded structs are
+// inlined, and fields are required unless they are omitempty
+func (s *specBuilder) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || f.PkgPath != "" {
+			continue
+		}
+
+		name, options := tag, ""
+		if i := strings.Index(tag, ","); i >= 0 {
+			name, options = tag[:i], tag[i+1:]
+		}
+
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			inline := s.structSchema(f.Type)
+			for k, v := range inline.Properties {
+				schema.Properties[k] = v
+			}
+			schema.Required = append(schema.Required, inline.Required...)
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		schema.Properties[name] = s.schemaOf(f.Type)
+		if !strings.Contains(options, "omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+
+	return schema
+}
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/patrickoliveros/bookings/internal/forms"
+	"github.com/patrickoliveros/bookings/internal/helpers"
+	"github.com/patrickoliveros/bookings/internal/mailer"
+	"github.com/patrickoliveros/bookings/internal/pricing"
+	"github.com/patrickoliveros/bookings/internal/repository"
+	"github.com/patrickoliveros/bookings/models"
+)
+
+// PostReservation books a room. The rules are the same as for the booking form on the site.
+func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
+	var req models.APIReservationRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	form := forms.New(url.Values{
+		"start_date": {req.StartDate},
+		"end_date":   {req.EndDate},
+		"first_name": {req.FirstName},
+		"last_name":  {req.LastName},
+		"email":      {req.Email},
+		"phone":      {req.Phone},
+	})
+	form.GuestDetails()
+	form.DateRange("start_date", "end_date")
+
+	room, err := m.DB.GetRoomByID(r.Context(), req.RoomID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && room.IsArchived()) {
+		form.Errors.Add("room_id", "No such room")
+	} else if err != nil {
+		serverError(w, err)
+		return
+	}
+
+	if !form.Valid() {
+		writeError(w, http.StatusUnprocessableEntity, CodeValidation, "the reservation is not valid", form.Errors)
+		return
+	}
+
+	start, _ := time.Parse(forms.DateLayout, req.StartDate)
+	end, _ := time.Parse(forms.DateLayout, req.EndDate)
+
+	reservation := models.Reservation{
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+		Email:     req.Email,
+		Phone:     req.Phone,
+		StartDate: start,
+		EndDate:   end,
+		RoomID:    room.ID,
+		Room:      room,
+		Reference: helpers.GenerateGuid(),
+	}
+
+	// the price is fixed when the guest books, later rate changes don't affect it
+	reservation.Quote, err = m.quoteStay(r, room, start, end)
+	if errors.Is(err, pricing.ErrNoNights) {
+		writeError(w, http.StatusUnprocessableEntity, CodeValidation, "the reservation is not valid",
+			map[string][]string{"end_date": {"This date must be after the start date"}})
+		return
+	} else if err != nil {
+		serverError(w, err)
+		return
+	}
+
+	// the confirmation is queued with the booking, so it is sent if and only if the booking is made
+	confirmation, err := mailer.Compose(mailer.ReservationConfirmation(reservation, m.App.FrontDesk))
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+
+	reservation.ID, err = m.DB.CreateBooking(r.Context(), reservation, confirmation)
+
+	var conflict *repository.BookingConflictError
+	if errors.As(err, &conflict) {
+		writeError(w, http.StatusConflict, CodeConflict, "the room is not available for those dates", nil)
+		return
+	} else if err != nil {
+		serverError(w, err)
+		return
+	}
+
+	mailer.Notify()
+
+	created, err := m.DB.GetReservationById(r.Context(), reservation.ID)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/reservations/%s", created.Reference))
+	writeData(w, http.StatusCreated, toAPIReservation(created))
+}
+
+// GetReservation shows a booking to whoever knows its reference and email
+func (m *Repository) GetReservation(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.reservationFromURL(w, r, r.URL.Query().Get("email"))
+	if !ok {
+		return
+	}
+
+	writeData(w, http.StatusOK, toAPIReservation(res))
+}
+
+// PostCancelReservation cancels a booking and frees its dates, as staff can from the
+// reservation's admin page. The guest's cancellation, with its calendar invite, and the
+// front desk's notice are queued with it. Cancelling again changes nothing.
+func (m *Repository) PostCancelReservation(w http.ResponseWriter, r *http.Request) {
+	var req models.APICancellationRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	res, ok := m.reservationFromURL(w, r, req.Email)
+	if !ok {
+		return
+	}
+
+	if res.Status == models.StatusCancelled {
+		writeData(w, http.StatusOK, toAPIReservation(res))
+		return
+	}
+
+	cancelled := res
+	cancelled.Status = models.StatusCancelled
+	cancelled.Sequence++
+	cancelled.UpdatedAt = time.Now()
+
+	var outbox []models.OutboxMessage
+	for _, message := range []models.MailData{
+		mailer.ReservationCancelled(cancelled, m.App.FrontDesk),
+		mailer.FrontDeskNotice(res, m.App.FrontDesk, "Booking cancelled", "The booking was cancelled through the API."),
+	} {
+		msg, err := mailer.Compose(message)
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+		outbox = append(outbox, msg)
+	}
+
+	err := m.DB.TransitionReservation(r.Context(), res.ID, models.StatusCancelled, 0, "cancelled through the API", outbox...)
+
+	var invalid *repository.InvalidTransitionError
+	if errors.As(err, &invalid) {
+		writeError(w, http.StatusConflict, CodeConflict, fmt.Sprintf("a %s booking can't be cancelled", invalid.From), nil)
+		return
+	} else if err != nil {
+		serverError(w, err)
+		return
+	}
+
+	mailer.Notify()
+
+	writeData(w, http.StatusOK, toAPIReservation(cancelled))
+}
+
+// reservationFromURL loads the booking in the {reference} url parameter if email matches,
+// writing the error response if it can't. Both wrong reference and wrong email are not found.
+func (m *Repository) reservationFromURL(w http.ResponseWriter, r *http.Request, email string) (models.Reservation, bool) {
+	form := forms.New(url.Values{"email": {email}})
+	form.Required("email")
+
+	if !form.Valid() {
+		writeError(w, http.StatusBadRequest, CodeValidation, "the email of the booking is needed", form.Errors)
+		return models.Reservation{}, false
+	}
+
+	res, err := m.DB.GetReservationByReference(r.Context(), chi.URLParam(r, "reference"), email)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, CodeNotFound, "no booking with that reference and email", nil)
+		return res, false
+	} else if err != nil {
+		serverError(w, err)
+		return res, false
+	}
+
+	return res, true
+}
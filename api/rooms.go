@@ -0,0 +1,108 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/patrickoliveros/bookings/internal/forms"
+	"github.com/patrickoliveros/bookings/internal/pricing"
+	"github.com/patrickoliveros/bookings/models"
+)
+
+// GetRooms lists the rooms guests can book
+func (m *Repository) GetRooms(w http.ResponseWriter, r *http.Request) {
+	page, ok := pagination(w, r)
+	if !ok {
+		return
+	}
+
+	rooms, err := m.DB.GetActiveRooms(r.Context())
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+
+	from, to := bounds(&page, len(rooms))
+
+	list := make([]models.APIRoom, 0, to-from)
+	for _, room := range rooms[from:to] {
+		list = append(list, toAPIRoom(room))
+	}
+
+	writeList(w, list, page)
+}
+
+// GetRoom shows one room
+func (m *Repository) GetRoom(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, CodeNotFound, "no such room", nil)
+		return
+	}
+
+	room, err := m.DB.GetRoomByID(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && room.IsArchived()) {
+		writeError(w, http.StatusNotFound, CodeNotFound, "no such room", nil)
+		return
+	} else if err != nil {
+		serverError(w, err)
+		return
+	}
+
+	writeData(w, http.StatusOK, toAPIRoom(room))
+}
+
+// GetAvailability lists the rooms free from start_date to end_date, with the price of the stay
+func (m *Repository) GetAvailability(w http.ResponseWriter, r *http.Request) {
+	form := forms.New(r.URL.Query())
+	form.Required("start_date", "end_date")
+	form.DateRange("start_date", "end_date")
+
+	if !form.Valid() {
+		writeError(w, http.StatusBadRequest, CodeValidation, "invalid dates", form.Errors)
+		return
+	}
+
+	page, ok := pagination(w, r)
+	if !ok {
+		return
+	}
+
+	start, _ := time.Parse(forms.DateLayout, form.Get("start_date"))
+	end, _ := time.Parse(forms.DateLayout, form.Get("end_date"))
+
+	rooms, err := m.DB.SearchAvailabilityByDates(r.Context(), start, end)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+
+	from, to := bounds(&page, len(rooms))
+
+	list := make([]models.APIAvailableRoom, 0, to-from)
+	for _, room := range rooms[from:to] {
+		quote, err := m.quoteStay(r, room, start, end)
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+
+		list = append(list, models.APIAvailableRoom{APIRoom: toAPIRoom(room), Quote: quote})
+	}
+
+	writeList(w, list, page)
+}
+
+// quoteStay prices a stay in room with its seasonal rates
+func (m *Repository) quoteStay(r *http.Request, room models.Room, start, end time.Time) (models.Quote, error) {
+	seasons, err := m.DB.GetSeasonalRatesForRoom(r.Context(), room.ID)
+	if err != nil {
+		return models.Quote{}, err
+	}
+
+	return pricing.Quote(room, seasons, start, end, m.App.Pricing)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/patrickoliveros/bookings/internal/config"
+	"github.com/patrickoliveros/bookings/internal/driver"
+	"github.com/patrickoliveros/bookings/internal/forms"
+	"github.com/patrickoliveros/bookings/internal/helpers"
+	"github.com/patrickoliveros/bookings/internal/migrator"
+	"github.com/patrickoliveros/bookings/internal/repository/dbrepo"
+	"github.com/patrickoliveros/bookings/migrations"
+	"github.com/patrickoliveros/bookings/models"
+)
+
+// runCommand handles a subcommand given after the flags, e.g. `go run . migrate up`,
+// and returns the exit status
+func runCommand(args []string) int {
+	switch args[0] {
+	case "migrate":
+		return runMigrate(args[1:])
+	case "create-admin":
+		return runCreateAdmin(args[1:])
+	default:
+		fmt.Printf("Unknown command %q. Available commands: migrate, create-admin\n", args[0])
+		return 2
+	}
+}
+
+func runMigrate(args []string) int {
+	if len(args) == 0 {
+		fmt.Println("Usage: migrate up | down [steps|all] | status")
+		return 2
+	}
+
+	if settings.Repository == config.RepositoryMemory {
+		fmt.Println("The memory repository has no database to migrate")
+		return 2
+	}
+
+	db, err := driver.NewDatabase(appConnectionString)
+	if err != nil {
+		log.Println(">>> Cannot connect to database:", err)
+		return 1
+	}
+	defer db.Close()
+
+	m, err := migrator.New(db, migrations.Files)
+	if err != nil {
+		log.Println(">>> Cannot read migrations:", err)
+		return 1
+	}
+	m.Log = func(format string, v ...interface{}) {
+		log.Printf(">>> "+format, v...)
+	}
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		count, err := m.Up(ctx)
+		log.Printf(">>> %d migrations applied", count)
+		if err != nil {
+			log.Println(">>>", err)
+			return 1
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if args[1] == "all" {
+				steps = len(m.Migrations)
+			} else if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				fmt.Println("Steps must be a positive number or 'all'")
+				return 2
+			}
+		}
+
+		count, err := m.Down(ctx, steps)
+		log.Printf(">>> %d migrations rolled back", count)
+		if err != nil {
+			log.Println(">>>", err)
+			return 1
+		}
+	case "status":
+		list, err := m.Status(ctx)
+		if err != nil {
+			log.Println(">>>", err)
+			return 1
+		}
+
+		fmt.Printf("%-10s %-16s %s\n", "Status", "Version", "Name")
+		for _, x := range list {
+			state := "Pending"
+			if x.Applied {
+				state = "Applied"
+			}
+			fmt.Printf("%-10s %-16s %s\n", state, x.Version, x.Name)
+		}
+	default:
+		fmt.Printf("Unknown migrate action %q. Use up, down or status\n", args[0])
+		return 2
+	}
+
+	return 0
+}
+
+// runCreateAdmin adds an owner with a generated password, so a fresh database has
+// someone who can log in and invite the rest of the staff
+func runCreateAdmin(args []string) int {
+	if len(args) < 3 {
+		fmt.Println("Usage: create-admin <email> <first name> <last name>")
+		return 2
+	}
+
+	if settings.Repository == config.RepositoryMemory {
+		fmt.Println("The memory repository already has an admin user:", dbrepo.MemoryAdminEmail)
+		return 2
+	}
+
+	email := strings.TrimSpace(args[0])
+	if !forms.New(url.Values{"email": {email}}).IsEmail("email") {
+		fmt.Printf("%q is not a valid email address\n", email)
+		return 2
+	}
+
+	db, err := driver.NewDatabase(appConnectionString)
+	if err != nil {
+		log.Println(">>> Cannot connect to database:", err)
+		return 1
+	}
+	defer db.Close()
+
+	repo := dbrepo.NewPostGresRepo(db, &app)
+	ctx := context.Background()
+
+	_, err = repo.GetUserByEmail(ctx, email)
+	if err == nil {
+		fmt.Printf("A user with email %s already exists\n", email)
+		return 1
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		log.Println(">>>", err)
+		return 1
+	}
+
+	password := helpers.GenerateTemporaryPassword()
+
+	id, err := repo.InsertUser(ctx, models.User{
+		FirstName:   args[1],
+		LastName:    strings.Join(args[2:], " "),
+		Email:       email,
+		Password:    helpers.GenerateHashedPassword(password),
+		AccessLevel: models.AccessOwner,
+	})
+	if err != nil {
+		log.Println(">>>", err)
+		return 1
+	}
+
+	fmt.Printf("Created owner #%d %s with the temporary password %s\n", id, email, password)
+
+	return 0
+}
@@ -6,8 +6,6 @@ import (
 	"time"
 
 	"github.com/alexedwards/scs/v2"
-	"github.com/patrickoliveros/bookings/models"
-	mail "github.com/xhit/go-simple-mail/v2"
 )
 
 type AppConfig struct {
@@ -21,15 +19,12 @@ type AppConfig struct {
 	PortNumber    string
 	Session       *scs.SessionManager
 	SiteSuffix    string
-	MailChannel   chan models.MailData
-	MailServer    *mail.SMTPServer
+	SiteURL       string
+	TwoFactorRole string
+	APIRateLimit  int
+	MailTemplates map[string]*template.Template
+	FrontDesk     string
 	RootDirectory string
-}
-
-type MailConfig struct {
-	Host           string
-	Port           int
-	KeepAlive      bool
-	ConnectTimeout time.Time
-	SendTimeOut    time.Time
+	QueryTimeout  time.Duration
+	Pricing       PricingConfig
 }
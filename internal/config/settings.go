@@ -0,0 +1,602 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/patrickoliveros/bookings/models"
+	"gopkg.in/yaml.v2"
+)
+
+// Repository sources that can back the application
+const (
+	RepositoryPostgres = "postgres"
+	RepositoryMemory   = "memory"
+)
+
+// Mail transports that can deliver the outbox
+const (
+	MailTransportSMTP = "smtp"
+	MailTransportFile = "file"
+	MailTransportLog  = "log"
+)
+
+// EnvPrefix is prepended to every environment variable that overrides a setting
+const EnvPrefix = "BOOKINGS_"
+
+// Settings holds the values that can be read from a configuration file
+type Settings struct {
+	InProduction bool   `json:"production"`
+	UseCache     bool   `json:"cache"`
+	UseSecure    bool   `json:"secure"`
+	PortNumber   string `json:"port"`
+	SiteSuffix   string `json:"site_suffix"`
+
+	// SiteURL is the public address of the site, used for links in emails
+	SiteURL string `json:"site_url"`
+
+	// TwoFactorRole makes two-factor authentication compulsory for this role and the
+	// roles above it. Empty leaves it optional for everyone.
+	TwoFactorRole string `json:"two_factor_role"`
+
+	// ShutdownTimeout is how many seconds active requests and queued mail
+	// get to finish when the application is asked to stop
+	ShutdownTimeout int `json:"shutdown_timeout"`
+
+	// Repository is either "postgres" or "memory", which needs no database
+	Repository string `json:"repository"`
+
+	// SessionStore keeps sessions in "postgres", so they survive restarts and can be
+	// shared by several instances, or in "memory". Empty follows the repository.
+	SessionStore string `json:"session_store"`
+
+	// APIRateLimit is how many requests a minute each API client may make
+	APIRateLimit int `json:"api_rate_limit"`
+
+	Database DatabaseConfig `json:"database"`
+	Mail     MailConfig     `json:"mail"`
+	Pricing  PricingConfig  `json:"pricing"`
+}
+
+// DatabaseConfig holds the database connection settings
+type DatabaseConfig struct {
+	URL      string `json:"url" yaml:"url"`
+	Host     string `json:"host" yaml:"host"`
+	Port     string `json:"port" yaml:"port"`
+	Name     string `json:"name" yaml:"database"`
+	User     string `json:"user" yaml:"user"`
+	Password string `json:"password" yaml:"password"`
+	SSLMode  string `json:"sslmode" yaml:"sslmode"`
+
+	// QueryTimeout is the most seconds a single query may run
+	QueryTimeout int `json:"query_timeout" yaml:"query_timeout"`
+}
+
+// MailConfig holds the mail server settings, timeouts are in seconds
+type MailConfig struct {
+	// Transport is how mail leaves the application: "smtp" sends it to the mail server,
+	// "file" writes .eml files to Directory and "log" prints it to stdout
+	Transport string `json:"transport" yaml:"transport"`
+	Directory string `json:"directory" yaml:"directory"`
+
+	Host           string `json:"host" yaml:"host"`
+	Port           int    `json:"port" yaml:"port"`
+	ConnectTimeout int    `json:"connect_timeout" yaml:"connect_timeout"`
+	SendTimeout    int    `json:"send_timeout" yaml:"send_timeout"`
+
+	// Username and Password log in to the mail server when a username is set,
+	// using the Auth mechanism: "plain", "login" or "cram-md5"
+	Username string `json:"username" yaml:"username"`
+	Password string `json:"password" yaml:"password"`
+	Auth     string `json:"auth" yaml:"auth"`
+
+	// Encryption is "none", "ssl" for a connection that is encrypted from the start,
+	// or "starttls" to upgrade a plain one
+	Encryption string `json:"encryption" yaml:"encryption"`
+
+	// FrontDesk receives notifications about changes guests make to their bookings
+	FrontDesk string `json:"front_desk" yaml:"front_desk"`
+}
+
+// PricingConfig holds the currency, and the fees and taxes added to every quote
+type PricingConfig struct {
+	Currency string      `json:"currency" yaml:"currency"`
+	Fees     []FeeConfig `json:"fees" yaml:"fees"`
+	Taxes    []TaxConfig `json:"taxes" yaml:"taxes"`
+}
+
+// FeeConfig is a fixed charge in cents, added once per stay or once per night
+type FeeConfig struct {
+	Name     string `json:"name" yaml:"name"`
+	Amount   int    `json:"amount" yaml:"amount"`
+	PerNight bool   `json:"per_night" yaml:"per_night"`
+}
+
+// TaxConfig is a percentage charged on the nights and fees
+type TaxConfig struct {
+	Name    string  `json:"name" yaml:"name"`
+	Percent float64 `json:"percent" yaml:"percent"`
+}
+
+// SettingsError lists every problem found while loading settings
+type SettingsError struct {
+	Problems []string
+}
+
+func (e *SettingsError) Error() string {
+	return fmt.Sprintf("invalid configuration: %s", strings.Join(e.Problems, "; "))
+}
+
+// yamlEnvironment is one environment of a database.yml style file. Database
+// values sit at the top level the way soda expects them.
+type yamlEnvironment struct {
+	DatabaseConfig `yaml:",inline"`
+	Dialect        string `yaml:"dialect"`
+	Pool           int    `yaml:"pool"`
+
+	InProduction *bool          `yaml:"production"`
+	UseCache     *bool          `yaml:"cache"`
+	UseSecure    *bool          `yaml:"secure"`
+	PortNumber   string         `yaml:"port_number"`
+	SiteSuffix   string         `yaml:"site_suffix"`
+	SiteURL      string         `yaml:"site_url"`
+	TwoFactor    string         `yaml:"two_factor_role"`
+	Shutdown     int            `yaml:"shutdown_timeout"`
+	Repository   string         `yaml:"repository"`
+	SessionStore string         `yaml:"session_store"`
+	APIRateLimit int            `yaml:"api_rate_limit"`
+	Mail         MailConfig     `yaml:"mail"`
+	Pricing      *PricingConfig `yaml:"pricing"`
+}
+
+// baseSettings holds the optional values, anything required is left empty
+func baseSettings() Settings {
+	return Settings{
+		PortNumber: ":8080",
+		SiteSuffix: "Sample Go Web Application",
+		SiteURL:    "http://localhost:8080",
+
+		ShutdownTimeout: 30,
+		Repository:      RepositoryPostgres,
+		APIRateLimit:    60,
+
+		Database: DatabaseConfig{
+			SSLMode:      "disable",
+			QueryTimeout: 3,
+		},
+		Mail: MailConfig{
+			Transport:      MailTransportSMTP,
+			Directory:      "./mail",
+			ConnectTimeout: 10,
+			SendTimeout:    10,
+			Auth:           "plain",
+			Encryption:     "none",
+			FrontDesk:      "frontdesk@domain.com",
+		},
+		Pricing: PricingConfig{
+			Currency: "USD",
+		},
+	}
+}
+
+// DefaultSettings returns the hardcoded values used by the "default" config source
+func DefaultSettings() Settings {
+	s := baseSettings()
+
+	s.Database.Host = "your-db-server"
+	s.Database.Port = "5433"
+	s.Database.Name = "your-db-name"
+	s.Database.User = "your-db-user"
+	s.Database.Password = "your-db-password"
+
+	s.Mail.Host = "192.168.50.146"
+	s.Mail.Port = 1025
+
+	return s
+}
+
+// LoadSettings reads a json or yaml file, applies environment overrides,
+// and validates the result. A repository given on the command line wins over
+// both and is validated with the rest; empty keeps the file's.
+func LoadSettings(path, environment, repository string) (Settings, error) {
+	s := baseSettings()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return s, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml":
+		err = s.decodeYAML(data, environment)
+	default:
+		err = json.Unmarshal(data, &s)
+	}
+
+	if err != nil {
+		return s, fmt.Errorf("cannot read %s: %w", path, err)
+	}
+
+	problems := s.ApplyEnvironment(os.LookupEnv)
+	if repository != "" {
+		s.Repository = repository
+	}
+	problems = append(problems, s.Validate()...)
+
+	if len(problems) > 0 {
+		return s, &SettingsError{Problems: problems}
+	}
+
+	return s, nil
+}
+
+func (s *Settings) decodeYAML(data []byte, environment string) error {
+	// database.yml uses soda's envOr helper, so render it before parsing
+	tmpl, err := template.New("settings").Funcs(template.FuncMap{
+		"envOr": envOr,
+		"env":   os.Getenv,
+	}).Parse(string(data))
+	if err != nil {
+		return err
+	}
+
+	buf := new(bytes.Buffer)
+	if err = tmpl.Execute(buf, nil); err != nil {
+		return err
+	}
+
+	environments := map[string]yamlEnvironment{}
+	if err = yaml.Unmarshal(buf.Bytes(), &environments); err != nil {
+		return err
+	}
+
+	env, ok := environments[environment]
+	if !ok {
+		return fmt.Errorf("environment %q not found", environment)
+	}
+
+	if env.Dialect != "" && env.Dialect != "postgres" {
+		return fmt.Errorf("unsupported dialect %q", env.Dialect)
+	}
+
+	s.Database.merge(env.DatabaseConfig)
+	s.Mail.merge(env.Mail)
+
+	if env.InProduction != nil {
+		s.InProduction = *env.InProduction
+	}
+	if env.UseCache != nil {
+		s.UseCache = *env.UseCache
+	}
+	if env.UseSecure != nil {
+		s.UseSecure = *env.UseSecure
+	}
+	if env.PortNumber != "" {
+		s.PortNumber = env.PortNumber
+	}
+	if env.SiteSuffix != "" {
+		s.SiteSuffix = env.SiteSuffix
+	}
+	if env.SiteURL != "" {
+		s.SiteURL = env.SiteURL
+	}
+	if env.TwoFactor != "" {
+		s.TwoFactorRole = env.TwoFactor
+	}
+	if env.Shutdown != 0 {
+		s.ShutdownTimeout = env.Shutdown
+	}
+	if env.Repository != "" {
+		s.Repository = env.Repository
+	}
+	if env.SessionStore != "" {
+		s.SessionStore = env.SessionStore
+	}
+	if env.APIRateLimit != 0 {
+		s.APIRateLimit = env.APIRateLimit
+	}
+	if env.Pricing != nil {
+		pricing := *env.Pricing
+		if pricing.Currency == "" {
+			pricing.Currency = s.Pricing.Currency
+		}
+		s.Pricing = pricing
+	}
+
+	return nil
+}
+
+func (d *DatabaseConfig) merge(o DatabaseConfig) {
+	if o.URL != "" {
+		d.URL = o.URL
+	}
+	if o.Host != "" {
+		d.Host = o.Host
+	}
+	if o.Port != "" {
+		d.Port = o.Port
+	}
+	if o.Name != "" {
+		d.Name = o.Name
+	}
+	if o.User != "" {
+		d.User = o.User
+	}
+	if o.Password != "" {
+		d.Password = o.Password
+	}
+	if o.SSLMode != "" {
+		d.SSLMode = o.SSLMode
+	}
+	if o.QueryTimeout != 0 {
+		d.QueryTimeout = o.QueryTimeout
+	}
+}
+
+func (m *MailConfig) merge(o MailConfig) {
+	if o.Transport != "" {
+		m.Transport = o.Transport
+	}
+	if o.Directory != "" {
+		m.Directory = o.Directory
+	}
+	if o.Host != "" {
+		m.Host = o.Host
+	}
+	if o.Port != 0 {
+		m.Port = o.Port
+	}
+	if o.ConnectTimeout != 0 {
+		m.ConnectTimeout = o.ConnectTimeout
+	}
+	if o.SendTimeout != 0 {
+		m.SendTimeout = o.SendTimeout
+	}
+	if o.Username != "" {
+		m.Username = o.Username
+	}
+	if o.Password != "" {
+		m.Password = o.Password
+	}
+	if o.Auth != "" {
+		m.Auth = o.Auth
+	}
+	if o.Encryption != "" {
+		m.Encryption = o.Encryption
+	}
+	if o.FrontDesk != "" {
+		m.FrontDesk = o.FrontDesk
+	}
+}
+
+// ApplyEnvironment overrides settings with BOOKINGS_* variables and returns
+// a problem for every variable that could not be parsed
+func (s *Settings) ApplyEnvironment(lookup func(string) (string, bool)) []string {
+	var problems []string
+
+	str := func(key string, target *string) {
+		if v, ok := lookup(EnvPrefix + key); ok {
+			*target = v
+		}
+	}
+
+	boolean := func(key string, target *bool) {
+		if v, ok := lookup(EnvPrefix + key); ok {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s%s must be true or false", EnvPrefix, key))
+				return
+			}
+			*target = b
+		}
+	}
+
+	number := func(key string, target *int) {
+		if v, ok := lookup(EnvPrefix + key); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s%s must be a number", EnvPrefix, key))
+				return
+			}
+			*target = n
+		}
+	}
+
+	boolean("PRODUCTION", &s.InProduction)
+	boolean("CACHE", &s.UseCache)
+	boolean("SECURE", &s.UseSecure)
+	str("PORT", &s.PortNumber)
+	str("SITE_SUFFIX", &s.SiteSuffix)
+	str("SITE_URL", &s.SiteURL)
+	str("TWO_FACTOR_ROLE", &s.TwoFactorRole)
+	number("SHUTDOWN_TIMEOUT", &s.ShutdownTimeout)
+	str("REPOSITORY", &s.Repository)
+	str("SESSION_STORE", &s.SessionStore)
+	number("API_RATE_LIMIT", &s.APIRateLimit)
+
+	str("DB_URL", &s.Database.URL)
+	str("DB_HOST", &s.Database.Host)
+	str("DB_PORT", &s.Database.Port)
+	str("DB_NAME", &s.Database.Name)
+	str("DB_USER", &s.Database.User)
+	str("DB_PASSWORD", &s.Database.Password)
+	str("DB_SSLMODE", &s.Database.SSLMode)
+	number("DB_QUERY_TIMEOUT", &s.Database.QueryTimeout)
+
+	str("MAIL_TRANSPORT", &s.Mail.Transport)
+	str("MAIL_DIRECTORY", &s.Mail.Directory)
+	str("MAIL_HOST", &s.Mail.Host)
+	number("MAIL_PORT", &s.Mail.Port)
+	number("MAIL_CONNECT_TIMEOUT", &s.Mail.ConnectTimeout)
+	number("MAIL_SEND_TIMEOUT", &s.Mail.SendTimeout)
+	str("MAIL_USERNAME", &s.Mail.Username)
+	str("MAIL_PASSWORD", &s.Mail.Password)
+	str("MAIL_AUTH", &s.Mail.Auth)
+	str("MAIL_ENCRYPTION", &s.Mail.Encryption)
+	str("MAIL_FRONT_DESK", &s.Mail.FrontDesk)
+
+	str("CURRENCY", &s.Pricing.Currency)
+
+	return problems
+}
+
+// SessionStoreKind returns where sessions are kept, following the repository when
+// session_store is not set
+func (s *Settings) SessionStoreKind() string {
+	if s.SessionStore == "" {
+		return s.Repository
+	}
+
+	return s.SessionStore
+}
+
+// Validate returns a problem for every required value that is missing or invalid
+func (s *Settings) Validate() []string {
+	var problems []string
+
+	required := func(name, value string) {
+		if strings.TrimSpace(value) == "" {
+			problems = append(problems, fmt.Sprintf("%s is required", name))
+		}
+	}
+
+	required("port", s.PortNumber)
+
+	if !strings.HasPrefix(s.SiteURL, "http://") && !strings.HasPrefix(s.SiteURL, "https://") {
+		problems = append(problems, "site_url must start with http:// or https://")
+	}
+
+	if s.TwoFactorRole != "" && !models.IsRole(s.TwoFactorRole) {
+		problems = append(problems, fmt.Sprintf("two_factor_role %q must be %q, %q or %q", s.TwoFactorRole,
+			models.RoleFrontDesk, models.RoleManager, models.RoleOwner))
+	}
+
+	if s.ShutdownTimeout <= 0 {
+		problems = append(problems, "shutdown_timeout must be greater than zero")
+	}
+
+	switch s.Repository {
+	case RepositoryPostgres, RepositoryMemory:
+	default:
+		problems = append(problems, fmt.Sprintf("repository %q must be %q or %q", s.Repository, RepositoryPostgres, RepositoryMemory))
+	}
+
+	switch s.SessionStore {
+	case "", RepositoryMemory:
+	case RepositoryPostgres:
+		if s.Repository == RepositoryMemory {
+			problems = append(problems, "session_store \"postgres\" needs the postgres repository")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("session_store %q must be %q or %q", s.SessionStore, RepositoryPostgres, RepositoryMemory))
+	}
+
+	if s.APIRateLimit <= 0 {
+		problems = append(problems, "api_rate_limit must be greater than zero")
+	}
+
+	// a url carries everything needed to connect, and memory needs no database at all
+	if strings.TrimSpace(s.Database.URL) == "" && s.Repository != RepositoryMemory {
+		required("database.host", s.Database.Host)
+		required("database.port", s.Database.Port)
+		required("database.name", s.Database.Name)
+		required("database.user", s.Database.User)
+		required("database.password", s.Database.Password)
+
+		if _, err := strconv.Atoi(s.Database.Port); s.Database.Port != "" && err != nil {
+			problems = append(problems, "database.port must be a number")
+		}
+	}
+
+	if s.Database.QueryTimeout <= 0 {
+		problems = append(problems, "database.query_timeout must be greater than zero")
+	}
+
+	switch s.Database.SSLMode {
+	case "", "disable", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		problems = append(problems, fmt.Sprintf("database.sslmode %q is not supported", s.Database.SSLMode))
+	}
+
+	switch s.Mail.Transport {
+	case MailTransportSMTP:
+		required("mail.host", s.Mail.Host)
+		if s.Mail.Port <= 0 || s.Mail.Port > 65535 {
+			problems = append(problems, "mail.port must be between 1 and 65535")
+		}
+		if s.Mail.ConnectTimeout < 0 {
+			problems = append(problems, "mail.connect_timeout cannot be negative")
+		}
+		if s.Mail.SendTimeout < 0 {
+			problems = append(problems, "mail.send_timeout cannot be negative")
+		}
+
+		switch s.Mail.Auth {
+		case "plain", "login", "cram-md5":
+		default:
+			problems = append(problems, fmt.Sprintf("mail.auth %q must be \"plain\", \"login\" or \"cram-md5\"", s.Mail.Auth))
+		}
+
+		switch s.Mail.Encryption {
+		case "none", "ssl", "starttls":
+		default:
+			problems = append(problems, fmt.Sprintf("mail.encryption %q must be \"none\", \"ssl\" or \"starttls\"", s.Mail.Encryption))
+		}
+	case MailTransportFile:
+		required("mail.directory", s.Mail.Directory)
+	case MailTransportLog:
+	default:
+		problems = append(problems, fmt.Sprintf("mail.transport %q must be %q, %q or %q", s.Mail.Transport,
+			MailTransportSMTP, MailTransportFile, MailTransportLog))
+	}
+	required("mail.front_desk", s.Mail.FrontDesk)
+
+	if len(s.Pricing.Currency) != 3 {
+		problems = append(problems, "pricing.currency must be a three letter code like USD")
+	}
+	for i, fee := range s.Pricing.Fees {
+		required(fmt.Sprintf("pricing.fees[%d].name", i), fee.Name)
+		if fee.Amount < 0 {
+			problems = append(problems, fmt.Sprintf("pricing.fees[%d].amount cannot be negative", i))
+		}
+	}
+	for i, tax := range s.Pricing.Taxes {
+		required(fmt.Sprintf("pricing.taxes[%d].name", i), tax.Name)
+		if tax.Percent < 0 || tax.Percent > 100 {
+			problems = append(problems, fmt.Sprintf("pricing.taxes[%d].percent must be between 0 and 100", i))
+		}
+	}
+
+	return problems
+}
+
+// ConnectionString returns the dsn used by the database driver
+func (d DatabaseConfig) ConnectionString() string {
+	if d.URL != "" {
+		return d.URL
+	}
+
+	sslMode := d.SSLMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+
+	return fmt.Sprintf("host=%s port=%s user=%s "+
+		"password=%s dbname=%s sslmode=%s",
+		d.Host, d.Port, d.User, d.Password, d.Name, sslMode)
+}
+
+func envOr(key, fallback string) string {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		return v
+	}
+
+	return fallback
+}
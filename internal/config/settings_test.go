@@ -0,0 +1,216 @@
+package config
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func writeSettingsFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoadSettings_JSON(t *testing.T) {
+	path := writeSettingsFile(t, "config.json", `{
+		"port": ":9090",
+		"database": {"host": "db", "port": "5432", "name": "bookings", "user": "u", "password": "p"},
+		"mail": {"host": "smtp", "port": 2525}
+	}`)
+
+	s, err := LoadSettings(path, "development", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.PortNumber != ":9090" {
+		t.Errorf("expected port :9090, got %s", s.PortNumber)
+	}
+
+	if s.Mail.Host != "smtp" || s.Mail.Port != 2525 {
+		t.Errorf("unexpected mail settings %+v", s.Mail)
+	}
+
+	if s.Mail.ConnectTimeout != 10 {
+		t.Errorf("expected default connect timeout of 10, got %d", s.Mail.ConnectTimeout)
+	}
+
+	expected := "host=db port=5432 user=u password=p dbname=bookings sslmode=disable"
+	if s.Database.ConnectionString() != expected {
+		t.Errorf("expected %q, got %q", expected, s.Database.ConnectionString())
+	}
+}
+
+func TestLoadSettings_YAML(t *testing.T) {
+	path := writeSettingsFile(t, "database.yml", `
+development:
+  dialect: postgres
+  database: bookings
+  user: appuser
+  password: secret
+  host: 127.0.0.1
+  port: 5433
+  mail:
+    host: smtp
+    port: 1025
+
+production:
+  url: {{envOr "BOOKINGS_TEST_UNSET_URL" "postgres://u:p@db:5432/bookings"}}
+  mail:
+    host: smtp
+    port: 25
+`)
+
+	s, err := LoadSettings(path, "development", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Database.Name != "bookings" || s.Database.Port != "5433" {
+		t.Errorf("unexpected database settings %+v", s.Database)
+	}
+
+	s, err = LoadSettings(path, "production", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Database.ConnectionString() != "postgres://u:p@db:5432/bookings" {
+		t.Errorf("expected url connection string, got %s", s.Database.ConnectionString())
+	}
+
+	_, err = LoadSettings(path, "staging", "")
+	if err == nil {
+		t.Error("expected an error for a missing environment")
+	}
+}
+
+func TestLoadSettings_ReportsAllProblems(t *testing.T) {
+	path := writeSettingsFile(t, "config.json", `{"mail": {"port": 0}}`)
+
+	_, err := LoadSettings(path, "development", "")
+
+	var settingsErr *SettingsError
+	if !errors.As(err, &settingsErr) {
+		t.Fatalf("expected a SettingsError, got %v", err)
+	}
+
+	// host, port, name, user, password, mail host and mail port
+	if len(settingsErr.Problems) != 7 {
+		t.Errorf("expected 7 problems, got %d: %v", len(settingsErr.Problems), settingsErr.Problems)
+	}
+}
+
+func TestLoadSettings_Repository(t *testing.T) {
+	path := writeSettingsFile(t, "config.json", `{"port": ":9090", "mail": {"host": "smtp", "port": 2525}}`)
+
+	// the memory repository needs no database section
+	s, err := LoadSettings(path, "development", RepositoryMemory)
+	if err != nil {
+		t.Fatalf("expected memory settings without a database, got %v", err)
+	}
+
+	if s.Repository != RepositoryMemory {
+		t.Errorf("expected the memory repository, got %s", s.Repository)
+	}
+
+	path = writeSettingsFile(t, "config.json", `{"port": ":9090", "mail": {"host": "smtp", "port": 2525}, "session_store": "postgres"}`)
+
+	_, err = LoadSettings(path, "development", RepositoryMemory)
+
+	var settingsErr *SettingsError
+	if !errors.As(err, &settingsErr) || len(settingsErr.Problems) != 1 {
+		t.Errorf("expected postgres sessions to need the postgres repository, got %v", err)
+	}
+}
+
+func TestSettings_ApplyEnvironment(t *testing.T) {
+	env := map[string]string{
+		"BOOKINGS_MAIL_HOST":         "mail.internal",
+		"BOOKINGS_MAIL_PORT":         "587",
+		"BOOKINGS_DB_HOST":           "db.internal",
+		"BOOKINGS_PRODUCTION":        "yes please",
+		"BOOKINGS_MAIL_SEND_TIMEOUT": "soon",
+	}
+
+	lookup := func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+
+	s := DefaultSettings()
+	problems := s.ApplyEnvironment(lookup)
+
+	if s.Mail.Host != "mail.internal" || s.Mail.Port != 587 {
+		t.Errorf("mail settings were not overridden: %+v", s.Mail)
+	}
+
+	if s.Database.Host != "db.internal" {
+		t.Errorf("database host was not overridden: %s", s.Database.Host)
+	}
+
+	if len(problems) != 2 {
+		t.Errorf("expected 2 problems, got %v", problems)
+	}
+}
+
+func TestSettings_SessionStore(t *testing.T) {
+	tests := []struct {
+		repository, store string
+		kind              string
+		valid             bool
+	}{
+		{RepositoryPostgres, "", RepositoryPostgres, true},
+		{RepositoryMemory, "", RepositoryMemory, true},
+		{RepositoryPostgres, RepositoryMemory, RepositoryMemory, true},
+		{RepositoryMemory, RepositoryPostgres, RepositoryPostgres, false},
+		{RepositoryPostgres, "redis", "redis", false},
+	}
+
+	for _, test := range tests {
+		s := DefaultSettings()
+		s.Database.URL = "postgres://localhost/bookings"
+		s.Repository = test.repository
+		s.SessionStore = test.store
+
+		if kind := s.SessionStoreKind(); kind != test.kind {
+			t.Errorf("%s/%q: expected %s, got %s", test.repository, test.store, test.kind, kind)
+		}
+
+		if problems := s.Validate(); (len(problems) == 0) != test.valid {
+			t.Errorf("%s/%q: unexpected problems %v", test.repository, test.store, problems)
+		}
+	}
+}
+
+func TestSettings_MailTransport(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(m *MailConfig)
+		problems  int
+	}{
+		{"smtp", func(m *MailConfig) {}, 0},
+		{"smtp with login and starttls", func(m *MailConfig) { m.Auth, m.Encryption = "login", "starttls" }, 0},
+		{"smtp without host", func(m *MailConfig) { m.Host = "" }, 1},
+		{"smtp with unknown auth and encryption", func(m *MailConfig) { m.Auth, m.Encryption = "oauth", "tls" }, 2},
+		{"file without host", func(m *MailConfig) { m.Transport, m.Host = MailTransportFile, "" }, 0},
+		{"file without directory", func(m *MailConfig) { m.Transport, m.Directory = MailTransportFile, "" }, 1},
+		{"log without host", func(m *MailConfig) { m.Transport, m.Host, m.Port = MailTransportLog, "", 0 }, 0},
+		{"unknown transport", func(m *MailConfig) { m.Transport = "pigeon" }, 1},
+	}
+
+	for _, test := range tests {
+		s := DefaultSettings()
+		s.Repository = RepositoryMemory
+		test.configure(&s.Mail)
+
+		if problems := s.Validate(); len(problems) != test.problems {
+			t.Errorf("%s: expected %d problems, got %v", test.name, test.problems, problems)
+		}
+	}
+}
@@ -3,11 +3,23 @@ package forms
 import (
 	"fmt"
 	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
 	"github.com/asaskevich/govalidator"
 )
 
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// PasswordMinLength is the shortest password IsPassword accepts
+const PasswordMinLength = 10
+
+// DateLayout is how dates are written in forms and API requests
+const DateLayout = "2006-01-02"
+
 type Form struct {
 	url.Values
 	Errors errors
@@ -64,3 +76,79 @@ func (f *Form) IsEmail(field string) bool {
 
 	return true
 }
+
+// IsSlug checks the field only holds lowercase letters, digits and single dashes
+func (f *Form) IsSlug(field string) bool {
+	if !slugPattern.MatchString(f.Get(field)) {
+		f.Errors.Add(field, "Use lowercase letters, numbers and dashes only")
+		return false
+	}
+
+	return true
+}
+
+// MinValue checks the field is a whole number of at least min
+func (f *Form) MinValue(field string, min int) bool {
+	x, err := strconv.Atoi(strings.TrimSpace(f.Get(field)))
+	if err != nil || x < min {
+		f.Errors.Add(field, fmt.Sprintf("This field must be a number of at least %d", min))
+		return false
+	}
+
+	return true
+}
+
+// IsPassword checks the field is a password of at least PasswordMinLength characters
+// with both letters and digits in it
+func (f *Form) IsPassword(field string) bool {
+	x := f.Get(field)
+
+	var letters, digits bool
+	for _, c := range x {
+		letters = letters || unicode.IsLetter(c)
+		digits = digits || unicode.IsDigit(c)
+	}
+
+	if len([]rune(x)) < PasswordMinLength || !letters || !digits {
+		f.Errors.Add(field, fmt.Sprintf("Use at least %d characters with both letters and numbers", PasswordMinLength))
+		return false
+	}
+
+	return true
+}
+
+// IsDate checks the field is a date written as DateLayout
+func (f *Form) IsDate(field string) bool {
+	if _, err := time.Parse(DateLayout, f.Get(field)); err != nil {
+		f.Errors.Add(field, "Use a date like 2006-01-02")
+		return false
+	}
+
+	return true
+}
+
+// DateRange checks both fields are dates and that end comes after start
+func (f *Form) DateRange(start, end string) bool {
+	if !f.IsDate(start) || !f.IsDate(end) {
+		return false
+	}
+
+	s, _ := time.Parse(DateLayout, f.Get(start))
+	e, _ := time.Parse(DateLayout, f.Get(end))
+	if !e.After(s) {
+		f.Errors.Add(end, "This date must be after the start date")
+		return false
+	}
+
+	return true
+}
+
+// GuestDetails checks the name, email and phone a guest books with
+func (f *Form) GuestDetails() bool {
+	f.Required("first_name", "last_name", "email", "phone")
+	f.MinLength("first_name", 5)
+	f.MinLength("last_name", 5)
+	f.IsEmail("email")
+
+	return f.Valid()
+}
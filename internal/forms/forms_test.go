@@ -128,3 +128,84 @@ func TestForm_IsEmail(t *testing.T) {
 		t.Error("got valid for invalid email address")
 	}
 }
+
+func TestForm_IsSlug(t *testing.T) {
+	var tests = []struct {
+		slug  string
+		valid bool
+	}{
+		{"majors-suite", true},
+		{"room-3", true},
+		{"Majors-Suite", false},
+		{"majors--suite", false},
+		{"-majors", false},
+		{"majors suite", false},
+		{"", false},
+	}
+
+	for _, e := range tests {
+		form := New(url.Values{"slug": {e.slug}})
+		if form.IsSlug("slug") != e.valid {
+			t.Errorf("%q: expected valid %v", e.slug, e.valid)
+		}
+	}
+}
+
+func TestForm_MinValue(t *testing.T) {
+	form := New(url.Values{"capacity": {"2"}})
+	if !form.MinValue("capacity", 1) {
+		t.Error("shows invalid for a number above the minimum")
+	}
+
+	form = New(url.Values{"capacity": {"0"}})
+	if form.MinValue("capacity", 1) {
+		t.Error("shows valid for a number below the minimum")
+	}
+
+	form = New(url.Values{"capacity": {"two"}})
+	if form.MinValue("capacity", 1) {
+		t.Error("shows valid for a value that is not a number")
+	}
+}
+
+func TestForm_IsPassword(t *testing.T) {
+	var tests = []struct {
+		password string
+		valid    bool
+	}{
+		{"correct horse 42", true},
+		{"abcdefghi1", true},
+		{"abcdefgh1", false},
+		{"abcdefghijkl", false},
+		{"123456789012", false},
+		{"", false},
+	}
+
+	for _, e := range tests {
+		form := New(url.Values{"password": {e.password}})
+		if form.IsPassword("password") != e.valid {
+			t.Errorf("%q: expected valid %v", e.password, e.valid)
+		}
+	}
+}
+
+func TestForm_DateRange(t *testing.T) {
+	var tests = []struct {
+		start string
+		end   string
+		valid bool
+	}{
+		{"2026-11-01", "2026-11-03", true},
+		{"2026-11-01", "2026-11-01", false},
+		{"2026-11-03", "2026-11-01", false},
+		{"11/01/2026", "2026-11-03", false},
+		{"2026-11-01", "", false},
+	}
+
+	for _, e := range tests {
+		form := New(url.Values{"start_date": {e.start}, "end_date": {e.end}})
+		if form.DateRange("start_date", "end_date") != e.valid {
+			t.Errorf("%s to %s: expected valid %v", e.start, e.end, e.valid)
+		}
+	}
+}
@@ -1,11 +1,14 @@
 package helpers
 
 import (
+	cryptorand "crypto/rand"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"log"
 	"math/rand"
 	"net"
+	"net/http"
 	"strings"
 	"time"
 	"unicode"
@@ -43,8 +46,7 @@ func HandleDate(strInput string) (time.Time, string, error) {
 
 	t, err := time.Parse(layout, strInput)
 	if err != nil {
-		log.Fatal(fmt.Sprintf("Cannot parse date: %s", strInput))
-		return t, "", err
+		return t, "", fmt.Errorf("cannot parse date: %q", strInput)
 	}
 
 	readableDate := t.Format(layoutUS)
@@ -59,12 +61,43 @@ func SanitizeString(strInput string) string {
 	return strings.Title(strInput)
 }
 
+// Slugify turns a name like "Major's Suite" into "majors-suite"
+func Slugify(name string) string {
+	var b strings.Builder
+	dash := false
+
+	for _, c := range strings.ToLower(name) {
+		switch {
+		case c == '\'':
+			continue
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+			if dash && b.Len() > 0 {
+				b.WriteRune('-')
+			}
+			b.WriteRune(c)
+			dash = false
+		default:
+			dash = true
+		}
+	}
+
+	return b.String()
+}
+
 func GenerateHashedPassword(password string) string {
 	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(password), 12)
 
 	return string(hashedPassword)
 }
 
+// GenerateTemporaryPassword returns a random 16 character password for a new or reset account
+func GenerateTemporaryPassword() string {
+	b := make([]byte, 12)
+	_, _ = cryptorand.Read(b)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
 func GenerateGuid() string {
 	rawGuid := uuid.New()
 	guid := strings.Replace(rawGuid.String(), "-", "", -1)
@@ -132,10 +165,22 @@ func GetMonthBoundaries(now time.Time) (time.Time, time.Time) {
 
 }
 
+// ClientIP returns the address of the client, without its port
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
 func GetOutboundIP() net.IP {
 	conn, err := net.Dial("udp", "8.8.8.8:80")
 	if err != nil {
-		log.Fatal(err)
+		// a page showing the address must not take the server down without a network
+		log.Println(err)
+		return nil
 	}
 	defer conn.Close()
 
@@ -1,6 +1,8 @@
 package helpers
 
 import (
+	"fmt"
+	"strings"
 	"time"
 )
 
@@ -29,3 +31,58 @@ func Iterate(count int) []int {
 func Add(a, b int) int {
 	return a + b
 }
+
+// Amount formats cents as a decimal number, like 12900 as 129.00
+func Amount(cents int) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// Money formats cents with their currency, like USD 129.00
+func Money(cents int, currency string) string {
+	return fmt.Sprintf("%s %s", currency, Amount(cents))
+}
+
+// Device describes a browser user agent briefly, like "Firefox on Windows"
+func Device(userAgent string) string {
+	browser := "Unknown browser"
+	switch {
+	case strings.Contains(userAgent, "Edg/"):
+		browser = "Edge"
+	case strings.Contains(userAgent, "OPR/"):
+		browser = "Opera"
+	case strings.Contains(userAgent, "Firefox/"):
+		browser = "Firefox"
+	case strings.Contains(userAgent, "Chrome/"):
+		browser = "Chrome"
+	case strings.Contains(userAgent, "Safari/"):
+		browser = "Safari"
+	case strings.HasPrefix(userAgent, "curl/"):
+		browser = "curl"
+	}
+
+	system := ""
+	switch {
+	case strings.Contains(userAgent, "Android"):
+		system = "Android"
+	case strings.Contains(userAgent, "iPhone"), strings.Contains(userAgent, "iPad"):
+		system = "iOS"
+	case strings.Contains(userAgent, "Windows"):
+		system = "Windows"
+	case strings.Contains(userAgent, "Mac OS X"):
+		system = "macOS"
+	case strings.Contains(userAgent, "Linux"):
+		system = "Linux"
+	}
+
+	if system == "" {
+		return browser
+	}
+
+	return browser + " on " + system
+}
@@ -0,0 +1,177 @@
+// Package ical writes RFC 5545 iCalendar files of all-day events, the way hotels
+// and booking channels share stays: an event starts on the arrival date and ends,
+// exclusively, on the departure date.
+package ical
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ContentType is the MIME type of an iCalendar file
+const ContentType = "text/calendar; charset=utf-8"
+
+// productID names the application that wrote a calendar
+const productID = "-//Bookings//Reservations//EN"
+
+// maxLineLength is the length in octets after which lines are folded, without the line break
+const maxLineLength = 75
+
+// Calendar methods from RFC 5546. Invites sent by email need one; feeds don't.
+const (
+	MethodPublish = "PUBLISH"
+	MethodCancel  = "CANCEL"
+)
+
+// Event statuses
+const (
+	StatusTentative = "TENTATIVE"
+	StatusConfirmed = "CONFIRMED"
+	StatusCancelled = "CANCELLED"
+)
+
+// Calendar is a VCALENDAR with its events
+type Calendar struct {
+	// Name is shown by clients that subscribe to the calendar
+	Name   string
+	Method string
+	Events []Event
+}
+
+// Event is an all-day VEVENT. Clients match events by UID and keep the one with the
+// highest Sequence, so both must be stable for as long as the event exists.
+type Event struct {
+	UID      string
+	Sequence int
+
+	// Stamp is when this version of the event was written
+	Stamp time.Time
+
+	// Start and End are dates; End is the first day after the event
+	Start time.Time
+	End   time.Time
+
+	Summary     string
+	Description string
+	Location    string
+	URL         string
+	Status      string
+
+	// Organizer is an email address, required by clients to cancel an event
+	Organizer string
+}
+
+// Bytes returns the calendar as an iCalendar file
+func (c Calendar) Bytes() []byte {
+	buf := new(bytes.Buffer)
+	_, _ = c.WriteTo(buf)
+
+	return buf.Bytes()
+}
+
+// WriteTo writes the calendar to w as an iCalendar file
+func (c Calendar) WriteTo(w io.Writer) (int64, error) {
+	cw := &writer{w: w}
+
+	cw.line("BEGIN", "VCALENDAR")
+	cw.line("VERSION", "2.0")
+	cw.line("PRODID", productID)
+	cw.line("CALSCALE", "GREGORIAN")
+	if c.Method != "" {
+		cw.line("METHOD", c.Method)
+	}
+	if c.Name != "" {
+		cw.line("X-WR-CALNAME", Escape(c.Name))
+	}
+
+	for _, e := range c.Events {
+		cw.line("BEGIN", "VEVENT")
+		cw.line("UID", e.UID)
+		cw.line("SEQUENCE", fmt.Sprint(e.Sequence))
+		cw.line("DTSTAMP", e.Stamp.UTC().Format("20060102T150405Z"))
+		cw.line("DTSTART;VALUE=DATE", e.Start.Format("20060102"))
+		cw.line("DTEND;VALUE=DATE", e.End.Format("20060102"))
+		cw.line("SUMMARY", Escape(e.Summary))
+		if e.Description != "" {
+			cw.line("DESCRIPTION", Escape(e.Description))
+		}
+		if e.Location != "" {
+			cw.line("LOCATION", Escape(e.Location))
+		}
+		if e.URL != "" {
+			cw.line("URL", e.URL)
+		}
+		if e.Status != "" {
+			cw.line("STATUS", e.Status)
+		}
+		if e.Organizer != "" {
+			cw.line("ORGANIZER", "mailto:"+e.Organizer)
+		}
+		// stays block the room, and the guest's time
+		cw.line("TRANSP", "OPAQUE")
+		cw.line("END", "VEVENT")
+	}
+
+	cw.line("END", "VCALENDAR")
+
+	return cw.n, cw.err
+}
+
+// Escape escapes the characters that have a meaning in iCalendar text values
+func Escape(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+		"\r", `\n`,
+	).Replace(s)
+}
+
+// writer writes content lines, folded and ended with CRLF, keeping the first error
+type writer struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (cw *writer) line(name, value string) {
+	if cw.err != nil {
+		return
+	}
+
+	n, err := io.WriteString(cw.w, Fold(name+":"+value))
+	cw.n += int64(n)
+	cw.err = err
+}
+
+// Fold splits a content line into lines of at most 75 octets, each continued
+// line starting with a space, and ends it with CRLF. UTF-8 characters are never split.
+func Fold(line string) string {
+	var b strings.Builder
+
+	limit := maxLineLength
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+
+		// the leading space counts towards the length of continued lines
+		limit = maxLineLength - 1
+	}
+
+	b.WriteString(line)
+	b.WriteString("\r\n")
+
+	return b.String()
+}
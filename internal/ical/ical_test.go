@@ -0,0 +1,115 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/patrickoliveros/bookings/models"
+)
+
+func TestCalendar_Bytes(t *testing.T) {
+	cal := Calendar{
+		Method: MethodPublish,
+		Events: []Event{{
+			UID:         "ABC123@rooms.here.com",
+			Sequence:    2,
+			Stamp:       time.Date(2030, 2, 1, 10, 30, 0, 0, time.FixedZone("EST", -5*3600)),
+			Start:       time.Date(2030, 3, 1, 0, 0, 0, 0, time.UTC),
+			End:         time.Date(2030, 3, 3, 0, 0, 0, 0, time.UTC),
+			Summary:     "Stay at General's Quarters, room 1; late arrival",
+			Description: "Booking ABC123\nTotal: USD 250.00",
+			Status:      StatusConfirmed,
+			Organizer:   "desk@here.com",
+		}},
+	}
+
+	out := string(cal.Bytes())
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\nVERSION:2.0\r\n",
+		"METHOD:PUBLISH\r\n",
+		"UID:ABC123@rooms.here.com\r\n",
+		"SEQUENCE:2\r\n",
+		"DTSTAMP:20300201T153000Z\r\n",
+		"DTSTART;VALUE=DATE:20300301\r\n",
+		"DTEND;VALUE=DATE:20300303\r\n",
+		`SUMMARY:Stay at General's Quarters\, room 1\; late arrival` + "\r\n",
+		`DESCRIPTION:Booking ABC123\nTotal: USD 250.00` + "\r\n",
+		"ORGANIZER:mailto:desk@here.com\r\n",
+		"END:VEVENT\r\nEND:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in:\n%s", want, out)
+		}
+	}
+
+	if strings.Contains(out, "LOCATION") || strings.Contains(out, "X-WR-CALNAME") {
+		t.Errorf("expected empty properties to be left out:\n%s", out)
+	}
+}
+
+func TestFold(t *testing.T) {
+	line := "DESCRIPTION:" + strings.Repeat("é", 100)
+
+	folded := Fold(line)
+	if !strings.HasSuffix(folded, "\r\n") {
+		t.Fatalf("expected the line to end with CRLF, got %q", folded)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(folded, "\r\n"), "\r\n")
+	if len(lines) < 3 {
+		t.Fatalf("expected the line to be folded, got %q", folded)
+	}
+
+	unfolded := lines[0]
+	for i, l := range lines {
+		if len(l) > maxLineLength {
+			t.Errorf("line %d is %d octets long", i, len(l))
+		}
+		if i > 0 {
+			if !strings.HasPrefix(l, " ") {
+				t.Errorf("line %d does not start with a space: %q", i, l)
+			}
+			unfolded += l[1:]
+		}
+	}
+
+	if unfolded != line {
+		t.Errorf("expected unfolding to give back the line, got %q", unfolded)
+	}
+
+	if Fold("SEQUENCE:0") != "SEQUENCE:0\r\n" {
+		t.Errorf("expected a short line to be left alone")
+	}
+}
+
+func TestRoomFeed(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2030, 3, d, 0, 0, 0, 0, time.UTC) }
+
+	restrictions := []models.RoomRestriction{
+		{ID: 4, ReservationID: 9, StartDate: day(1), EndDate: day(3), Reservation: models.Reservation{
+			Reference: "ABC123", FirstName: "Johnny", Status: models.StatusPending, Sequence: 1, UpdatedAt: day(1),
+		}},
+		{ID: 5, StartDate: day(5), EndDate: day(6), UpdatedAt: day(1)},
+	}
+
+	out := string(RoomFeed(models.Room{RoomName: "General's Quarters"}, restrictions, "https://rooms.here.com").Bytes())
+
+	for _, want := range []string{
+		"X-WR-CALNAME:General's Quarters\r\n",
+		"UID:reservation-9@rooms.here.com\r\nSEQUENCE:1\r\n",
+		"SUMMARY:Booked\r\n",
+		"STATUS:TENTATIVE\r\n",
+		"UID:block-5@rooms.here.com\r\nSEQUENCE:0\r\n",
+		"DTSTART;VALUE=DATE:20300305\r\nDTEND;VALUE=DATE:20300306\r\nSUMMARY:Blocked\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in:\n%s", want, out)
+		}
+	}
+
+	if strings.Contains(out, "Johnny") || strings.Contains(out, "ABC123") || strings.Contains(out, "METHOD") {
+		t.Errorf("expected a feed without guests, references or a method:\n%s", out)
+	}
+}
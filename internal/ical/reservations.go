@@ -0,0 +1,83 @@
+package ical
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/patrickoliveros/bookings/models"
+)
+
+// UID returns the identifier of the event of a booking. It is made from the
+// booking reference and the site's host, so it never changes and is unique
+// among the calendars a guest keeps.
+func UID(reference, siteURL string) string {
+	host := "bookings"
+	if u, err := url.Parse(siteURL); err == nil && u.Hostname() != "" {
+		host = u.Hostname()
+	}
+
+	return reference + "@" + host
+}
+
+// ReservationEvent is the event of a stay, as the guest sees it. The reservation must have its room.
+func ReservationEvent(res models.Reservation, siteURL string) Event {
+	status := StatusConfirmed
+	if res.Status == models.StatusCancelled {
+		status = StatusCancelled
+	}
+
+	stamp := res.UpdatedAt
+	if stamp.IsZero() {
+		stamp = time.Now()
+	}
+
+	return Event{
+		UID:         UID(res.Reference, siteURL),
+		Sequence:    res.Sequence,
+		Stamp:       stamp,
+		Start:       res.StartDate,
+		End:         res.EndDate,
+		Summary:     "Stay at " + res.Room.RoomName,
+		Description: fmt.Sprintf("Booking reference %s\nManage your booking at %s/manage-booking", res.Reference, siteURL),
+		URL:         siteURL + "/manage-booking",
+		Status:      status,
+	}
+}
+
+// RoomFeed is the calendar of a room for housekeeping and booking channels: its
+// reservations and owner blocks. It tells when the room is taken, not who by, so the
+// events carry neither the guest nor the booking reference, which lets a guest manage
+// the booking. Their UIDs are made from ids instead.
+func RoomFeed(room models.Room, restrictions []models.RoomRestriction, siteURL string) Calendar {
+	cal := Calendar{Name: room.RoomName}
+
+	for _, rr := range restrictions {
+		event := Event{
+			UID:     UID(fmt.Sprintf("block-%d", rr.ID), siteURL),
+			Stamp:   rr.UpdatedAt,
+			Start:   rr.StartDate,
+			End:     rr.EndDate,
+			Summary: "Blocked",
+			Status:  StatusConfirmed,
+		}
+
+		if res := rr.Reservation; rr.ReservationID > 0 {
+			event.UID = UID(fmt.Sprintf("reservation-%d", rr.ReservationID), siteURL)
+			event.Sequence = res.Sequence
+			event.Stamp = res.UpdatedAt
+			event.Summary = "Booked"
+			if res.Status == models.StatusPending {
+				event.Status = StatusTentative
+			}
+		}
+
+		if event.Stamp.IsZero() {
+			event.Stamp = time.Now()
+		}
+
+		cal.Events = append(cal.Events, event)
+	}
+
+	return cal
+}
@@ -0,0 +1,39 @@
+package lockout
+
+import "time"
+
+// Window is how far back failed logins from one address are counted
+const Window = 15 * time.Minute
+
+// Policy is an exponential backoff: after Free failures, each further failure doubles
+// the wait before the next attempt, starting at Base and never more than Max
+type Policy struct {
+	Free int
+	Base time.Duration
+	Max  time.Duration
+}
+
+// Account throttles logins to a single account. Its failures are counted until the
+// next successful login or an admin unlocks it.
+var Account = Policy{Free: 4, Base: 30 * time.Second, Max: 15 * time.Minute}
+
+// Address throttles logins from a single IP address, across all accounts, within Window
+var Address = Policy{Free: 20, Base: 30 * time.Second, Max: 15 * time.Minute}
+
+// Delay returns how long to wait after the given number of consecutive failures
+func (p Policy) Delay(failures int) time.Duration {
+	if failures <= p.Free {
+		return 0
+	}
+
+	delay := p.Base
+	for i := p.Free + 1; i < failures && delay < p.Max; i++ {
+		delay *= 2
+	}
+
+	if delay > p.Max {
+		return p.Max
+	}
+
+	return delay
+}
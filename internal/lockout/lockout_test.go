@@ -0,0 +1,30 @@
+package lockout
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicy_Delay(t *testing.T) {
+	p := Policy{Free: 4, Base: 30 * time.Second, Max: 15 * time.Minute}
+
+	var tests = []struct {
+		failures int
+		delay    time.Duration
+	}{
+		{0, 0},
+		{4, 0},
+		{5, 30 * time.Second},
+		{6, time.Minute},
+		{7, 2 * time.Minute},
+		{9, 8 * time.Minute},
+		{10, 15 * time.Minute},
+		{1000, 15 * time.Minute},
+	}
+
+	for _, e := range tests {
+		if delay := p.Delay(e.failures); delay != e.delay {
+			t.Errorf("%d failures: expected %s, got %s", e.failures, e.delay, delay)
+		}
+	}
+}
@@ -1,54 +1,128 @@
 package mailer
 
 import (
-	"io/ioutil"
-	"log"
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"path/filepath"
 	"strings"
 
 	"github.com/patrickoliveros/bookings/internal/config"
+	"github.com/patrickoliveros/bookings/internal/helpers"
+	"github.com/patrickoliveros/bookings/internal/repository"
 	"github.com/patrickoliveros/bookings/models"
-	mail "github.com/xhit/go-simple-mail/v2"
 )
 
+// DefaultTemplate is used for messages that don't name a template; it shows their Content
+const DefaultTemplate = "message"
+
 var app *config.AppConfig
 
-func NewMailer(a *config.AppConfig) {
+// sender delivers the messages of the outbox
+var sender Sender
+
+var functions = template.FuncMap{
+	"humanDate":  helpers.HumanDate,
+	"formatDate": helpers.FormatDate,
+	"amount":     helpers.Amount,
+	"money":      helpers.Money,
+	"siteURL":    func() string { return app.SiteURL },
+}
+
+// NewMailer sets the configuration the templates use and the sender the worker delivers with
+func NewMailer(a *config.AppConfig, s Sender) {
 	app = a
+	sender = s
 }
 
-func ListenForMail() {
-	go func() {
-		for {
-			msg := <-app.MailChannel
-			sendMessage(msg)
+// CreateTemplateCache parses every named email template in directory with its layouts.
+// Templates are named after their file, without the .mail.html extension.
+func CreateTemplateCache(directory string) (map[string]*template.Template, error) {
+	myCache := map[string]*template.Template{}
+
+	pages, err := filepath.Glob(filepath.Join(directory, "*.mail.html"))
+	if err != nil {
+		return myCache, err
+	}
+	if len(pages) == 0 {
+		return myCache, fmt.Errorf("no email templates in %s", directory)
+	}
+
+	layouts := filepath.Join(directory, "*.layout.html")
+
+	for _, page := range pages {
+		name := filepath.Base(page)
+
+		ts, err := template.New(name).Funcs(functions).ParseFiles(page)
+		if err != nil {
+			return myCache, err
 		}
-	}()
+
+		ts, err = ts.ParseGlob(layouts)
+		if err != nil {
+			return myCache, err
+		}
+
+		myCache[strings.TrimSuffix(name, ".mail.html")] = ts
+	}
+
+	return myCache, nil
 }
 
-func sendMessage(m models.MailData) {
-	client, err := app.MailServer.Connect()
-	if err != nil {
-		log.Println(err)
+// Render returns the html body of m, made from its named template, and its plain text alternative
+func Render(m models.MailData) (string, string, error) {
+	name := m.Template
+	if name == "" {
+		name = DefaultTemplate
+	}
+
+	ts, ok := app.MailTemplates[name]
+	if !ok {
+		return "", "", fmt.Errorf("no email template named %q", name)
+	}
+
+	if m.ContentHtml == "" {
+		m.ContentHtml = template.HTML(m.Content)
 	}
 
-	log.Println(">> Trying to send a message...")
+	buf := new(bytes.Buffer)
+	if err := ts.Execute(buf, m); err != nil {
+		return "", "", fmt.Errorf("email template %q: %w", name, err)
+	}
 
-	email := mail.NewMSG()
-	email.SetFrom(m.From).AddTo(m.To).SetSubject(m.Subject)
+	return buf.String(), PlainText(buf.String()), nil
+}
 
-	data, err := ioutil.ReadFile("./email-templates/basic.html")
+// Compose renders m into a message for the outbox
+func Compose(m models.MailData) (models.OutboxMessage, error) {
+	body, text, err := Render(m)
 	if err != nil {
-		panic(err)
+		return models.OutboxMessage{}, err
 	}
 
-	mailTemplate := string(data)
-	msgToSend := strings.Replace(mailTemplate, "[%body%]", "hello, world", 1)
-	email.SetBody(mail.TextHTML, msgToSend)
+	return models.OutboxMessage{
+		To:          m.To,
+		From:        m.From,
+		Subject:     m.Subject,
+		HTMLBody:    body,
+		TextBody:    text,
+		Attachments: m.Attachments,
+	}, nil
+}
 
-	err = email.Send(client)
+// Queue renders m and adds it to the outbox of db for the worker to send
+func Queue(ctx context.Context, db repository.DatabaseRepo, m models.MailData) error {
+	msg, err := Compose(m)
 	if err != nil {
-		log.Println(">> Failed sending email:", err)
-	} else {
-		log.Println(">> Email sent!")
+		return err
 	}
+
+	if _, err = db.InsertOutboxMessage(ctx, msg); err != nil {
+		return err
+	}
+
+	Notify()
+
+	return nil
 }
@@ -0,0 +1,292 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/patrickoliveros/bookings/internal/config"
+	"github.com/patrickoliveros/bookings/internal/repository/dbrepo"
+	"github.com/patrickoliveros/bookings/models"
+)
+
+func TestRender(t *testing.T) {
+	tc, err := CreateTemplateCache("../../email-templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	NewMailer(&config.AppConfig{SiteURL: "https://rooms.here.com", MailTemplates: tc}, nil)
+
+	res := models.Reservation{
+		FirstName: "Johnny",
+		LastName:  "<Walker>",
+		Reference: "ABC123",
+		StartDate: time.Date(2030, 3, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2030, 3, 3, 0, 0, 0, 0, time.UTC),
+		Room:      models.Room{RoomName: "General's Quarters"},
+		Quote:     models.Quote{Currency: "USD", Total: 25000},
+	}
+
+	body, text, err := Render(models.MailData{
+		From:     "desk@here.com",
+		Subject:  "Reservation Confirmation #ABC123",
+		Template: "reservation-confirmation",
+		Data:     map[string]interface{}{"reservation": res},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(body, "&lt;Walker&gt;") || strings.Contains(body, "hello, world") {
+		t.Errorf("expected the escaped reservation in the html body")
+	}
+
+	for _, want := range []string{
+		"Your booking reference is ABC123.",
+		"Name: Johnny <Walker>",
+		"Room: General's Quarters",
+		"manage your booking (https://rooms.here.com/manage-booking)",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected %q in the plain text, got:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "<td") || strings.Contains(text, "\n\n\n") {
+		t.Errorf("expected plain text without tags or runs of empty lines, got:\n%s", text)
+	}
+
+	_, text, err = Render(models.MailData{Subject: "Hello", Content: "<p>Just <strong>this</strong></p>"})
+	if err != nil || !strings.Contains(text, "Just this") {
+		t.Errorf("expected the default template to show the content, got %q %v", text, err)
+	}
+
+	if _, _, err := Render(models.MailData{Template: "nowhere"}); err == nil {
+		t.Error("expected an error for an unknown template")
+	}
+
+	if _, err := CreateTemplateCache("./nowhere"); err == nil {
+		t.Error("expected an error for a directory without templates")
+	}
+}
+
+func TestNextAttempt(t *testing.T) {
+	now := time.Now()
+	timeout := errors.New("Mail Error: SMTP Connection timed out")
+
+	var tests = []struct {
+		name     string
+		attempts int
+		err      error
+		wait     time.Duration
+	}{
+		{"first failure", 1, timeout, retryDelay},
+		{"third failure", 3, timeout, 4 * retryDelay},
+		{"capped", 9, timeout, maxRetryDelay},
+		{"out of attempts", MaxAttempts, timeout, 0},
+		{"busy mailbox", 1, &textproto.Error{Code: 450, Msg: "mailbox busy"}, retryDelay},
+		{"no such user", 1, &textproto.Error{Code: 550, Msg: "no such user"}, 0},
+	}
+
+	for _, e := range tests {
+		next := NextAttempt(e.attempts, e.err, now)
+
+		if e.wait == 0 && !next.IsZero() {
+			t.Errorf("%s: expected the message to be dead-lettered, got a retry at %s", e.name, next)
+		} else if e.wait != 0 && next.Sub(now) != e.wait {
+			t.Errorf("%s: expected a retry after %s, got %s", e.name, e.wait, next.Sub(now))
+		}
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	ctx := context.Background()
+	db := dbrepo.NewMemoryRepo(nil)
+
+	sent := &Recorder{Err: &textproto.Error{Code: 550, Msg: "no such user"}}
+	NewMailer(&config.AppConfig{}, sent)
+
+	refused, _ := db.InsertOutboxMessage(ctx, models.OutboxMessage{To: "nobody@here.com"})
+	Deliver(db)
+
+	sent.Err = errors.New("Mail Error: SMTP Connection timed out")
+	failed, _ := db.InsertOutboxMessage(ctx, models.OutboxMessage{To: "john@here.com", Subject: "Hello"})
+	Deliver(db)
+
+	if dead, _ := db.GetOutboxMessages(ctx, models.OutboxDead, 10); len(dead) != 1 || dead[0].ID != refused {
+		t.Errorf("expected the refused message to be dead, got %+v", dead)
+	}
+
+	pending, _ := db.GetOutboxMessages(ctx, models.OutboxPending, 10)
+	if len(pending) != 1 || pending[0].ID != failed || !pending[0].IsStuck() || pending[0].LastError == "" {
+		t.Fatalf("expected the failed message to wait for a retry, got %+v", pending)
+	}
+
+	sent.Err = nil
+	_ = db.RetryOutboxMessage(ctx, failed)
+	Deliver(db)
+
+	if messages := sent.Messages(); len(messages) != 1 || messages[0].Subject != "Hello" {
+		t.Errorf("expected the retried message to be sent, got %+v", messages)
+	}
+}
+
+func TestSenders(t *testing.T) {
+	msg := models.OutboxMessage{
+		ID:       7,
+		To:       "john@here.com",
+		From:     "desk@here.com",
+		Subject:  "Hello",
+		HTMLBody: "<p>Hello <strong>John</strong></p>",
+		TextBody: "Hello John\n",
+		Attachments: []models.Attachment{
+			{Name: "reservation-ABC123.ics", ContentType: "text/calendar; charset=utf-8; method=PUBLISH", Data: []byte("BEGIN:VCALENDAR")},
+		},
+	}
+
+	dir := t.TempDir()
+	if err := (&FileSender{Directory: dir}).Send(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*-7.eml"))
+	if len(files) != 1 {
+		t.Fatalf("expected an .eml file for the message, got %v", files)
+	}
+
+	eml, _ := ioutil.ReadFile(files[0])
+	for _, want := range []string{"Subject: Hello", "To: <john@here.com>", "multipart/alternative", "text/plain", "text/html",
+		"text/calendar", "reservation-ABC123.ics"} {
+		if !strings.Contains(string(eml), want) {
+			t.Errorf("expected %q in the .eml file", want)
+		}
+	}
+
+	out := new(bytes.Buffer)
+	if err := (&LogSender{Out: out}).Send(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(out.String(), "To: john@here.com") || !strings.Contains(out.String(), "Hello John") {
+		t.Errorf("expected the message in the log, got %q", out.String())
+	}
+}
+
+// fakeSMTP accepts every message sent to it and reports each connection once the client
+// has closed it
+func fakeSMTP(t *testing.T) (net.Listener, <-chan int) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	closed := make(chan int, 10)
+	go func() {
+		for n := 1; ; n++ {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(n int, conn net.Conn) {
+				defer conn.Close()
+
+				text := textproto.NewConn(conn)
+				_ = text.PrintfLine("220 localhost ready")
+				for {
+					line, err := text.ReadLine()
+					if err != nil {
+						closed <- n
+						return
+					}
+
+					switch strings.ToUpper(strings.SplitN(line, " ", 2)[0]) {
+					case "DATA":
+						_ = text.PrintfLine("354 go ahead")
+						_, _ = text.ReadDotBytes()
+						_ = text.PrintfLine("250 queued")
+					case "QUIT":
+						_ = text.PrintfLine("221 bye")
+					default:
+						_ = text.PrintfLine("250 ok")
+					}
+				}
+			}(n, conn)
+		}
+	}()
+
+	return l, closed
+}
+
+func TestSMTPSender(t *testing.T) {
+	l, closed := fakeSMTP(t)
+	defer l.Close()
+
+	addr := l.Addr().(*net.TCPAddr)
+	sender := NewSMTPSender(config.MailConfig{Host: "127.0.0.1", Port: addr.Port, ConnectTimeout: 1})
+	msg := models.OutboxMessage{To: "john@here.com", From: "desk@here.com", Subject: "Hello", TextBody: "Hello John\n"}
+
+	// every message gets its own connection, which is closed once the message is sent
+	for i := 1; i <= 2; i++ {
+		if err := sender.Send(msg); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case n := <-closed:
+			if n != i {
+				t.Errorf("expected connection %d to be closed, got %d", i, n)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected the connection of message %d to be closed", i)
+		}
+	}
+}
+
+func TestReservationInvites(t *testing.T) {
+	NewMailer(&config.AppConfig{SiteURL: "https://rooms.here.com"}, nil)
+
+	res := models.Reservation{
+		Email:     "johnny@here.com",
+		Reference: "ABC123",
+		StartDate: time.Date(2030, 3, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2030, 3, 3, 0, 0, 0, 0, time.UTC),
+		Room:      models.Room{RoomName: "General's Quarters"},
+		Status:    models.StatusPending,
+	}
+
+	confirmation := ReservationConfirmation(res, "desk@here.com")
+
+	res.Sequence = 2
+	res.Status = models.StatusCancelled
+	cancellation := ReservationCancelled(res, "desk@here.com")
+
+	var tests = []struct {
+		name string
+		mail models.MailData
+		want []string
+	}{
+		{"confirmation", confirmation, []string{"METHOD:PUBLISH", "SEQUENCE:0", "STATUS:CONFIRMED"}},
+		{"cancellation", cancellation, []string{"METHOD:CANCEL", "SEQUENCE:2", "STATUS:CANCELLED"}},
+	}
+
+	for _, e := range tests {
+		if len(e.mail.Attachments) != 1 || e.mail.Attachments[0].Name != "reservation-ABC123.ics" {
+			t.Fatalf("%s: expected the booking's invite, got %+v", e.name, e.mail.Attachments)
+		}
+
+		invite := string(e.mail.Attachments[0].Data)
+		for _, want := range append(e.want, "UID:ABC123@rooms.here.com", "DTSTART;VALUE=DATE:20300301", "ORGANIZER:mailto:desk@here.com") {
+			if !strings.Contains(invite, want+"\r\n") {
+				t.Errorf("%s: expected %q in the invite:\n%s", e.name, want, invite)
+			}
+		}
+	}
+}
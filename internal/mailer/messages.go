@@ -0,0 +1,79 @@
+package mailer
+
+import (
+	"fmt"
+	"html"
+
+	"github.com/patrickoliveros/bookings/internal/ical"
+	"github.com/patrickoliveros/bookings/models"
+)
+
+// ReservationConfirmation is the email telling a guest their booking was made.
+// The reservation must have its room.
+func ReservationConfirmation(res models.Reservation, from string) models.MailData {
+	return models.MailData{
+		To:   res.Email,
+		From: from,
+		Subject: fmt.Sprintf("Reservation Confirmation #%s - %s, %s",
+			res.Reference, res.LastName, res.FirstName),
+		Template:    "reservation-confirmation",
+		Data:        map[string]interface{}{"reservation": res},
+		Attachments: []models.Attachment{invite(res, from, ical.MethodPublish)},
+	}
+}
+
+// ReservationChanged is the email telling a guest the dates of their booking changed.
+// The reservation must have its room and the new dates.
+func ReservationChanged(res models.Reservation, from string) models.MailData {
+	return models.MailData{
+		To:          res.Email,
+		From:        from,
+		Subject:     fmt.Sprintf("Reservation Changed #%s - %s, %s", res.Reference, res.LastName, res.FirstName),
+		Template:    "reservation-changed",
+		Data:        map[string]interface{}{"reservation": res},
+		Attachments: []models.Attachment{invite(res, from, ical.MethodPublish)},
+	}
+}
+
+// ReservationCancelled is the email telling a guest their booking was cancelled.
+// The reservation must have its room.
+func ReservationCancelled(res models.Reservation, from string) models.MailData {
+	return models.MailData{
+		To:          res.Email,
+		From:        from,
+		Subject:     fmt.Sprintf("Reservation Cancelled #%s - %s, %s", res.Reference, res.LastName, res.FirstName),
+		Template:    "reservation-cancelled",
+		Data:        map[string]interface{}{"reservation": res},
+		Attachments: []models.Attachment{invite(res, from, ical.MethodCancel)},
+	}
+}
+
+// FrontDeskNotice is the email telling the front desk about a change a guest made to
+// their booking. The reservation must have its room.
+func FrontDeskNotice(res models.Reservation, frontDesk, subject, message string) models.MailData {
+	return models.MailData{
+		To:      frontDesk,
+		From:    frontDesk,
+		Subject: fmt.Sprintf("%s - Booking #%s", subject, res.Reference),
+		Content: fmt.Sprintf(`<p>%s</p>
+<p>Booking #%s for %s %s<br>
+%s, %s to %s</p>`,
+			html.EscapeString(message), res.Reference, html.EscapeString(res.FirstName), html.EscapeString(res.LastName),
+			html.EscapeString(res.Room.RoomName), res.StartDate.Format("2006-01-02"), res.EndDate.Format("2006-01-02")),
+	}
+}
+
+// invite is the calendar file sent with the emails about a booking. Every email about
+// the booking carries the same event, so calendars update it instead of adding another.
+func invite(res models.Reservation, from, method string) models.Attachment {
+	event := ical.ReservationEvent(res, app.SiteURL)
+	event.Organizer = from
+
+	cal := ical.Calendar{Method: method, Events: []ical.Event{event}}
+
+	return models.Attachment{
+		Name:        fmt.Sprintf("reservation-%s.ics", res.Reference),
+		ContentType: ical.ContentType + "; method=" + method,
+		Data:        cal.Bytes(),
+	}
+}
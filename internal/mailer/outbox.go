@@ -0,0 +1,160 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/textproto"
+	"time"
+
+	"github.com/patrickoliveros/bookings/internal/repository"
+	"github.com/patrickoliveros/bookings/models"
+)
+
+const (
+	// pollInterval is how often the worker looks for due messages when nothing wakes it up
+	pollInterval = 15 * time.Second
+
+	// batchSize is how many messages the worker claims at a time
+	batchSize = 10
+
+	// sendLease is how long a claimed message is left alone before it may be tried again,
+	// should the worker sending it stop before recording the result
+	sendLease = 5 * time.Minute
+
+	// MaxAttempts is how many times a message is tried before it is dead-lettered
+	MaxAttempts = 10
+
+	// retryDelay is the wait after the first failure; it doubles with each further one
+	retryDelay    = 30 * time.Second
+	maxRetryDelay = 2 * time.Hour
+)
+
+// wake tells the worker new messages were queued
+var wake = make(chan struct{}, 1)
+
+// stop is closed to stop the worker, and done once it has
+var stop, done chan struct{}
+
+// StartWorker delivers the outbox of db in the background until StopWorker is called
+func StartWorker(db repository.DatabaseRepo) {
+	stop = make(chan struct{})
+	done = make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		for {
+			Deliver(db)
+
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			case <-wake:
+			}
+		}
+	}()
+}
+
+// StopWorker waits for the message being sent to finish and stops the worker.
+// Whatever is left in the outbox is sent once the worker starts again.
+func StopWorker(ctx context.Context) error {
+	close(stop)
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("the mail worker did not stop: %w", ctx.Err())
+	}
+}
+
+// Notify wakes the worker up to send newly queued messages without waiting for the next poll
+func Notify() {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+// Deliver sends the messages in the outbox of db that are due, a batch at a time, until
+// none are left. The worker calls it whenever it wakes up.
+func Deliver(db repository.DatabaseRepo) {
+	for {
+		messages, err := db.ClaimOutboxMessages(context.Background(), batchSize, sendLease)
+		if err != nil {
+			log.Println(">> Can't read the mail outbox:", err)
+			return
+		}
+
+		for _, msg := range messages {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			deliverMessage(db, msg)
+		}
+
+		if len(messages) < batchSize {
+			return
+		}
+	}
+}
+
+func deliverMessage(db repository.DatabaseRepo, msg models.OutboxMessage) {
+	err := sender.Send(msg)
+	if err == nil {
+		log.Printf(">> Email %d sent to %s", msg.ID, msg.To)
+
+		if err = db.MarkOutboxMessageSent(context.Background(), msg.ID); err != nil {
+			log.Printf(">> Can't record that email %d was sent: %s", msg.ID, err)
+		}
+		return
+	}
+
+	retryAt := NextAttempt(msg.Attempts, err, time.Now())
+	if retryAt.IsZero() {
+		log.Printf(">> Giving up on email %d to %s after %d attempts: %s", msg.ID, msg.To, msg.Attempts, err)
+	} else {
+		log.Printf(">> Failed sending email %d to %s, trying again at %s: %s",
+			msg.ID, msg.To, retryAt.Format("15:04:05"), err)
+	}
+
+	if err = db.FailOutboxMessage(context.Background(), msg.ID, err.Error(), retryAt); err != nil {
+		log.Printf(">> Can't record that email %d failed: %s", msg.ID, err)
+	}
+}
+
+// NextAttempt returns when to try a message again after it failed with err on the given
+// attempt, doubling the wait each time. It returns zero when the message should be
+// dead-lettered, because the attempts are used up or the failure is permanent.
+func NextAttempt(attempts int, err error, now time.Time) time.Time {
+	if attempts >= MaxAttempts || isPermanent(err) {
+		return time.Time{}
+	}
+
+	delay := retryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+
+	return now.Add(delay)
+}
+
+// isPermanent reports whether the mail server refused the message for good
+// with a 5xx reply, so sending it again would not help
+func isPermanent(err error) bool {
+	var reply *textproto.Error
+
+	return errors.As(err, &reply) && reply.Code >= 500
+}
@@ -0,0 +1,190 @@
+package mailer
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/patrickoliveros/bookings/internal/config"
+	"github.com/patrickoliveros/bookings/models"
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+// Sender delivers a rendered email. An error that wraps a *textproto.Error with a 5xx
+// code means the message was refused for good; any other error is worth a retry.
+type Sender interface {
+	Send(msg models.OutboxMessage) error
+}
+
+// NewSender returns the sender for the configured transport
+func NewSender(c config.MailConfig) (Sender, error) {
+	switch c.Transport {
+	case config.MailTransportSMTP:
+		return NewSMTPSender(c), nil
+	case config.MailTransportFile:
+		return &FileSender{Directory: c.Directory}, nil
+	case config.MailTransportLog:
+		return &LogSender{Out: os.Stdout}, nil
+	}
+
+	return nil, fmt.Errorf("unknown mail transport %q", c.Transport)
+}
+
+// newEmail builds the MIME message of msg. Clients show the last alternative they
+// understand, so the html body comes after the plain text.
+func newEmail(msg models.OutboxMessage) (*mail.Email, error) {
+	email := mail.NewMSG()
+	email.SetFrom(msg.From).AddTo(msg.To).SetSubject(msg.Subject)
+	email.SetBody(mail.TextPlain, msg.TextBody)
+	email.AddAlternative(mail.TextHTML, msg.HTMLBody)
+
+	for _, a := range msg.Attachments {
+		email.Attach(&mail.File{Name: a.Name, MimeType: a.ContentType, Data: a.Data})
+	}
+
+	return email, email.Error
+}
+
+//region smtp
+
+// SMTPSender sends every message through a new connection to the mail server
+type SMTPSender struct {
+	Server *mail.SMTPServer
+}
+
+// NewSMTPSender returns a sender for the mail server in c
+func NewSMTPSender(c config.MailConfig) *SMTPSender {
+	server := mail.NewSMTPClient()
+	server.Host = c.Host
+	server.Port = c.Port
+	server.KeepAlive = false
+	server.ConnectTimeout = time.Duration(c.ConnectTimeout) * time.Second
+	server.SendTimeout = time.Duration(c.SendTimeout) * time.Second
+
+	server.Authentication = mail.AuthNone
+	if c.Username != "" {
+		server.Username = c.Username
+		server.Password = c.Password
+
+		switch c.Auth {
+		case "login":
+			server.Authentication = mail.AuthLogin
+		case "cram-md5":
+			server.Authentication = mail.AuthCRAMMD5
+		default:
+			server.Authentication = mail.AuthPlain
+		}
+	}
+
+	switch c.Encryption {
+	case "ssl":
+		server.Encryption = mail.EncryptionSSLTLS
+	case "starttls":
+		server.Encryption = mail.EncryptionSTARTTLS
+	default:
+		server.Encryption = mail.EncryptionNone
+	}
+
+	return &SMTPSender{Server: server}
+}
+
+func (s *SMTPSender) Send(msg models.OutboxMessage) error {
+	email, err := newEmail(msg)
+	if err != nil {
+		return err
+	}
+
+	client, err := s.Server.Connect()
+	if err != nil {
+		return fmt.Errorf("can't connect to the mail server: %w", err)
+	}
+	// without a send timeout the library leaves the connection open after the message
+	defer client.Close()
+
+	return email.Send(client)
+}
+
+//endregion
+
+//region file
+
+// FileSender writes every message to an .eml file in Directory, which mail clients can open
+type FileSender struct {
+	Directory string
+}
+
+func (s *FileSender) Send(msg models.OutboxMessage) error {
+	email, err := newEmail(msg)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(s.Directory, 0755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%d.eml", time.Now().Format("20060102-150405"), msg.ID)
+
+	return ioutil.WriteFile(filepath.Join(s.Directory, name), []byte(email.GetMessage()), 0644)
+}
+
+//endregion
+
+//region log
+
+// LogSender prints every message, as plain text, to Out
+type LogSender struct {
+	Out io.Writer
+
+	mu sync.Mutex
+}
+
+func (s *LogSender) Send(msg models.OutboxMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := fmt.Fprintf(s.Out, "----- email %d -----\nFrom: %s\nTo: %s\nSubject: %s\n\n%s-----\n",
+		msg.ID, msg.From, msg.To, msg.Subject, msg.TextBody)
+
+	return err
+}
+
+//endregion
+
+//region recorder
+
+// Recorder keeps every message instead of sending it, so tests can look at what was sent.
+// Err, when set, is returned for every message, which is then not kept.
+type Recorder struct {
+	Err error
+
+	mu       sync.Mutex
+	messages []models.OutboxMessage
+}
+
+func (s *Recorder) Send(msg models.OutboxMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Err != nil {
+		return s.Err
+	}
+
+	s.messages = append(s.messages, msg)
+
+	return nil
+}
+
+// Messages returns the messages sent so far, oldest first
+func (s *Recorder) Messages() []models.OutboxMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]models.OutboxMessage(nil), s.messages...)
+}
+
+//endregion
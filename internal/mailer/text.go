@@ -0,0 +1,61 @@
+package mailer
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	hiddenElement = regexp.MustCompile(`(?is)<!--.*?-->|<head[\s>].*?</head>|<style[\s>].*?</style>`)
+	linkElement   = regexp.MustCompile(`(?is)<a\s[^>]*href="([^"]*)"[^>]*>(.*?)</a>`)
+	lineBreak     = regexp.MustCompile(`(?i)<br\s*/?>|</(tr|li)>`)
+	paragraphEnd  = regexp.MustCompile(`(?i)</(p|div|h[1-6]|table)>`)
+	cellTag       = regexp.MustCompile(`(?i)</?(td|th)(\s[^>]*)?>`)
+	anyTag        = regexp.MustCompile(`(?s)<[^>]*>`)
+	spaces        = regexp.MustCompile(`\s+`)
+)
+
+// PlainText turns an html email body into its plain text alternative.
+// Links keep their address, and there is at most one empty line between paragraphs.
+func PlainText(body string) string {
+	body = hiddenElement.ReplaceAllString(body, "")
+
+	body = linkElement.ReplaceAllStringFunc(body, func(a string) string {
+		match := linkElement.FindStringSubmatch(a)
+		href, text := html.UnescapeString(match[1]), anyTag.ReplaceAllString(match[2], "")
+
+		if strings.HasPrefix(href, "mailto:") || href == "#" || strings.TrimSpace(text) == href {
+			return text
+		}
+
+		return text + " (" + href + ")"
+	})
+
+	// like a browser, only elements break lines, not the line breaks in the source
+	body = spaces.ReplaceAllString(body, " ")
+	body = lineBreak.ReplaceAllString(body, "\n")
+	body = paragraphEnd.ReplaceAllString(body, "\n\n")
+	body = cellTag.ReplaceAllString(body, " ")
+	body = html.UnescapeString(anyTag.ReplaceAllString(body, ""))
+
+	var lines []string
+	blank := false
+
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(spaces.ReplaceAllString(line, " "))
+
+		if line == "" {
+			blank = len(lines) > 0
+			continue
+		}
+
+		if blank {
+			lines = append(lines, "")
+			blank = false
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
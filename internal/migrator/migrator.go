@@ -0,0 +1,225 @@
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// schemaTable is the table soda uses too, so databases it migrated are picked up as they are
+const schemaTable = "schema_migration"
+
+// fileName matches soda's naming, e.g. 20210907180421_create_user_table.postgres.up.sql
+var fileName = regexp.MustCompile(`^(\d{14})_(\w+?)(\.postgres)?\.(up|down)\.sql$`)
+
+// Migration is a single versioned change to the schema
+type Migration struct {
+	Version string
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a migration and whether it has been applied
+type Status struct {
+	Migration
+	Applied bool
+}
+
+// Migrator applies and rolls back migrations against a database
+type Migrator struct {
+	DB         *sql.DB
+	Migrations []Migration
+	Log        func(format string, v ...interface{})
+}
+
+// Load reads every migration from fsys, sorted by version. Files that do not
+// follow the migration naming, like schema.sql, are skipped.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[string]*Migration{}
+
+	for _, entry := range entries {
+		parts := fileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || parts == nil {
+			continue
+		}
+
+		version, name, direction := parts[1], parts[2], parts[4]
+
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("version %s is used by both %s and %s", version, m.Name, name)
+		}
+
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	var migrations []Migration
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// New returns a migrator for the migrations in fsys
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		DB:         db,
+		Migrations: migrations,
+		Log:        func(string, ...interface{}) {},
+	}, nil
+}
+
+func (m *Migrator) ensureSchemaTable(ctx context.Context) error {
+	_, err := m.DB.ExecContext(ctx, fmt.Sprintf(`
+		create table if not exists %[1]s (version varchar(14) not null);
+		create unique index if not exists %[1]s_version_idx on %[1]s (version);`, schemaTable))
+
+	return err
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[string]bool, error) {
+	if err := m.ensureSchemaTable(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := m.DB.QueryContext(ctx, fmt.Sprintf(`select version from %s`, schemaTable))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := map[string]bool{}
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		versions[version] = true
+	}
+
+	return versions, rows.Err()
+}
+
+// Up applies every pending migration in version order and returns how many ran.
+// Each migration runs in its own transaction together with its version row.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, migration := range m.Migrations {
+		if applied[migration.Version] {
+			continue
+		}
+
+		start := time.Now()
+
+		err := m.run(ctx, migration.Up, fmt.Sprintf(`insert into %s (version) values ($1)`, schemaTable), migration.Version)
+		if err != nil {
+			return count, fmt.Errorf("migration %s_%s failed: %w", migration.Version, migration.Name, err)
+		}
+
+		m.Log("applied %s_%s (%s)", migration.Version, migration.Name, time.Since(start).Round(time.Millisecond))
+		count++
+	}
+
+	return count, nil
+}
+
+// Down rolls back the most recent applied migrations, at most steps of them,
+// and returns how many were rolled back
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := len(m.Migrations) - 1; i >= 0 && count < steps; i-- {
+		migration := m.Migrations[i]
+		if !applied[migration.Version] {
+			continue
+		}
+
+		err := m.run(ctx, migration.Down, fmt.Sprintf(`delete from %s where version = $1`, schemaTable), migration.Version)
+		if err != nil {
+			return count, fmt.Errorf("rollback of %s_%s failed: %w", migration.Version, migration.Name, err)
+		}
+
+		m.Log("rolled back %s_%s", migration.Version, migration.Name)
+		count++
+	}
+
+	return count, nil
+}
+
+// Status lists every migration and whether it has been applied
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Status
+	for _, migration := range m.Migrations {
+		list = append(list, Status{Migration: migration, Applied: applied[migration.Version]})
+	}
+
+	return list, nil
+}
+
+func (m *Migrator) run(ctx context.Context, script, bookkeeping, version string) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// an empty file, like a seed that was never filled in, only records the version
+	if strings.TrimSpace(script) != "" {
+		if _, err = tx.ExecContext(ctx, script); err != nil {
+			return err
+		}
+	}
+
+	if _, err = tx.ExecContext(ctx, bookkeeping, version); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,246 @@
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	_ "github.com/jackc/pgx/v4/stdlib"
+	"github.com/patrickoliveros/bookings/migrations"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"20210907181928_create_rooms_table.postgres.up.sql":   {Data: []byte("create table rooms ();")},
+		"20210907181928_create_rooms_table.postgres.down.sql": {Data: []byte("drop table rooms;")},
+		"20210907180421_create_user_table.up.sql":             {Data: []byte("create table users ();")},
+		"20210907180421_create_user_table.down.sql":           {Data: []byte("drop table users;")},
+		"20210907180421_create_user_table.up.fizz":            {Data: []byte(`create_table("users")`)},
+		"schema.sql": {Data: []byte("")},
+	}
+
+	list, err := Load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != 2 {
+		t.Fatalf("expected 2 migrations, got %d", len(list))
+	}
+
+	if list[0].Name != "create_user_table" || list[1].Name != "create_rooms_table" {
+		t.Errorf("migrations are not sorted by version: %s, %s", list[0].Name, list[1].Name)
+	}
+
+	if list[1].Down != "drop table rooms;" {
+		t.Errorf("unexpected down script %q", list[1].Down)
+	}
+}
+
+func TestLoad_DuplicateVersion(t *testing.T) {
+	fsys := fstest.MapFS{
+		"20210907181928_create_rooms_table.up.sql": {Data: []byte("")},
+		"20210907181928_create_users_table.up.sql": {Data: []byte("")},
+	}
+
+	if _, err := Load(fsys); err == nil {
+		t.Error("expected an error for two migrations sharing a version")
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	list, err := Load(migrations.Files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) == 0 {
+		t.Fatal("no migrations were embedded")
+	}
+
+	for _, m := range list {
+		if m.Up == "" && m.Name != "add_user_to_user_table" {
+			t.Errorf("%s_%s has no up script", m.Version, m.Name)
+		}
+	}
+}
+
+// TestEmbeddedMigrations_Syntax catches the mistakes that would stop migrate up on a new
+// database: unterminated strings, comments or dollar quotes, unbalanced parentheses and
+// on conflict clauses postgres does not accept
+func TestEmbeddedMigrations_Syntax(t *testing.T) {
+	list, err := Load(migrations.Files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range list {
+		for direction, script := range map[string]string{"up": m.Up, "down": m.Down} {
+			if err := checkSQL(script); err != nil {
+				t.Errorf("%s_%s %s: %v", m.Version, m.Name, direction, err)
+			}
+		}
+	}
+}
+
+func TestCheckSQL(t *testing.T) {
+	var tests = []struct {
+		script string
+		valid  bool
+	}{
+		{"insert into rooms (room_name) values ('Majors Suite') on conflict do nothing", true},
+		{"insert into restrictions (id) values (1) on conflict (id) do nothing;", true},
+		{"insert into rooms (id) values (1) on conflict on constraint rooms_pkey do nothing", true},
+		{"insert into rooms (room_name) values ('Majors Suite') on conflict on id do nothing", false},
+		{"-- insert into rooms values (1) on conflict on id do nothing", true},
+		{"select 'it''s (here'", true},
+		{"select 'unterminated", false},
+		{"select count(id from rooms", false},
+		{"do $$ begin raise exception 'a ( b'; end $$;", true},
+		{"do $$ begin", false},
+		{"/* never closed", false},
+	}
+
+	for _, e := range tests {
+		if err := checkSQL(e.script); (err == nil) != e.valid {
+			t.Errorf("%q: expected valid %v, got %v", e.script, e.valid, err)
+		}
+	}
+}
+
+// TestEmbeddedMigrations_Postgres applies every migration to an empty database, rolls
+// them all back and applies them again. It runs when BOOKINGS_TEST_DATABASE_URL is set.
+func TestEmbeddedMigrations_Postgres(t *testing.T) {
+	dsn := os.Getenv("BOOKINGS_TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("BOOKINGS_TEST_DATABASE_URL is not set")
+	}
+
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	m, err := New(db, migrations.Files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	if _, err = m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.Down(ctx, len(m.Migrations)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// onConflict is what may follow "on conflict": a conflict target or the action
+var onConflict = regexp.MustCompile(`(?i)^\s*(\(|on\s+constraint\s+\w+|do\b)`)
+
+var onConflictClause = regexp.MustCompile(`(?i)\bon\s+conflict\b`)
+
+var dollarQuote = regexp.MustCompile(`^\$\w*\$`)
+
+// checkSQL looks for the syntax errors a lexer can find in a postgres script. It is no
+// replacement for running the script, which TestEmbeddedMigrations_Postgres does.
+func checkSQL(script string) error {
+	var code strings.Builder
+	depth := 0
+
+	for i := 0; i < len(script); {
+		rest := script[i:]
+
+		switch {
+		case strings.HasPrefix(rest, "--"):
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			i += end
+		case strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest[2:], "*/")
+			if end < 0 {
+				return fmt.Errorf("comment at offset %d is never closed", i)
+			}
+			i += end + 4
+		case rest[0] == '\'' || rest[0] == '"':
+			end, err := closingQuote(rest, i > 0 && (script[i-1] == 'E' || script[i-1] == 'e'))
+			if err != nil {
+				return fmt.Errorf("%s at offset %d", err, i)
+			}
+			code.WriteString(" '' ")
+			i += end
+		case rest[0] == '$':
+			tag := dollarQuote.FindString(rest)
+			if tag == "" {
+				code.WriteByte('$')
+				i++
+				continue
+			}
+			end := strings.Index(rest[len(tag):], tag)
+			if end < 0 {
+				return fmt.Errorf("%s at offset %d is never closed", tag, i)
+			}
+			// the body of a do block or function is sql too
+			if err := checkSQL(rest[len(tag) : len(tag)+end]); err != nil {
+				return fmt.Errorf("in %s at offset %d: %w", tag, i, err)
+			}
+			code.WriteString(" '' ")
+			i += end + 2*len(tag)
+		default:
+			if rest[0] == '(' {
+				depth++
+			} else if rest[0] == ')' {
+				depth--
+				if depth < 0 {
+					return fmt.Errorf("unexpected ) at offset %d", i)
+				}
+			}
+			code.WriteByte(rest[0])
+			i++
+		}
+	}
+
+	if depth != 0 {
+		return fmt.Errorf("%d parentheses are never closed", depth)
+	}
+
+	text := code.String()
+	for _, loc := range onConflictClause.FindAllStringIndex(text, -1) {
+		if !onConflict.MatchString(text[loc[1]:]) {
+			return fmt.Errorf("on conflict at offset %d must be followed by (column), on constraint or do", loc[0])
+		}
+	}
+
+	return nil
+}
+
+// closingQuote returns the length of the quoted string or identifier at the start of s.
+// A doubled quote is part of it, as is a backslash escape in an E” string.
+func closingQuote(s string, escapes bool) (int, error) {
+	quote := s[0]
+
+	for i := 1; i < len(s); i++ {
+		switch {
+		case escapes && s[i] == '\\':
+			i++
+		case s[i] == quote && i+1 < len(s) && s[i+1] == quote:
+			i++
+		case s[i] == quote:
+			return i + 1, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%c is never closed", quote)
+}
@@ -0,0 +1,116 @@
+package pages
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/patrickoliveros/bookings/api"
+	"github.com/patrickoliveros/bookings/internal/forms"
+	"github.com/patrickoliveros/bookings/internal/logging"
+	"github.com/patrickoliveros/bookings/internal/renders"
+	"github.com/patrickoliveros/bookings/models"
+)
+
+// newAPIKeyKey holds a new API key until the owner has seen it once
+const newAPIKeyKey = "new_api_key"
+
+//region admin api keys
+
+// AdminAPIKeys lists the API keys, and the key just created right after it was
+func (m *Repository) AdminAPIKeys(w http.ResponseWriter, r *http.Request) {
+	m.renderAPIKeys(w, r, forms.New(nil), models.APIKey{})
+}
+
+// AdminPostAPIKeys creates an API key with the chosen scopes
+func (m *Repository) AdminPostAPIKeys(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name")
+
+	key := models.APIKey{
+		Name:      strings.TrimSpace(form.Get("name")),
+		Scopes:    r.PostForm["scopes"],
+		CreatedBy: m.App.Session.GetInt(r.Context(), "user_id"),
+	}
+
+	if len(key.Scopes) == 0 {
+		form.Errors.Add("scopes", "Choose at least one scope")
+	}
+	for _, scope := range key.Scopes {
+		if !models.IsScope(scope) {
+			form.Errors.Add("scopes", "Choose from the scopes listed")
+			break
+		}
+	}
+
+	if !form.Valid() {
+		m.renderAPIKeys(w, r, form, key)
+		return
+	}
+
+	secret, prefix, hash := api.NewKey()
+	key.Prefix = prefix
+	key.KeyHash = hash
+
+	if _, err := m.DB.InsertAPIKey(r.Context(), key); err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), newAPIKeyKey, secret)
+	m.AddFlashMessage(r, "API key created")
+	http.Redirect(w, r, "/admin/api-keys", http.StatusSeeOther)
+}
+
+// AdminPostRevokeAPIKey stops an API key from working
+func (m *Repository) AdminPostRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		logging.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	err = m.DB.RevokeAPIKey(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		logging.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	m.AddFlashMessage(r, "API key revoked")
+	http.Redirect(w, r, "/admin/api-keys", http.StatusSeeOther)
+}
+
+func (m *Repository) renderAPIKeys(w http.ResponseWriter, r *http.Request, form *forms.Form, key models.APIKey) {
+	keys, err := m.DB.GetAPIKeys(r.Context())
+	if err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["keys"] = keys
+	data["key"] = key
+	data["scopes"] = models.APIScopes
+
+	renders.RenderPageWithTemplate(w, r, "api-keys", &models.TemplateData{
+		PageTitle: "API Keys",
+		Form:      form,
+		Data:      data,
+		StringMap: map[string]string{
+			newAPIKeyKey: m.App.Session.PopString(r.Context(), newAPIKeyKey),
+		},
+	})
+}
+
+//endregion
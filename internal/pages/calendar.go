@@ -0,0 +1,92 @@
+package pages
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/patrickoliveros/bookings/internal/ical"
+	"github.com/patrickoliveros/bookings/internal/logging"
+)
+
+// calendarFeedHistory is how far back a calendar feed goes; everything ahead is in it
+const calendarFeedHistory = 30 * 24 * time.Hour
+
+//region calendar feeds
+
+// RoomCalendarFeed serves the read-only iCalendar feed of the room with the token in the url.
+// Anyone with the address can read it, so it only tells when the room is taken.
+func (m *Repository) RoomCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	room, err := m.DB.GetRoomByCalendarToken(r.Context(), chi.URLParam(r, "token"))
+	if errors.Is(err, sql.ErrNoRows) {
+		logging.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	restrictions, err := m.DB.GetCalendarForRoom(r.Context(), room.ID, today().Add(-calendarFeedHistory))
+	if err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", ical.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s.ics"`, room.Slug))
+	w.Header().Set("Cache-Control", "no-cache")
+
+	_, _ = ical.RoomFeed(room, restrictions, m.App.SiteURL).WriteTo(w)
+}
+
+// AdminPostRoomCalendarFeed gives the room's calendar feed a new address, or turns the
+// feed off when disable=1 is posted. Whoever had the old address loses access.
+func (m *Repository) AdminPostRoomCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	room, ok := m.roomFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	token := ""
+	if r.Form.Get("disable") != "1" {
+		token = newCalendarToken()
+	}
+
+	if err := m.DB.SetRoomCalendarToken(r.Context(), room.ID, token); err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	if token == "" {
+		m.AddFlashMessage(r, fmt.Sprintf("the calendar feed of %s was turned off", room.RoomName))
+	} else {
+		m.AddFlashMessage(r, fmt.Sprintf("%s has a new calendar feed address", room.RoomName))
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/admin/rooms/%d", room.ID), http.StatusSeeOther)
+}
+
+// calendarFeedURL is the address of the calendar feed with the token
+func (m *Repository) calendarFeedURL(token string) string {
+	return fmt.Sprintf("%s/calendars/%s.ics", m.App.SiteURL, token)
+}
+
+// newCalendarToken returns a random token for the address of a calendar feed
+func newCalendarToken() string {
+	b := make([]byte, 24)
+	_, _ = rand.Read(b)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+//endregion
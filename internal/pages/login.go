@@ -0,0 +1,162 @@
+package pages
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/patrickoliveros/bookings/internal/lockout"
+	"github.com/patrickoliveros/bookings/internal/logging"
+	"github.com/patrickoliveros/bookings/internal/renders"
+	"github.com/patrickoliveros/bookings/models"
+)
+
+// loginAttemptsShown is how many attempts the audit page lists
+const loginAttemptsShown = 200
+
+// errLoginThrottled is shown instead of the usual message while an account or address has to wait
+const errLoginThrottled = "too many failed login attempts, please try again later"
+
+//region login throttling
+
+// loginThrottled reports whether a login has to be refused without checking the password,
+// because the account is locked or the address has failed too often recently
+func (m *Repository) loginThrottled(ctx context.Context, ip string, user models.User, now time.Time) (bool, error) {
+	if user.ID != 0 && user.IsLocked(now) {
+		return true, nil
+	}
+
+	failures, latest, err := m.DB.GetFailedLoginsByIP(ctx, ip, now.Add(-lockout.Window))
+	if err != nil {
+		return false, err
+	}
+
+	return now.Before(latest.Add(lockout.Address.Delay(failures))), nil
+}
+
+// recordFailedLogin audits a failed login and locks the account once it has failed too often
+func (m *Repository) recordFailedLogin(ctx context.Context, email, ip string, user models.User, now time.Time) error {
+	err := m.DB.RecordLoginAttempt(ctx, models.LoginAttempt{
+		Email:     email,
+		UserID:    user.ID,
+		IPAddress: ip,
+	})
+	if err != nil || user.ID == 0 {
+		return err
+	}
+
+	failures, err := m.DB.IncrementFailedLogins(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	if delay := lockout.Account.Delay(failures); delay > 0 {
+		return m.DB.LockUser(ctx, user.ID, now.Add(delay))
+	}
+
+	return nil
+}
+
+// recordLogin audits a successful login and clears the user's failed logins
+func (m *Repository) recordLogin(ctx context.Context, ip string, user models.User) error {
+	err := m.DB.RecordLoginAttempt(ctx, models.LoginAttempt{
+		Email:     user.Email,
+		UserID:    user.ID,
+		IPAddress: ip,
+		Succeeded: true,
+	})
+	if err != nil || user.FailedLogins == 0 {
+		return err
+	}
+
+	return m.DB.UnlockUser(ctx, user.ID)
+}
+
+// logIn starts the user's session and records where it was started from
+func (m *Repository) logIn(r *http.Request, id int, displayName string) error {
+	_ = m.App.Session.RenewToken(r.Context())
+
+	if err := m.startUserSession(r, id); err != nil {
+		return err
+	}
+
+	m.App.Session.Put(r.Context(), "user_id", id)
+	m.App.Session.Put(r.Context(), "user_displayname", displayName)
+	m.App.Session.Put(r.Context(), "logged_in_at", time.Now())
+	m.App.Session.Put(r.Context(), "flash", "Logged in successfully")
+
+	return nil
+}
+
+// loginUser looks up the account being logged in to; an unknown email gives an empty user
+func (m *Repository) loginUser(ctx context.Context, email string) (models.User, error) {
+	user, err := m.DB.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.User{}, nil
+	}
+
+	return user, err
+}
+
+//endregion
+
+//region admin login attempts
+
+// AdminLoginAttempts lists the most recent logins and the accounts that are locked
+func (m *Repository) AdminLoginAttempts(w http.ResponseWriter, r *http.Request) {
+	attempts, err := m.DB.GetLoginAttempts(r.Context(), loginAttemptsShown)
+	if err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	users, err := m.DB.GetAllUsers(r.Context())
+	if err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	now := time.Now()
+
+	var locked []models.User
+	for _, user := range users {
+		if user.IsLocked(now) {
+			locked = append(locked, user)
+		}
+	}
+
+	data := make(map[string]interface{})
+	data["attempts"] = attempts
+	data["locked"] = locked
+
+	renders.RenderPageWithTemplate(w, r, "login-attempts", &models.TemplateData{
+		PageTitle: "Login Attempts",
+		Data:      data,
+	})
+}
+
+// AdminPostUnlockUser clears a user's lock and failed logins so they can try again straight away
+func (m *Repository) AdminPostUnlockUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.userFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	if err := m.DB.UnlockUser(r.Context(), user.ID); err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	redirect := fmt.Sprintf("/admin/users/%d", user.ID)
+	if r.URL.Query().Get("from") == "attempts" {
+		redirect = "/admin/login-attempts"
+	}
+
+	m.AddFlashMessage(r, fmt.Sprintf("%s unlocked", user.FirstName))
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+}
+
+//endregion
@@ -0,0 +1,300 @@
+package pages
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/patrickoliveros/bookings/internal/forms"
+	"github.com/patrickoliveros/bookings/internal/helpers"
+	"github.com/patrickoliveros/bookings/internal/logging"
+	"github.com/patrickoliveros/bookings/internal/mailer"
+	"github.com/patrickoliveros/bookings/internal/renders"
+	"github.com/patrickoliveros/bookings/internal/repository"
+	"github.com/patrickoliveros/bookings/models"
+)
+
+// manageSessionKey holds the id of the reservation a guest has looked up
+const manageSessionKey = "manage_reservation_id"
+
+//region manage booking
+
+// ManageBookingPage asks the guest for their booking reference and email
+func (m *Repository) ManageBookingPage(w http.ResponseWriter, r *http.Request) {
+	renders.RenderPageWithTemplate(w, r, "manage-booking", &models.TemplateData{
+		PageTitle: "Manage Your Booking",
+		Form:      forms.New(nil),
+	})
+}
+
+// PostManageBookingPage looks up a booking by reference and email. Both must match,
+// and the same message is shown whichever of them is wrong.
+func (m *Repository) PostManageBookingPage(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("reference", "email")
+	form.IsEmail("email")
+
+	reference := strings.ToUpper(strings.TrimSpace(form.Get("reference")))
+	email := strings.TrimSpace(form.Get("email"))
+
+	var res models.Reservation
+	if form.Valid() {
+		var err error
+
+		res, err = m.DB.GetReservationByReference(r.Context(), reference, email)
+		if errors.Is(err, sql.ErrNoRows) {
+			form.Errors.Add("reference", "We couldn't find a booking with that reference and email")
+		} else if err != nil {
+			logging.ServerError(w, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		renders.RenderPageWithTemplate(w, r, "manage-booking", &models.TemplateData{
+			PageTitle: "Manage Your Booking",
+			Form:      form,
+		})
+		return
+	}
+
+	_ = m.App.Session.RenewToken(r.Context())
+	m.App.Session.Put(r.Context(), manageSessionKey, res.ID)
+
+	http.Redirect(w, r, "/manage-booking/booking", http.StatusSeeOther)
+}
+
+// ManagedBookingPage shows the booking the guest looked up
+func (m *Repository) ManagedBookingPage(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.managedReservation(w, r)
+	if !ok {
+		return
+	}
+
+	m.renderManagedBooking(w, r, res, forms.New(nil))
+}
+
+// PostManageContact updates the guest's email and phone
+func (m *Repository) PostManageContact(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.managedReservation(w, r)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("email", "phone")
+	form.IsEmail("email")
+
+	previousEmail := res.Email
+	res.Email = strings.TrimSpace(form.Get("email"))
+	res.Phone = strings.TrimSpace(form.Get("phone"))
+
+	if !form.Valid() {
+		m.renderManagedBooking(w, r, res, form)
+		return
+	}
+
+	notice, err := mailer.Compose(mailer.FrontDeskNotice(res, m.App.FrontDesk, "Contact details changed",
+		fmt.Sprintf("The guest changed their contact details to %s, %s (was %s).", res.Email, res.Phone, previousEmail)))
+	if err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	if err = m.DB.UpdateReservation(r.Context(), res, notice); err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	mailer.Notify()
+
+	m.AddFlashMessage(r, "your contact details were updated")
+	http.Redirect(w, r, "/manage-booking/booking", http.StatusSeeOther)
+}
+
+// PostManageDates moves the booking to new dates if the room is free for them.
+// The stay is priced again at the current rates.
+func (m *Repository) PostManageDates(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.managedReservation(w, r)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	if !canChangeDates(res) {
+		m.AddSessionError(r, "the dates of this booking can no longer be changed online")
+		http.Redirect(w, r, "/manage-booking/booking", http.StatusSeeOther)
+		return
+	}
+
+	start, errStart := time.Parse("2006-01-02", r.Form.Get("start_date"))
+	end, errEnd := time.Parse("2006-01-02", r.Form.Get("end_date"))
+	if errStart != nil || errEnd != nil || !end.After(start) || start.Before(today()) {
+		m.AddSessionError(r, "please choose an arrival from today and a departure after it")
+		http.Redirect(w, r, "/manage-booking/booking", http.StatusSeeOther)
+		return
+	}
+
+	room, err := m.DB.GetRoomByID(r.Context(), res.RoomID)
+	if err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	previousStart, previousEnd := res.StartDate, res.EndDate
+	res.StartDate = start
+	res.EndDate = end
+
+	res.Quote, err = m.quoteStay(r.Context(), room, start, end)
+	if err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	// the emails are queued with the change, so they are sent if and only if it is made.
+	// the guest's invite carries the sequence the reservation will have after it.
+	changed := res
+	changed.Sequence++
+	changed.UpdatedAt = time.Now()
+
+	var outbox []models.OutboxMessage
+	for _, message := range []models.MailData{
+		mailer.ReservationChanged(changed, m.App.FrontDesk),
+		mailer.FrontDeskNotice(res, m.App.FrontDesk, "Dates changed",
+			fmt.Sprintf("The guest moved their stay from %s - %s to %s - %s. The new total is %s %s.",
+				previousStart.Format("2006-01-02"), previousEnd.Format("2006-01-02"),
+				start.Format("2006-01-02"), end.Format("2006-01-02"),
+				res.Quote.Currency, helpers.Amount(res.Quote.Total))),
+	} {
+		msg, err := mailer.Compose(message)
+		if err != nil {
+			logging.ServerError(w, err)
+			return
+		}
+		outbox = append(outbox, msg)
+	}
+
+	err = m.DB.ChangeBookingDates(r.Context(), res, outbox...)
+
+	var conflict *repository.BookingConflictError
+	var closed *repository.BookingClosedError
+	if errors.As(err, &conflict) {
+		m.AddSessionError(r, "Sorry, the room is not available for those dates.")
+		http.Redirect(w, r, "/manage-booking/booking", http.StatusSeeOther)
+		return
+	} else if errors.As(err, &closed) {
+		m.AddSessionError(r, "the dates of this booking can no longer be changed online")
+		http.Redirect(w, r, "/manage-booking/booking", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	mailer.Notify()
+
+	m.AddFlashMessage(r, "your booking was moved to the new dates")
+	http.Redirect(w, r, "/manage-booking/booking", http.StatusSeeOther)
+}
+
+// PostManageCancel records the guest's cancellation request for the front desk
+func (m *Repository) PostManageCancel(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.managedReservation(w, r)
+	if !ok {
+		return
+	}
+
+	if !res.CancellationRequestedAt.IsZero() || !res.IsActive() {
+		http.Redirect(w, r, "/manage-booking/booking", http.StatusSeeOther)
+		return
+	}
+
+	notice, err := mailer.Compose(mailer.FrontDeskNotice(res, m.App.FrontDesk,
+		"Cancellation requested", "The guest asked to cancel this booking."))
+	if err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	if err = m.DB.RequestCancellation(r.Context(), res.ID, notice); err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	mailer.Notify()
+
+	m.AddFlashMessage(r, "your cancellation request was sent to the front desk")
+	http.Redirect(w, r, "/manage-booking/booking", http.StatusSeeOther)
+}
+
+// managedReservation loads the reservation the guest looked up, sending them back to
+// the lookup page if there is none
+func (m *Repository) managedReservation(w http.ResponseWriter, r *http.Request) (models.Reservation, bool) {
+	id := m.App.Session.GetInt(r.Context(), manageSessionKey)
+	if id == 0 {
+		http.Redirect(w, r, "/manage-booking", http.StatusSeeOther)
+		return models.Reservation{}, false
+	}
+
+	res, err := m.DB.GetReservationById(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		m.App.Session.Remove(r.Context(), manageSessionKey)
+		m.AddSessionError(r, "we couldn't find your booking")
+		http.Redirect(w, r, "/manage-booking", http.StatusSeeOther)
+		return res, false
+	} else if err != nil {
+		logging.ServerError(w, err)
+		return res, false
+	}
+
+	return res, true
+}
+
+func (m *Repository) renderManagedBooking(w http.ResponseWriter, r *http.Request, res models.Reservation, form *forms.Form) {
+	data := make(map[string]interface{})
+	data["reservation"] = res
+
+	intMap := make(map[string]int)
+	if canChangeDates(res) {
+		intMap["can_change_dates"] = 1
+	}
+
+	renders.RenderPageWithTemplate(w, r, "manage-booking-show", &models.TemplateData{
+		PageTitle: fmt.Sprintf("Booking #%s", res.Reference),
+		Form:      form,
+		Data:      data,
+		IntMap:    intMap,
+	})
+}
+
+// canChangeDates reports whether the guest may still move the booking online.
+// Stays that have started, or that were cancelled or asked to be, go through the desk.
+func canChangeDates(res models.Reservation) bool {
+	upcoming := res.Status == models.StatusPending || res.Status == models.StatusConfirmed
+
+	return upcoming && res.CancellationRequestedAt.IsZero() && !res.StartDate.Before(today())
+}
+
+func today() time.Time {
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+//endregion
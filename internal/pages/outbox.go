@@ -0,0 +1,80 @@
+package pages
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/patrickoliveros/bookings/internal/logging"
+	"github.com/patrickoliveros/bookings/internal/mailer"
+	"github.com/patrickoliveros/bookings/internal/renders"
+	"github.com/patrickoliveros/bookings/models"
+)
+
+// outboxPageSize is how many messages the outbox page shows
+const outboxPageSize = 100
+
+//region admin mail outbox
+
+// AdminMailOutbox lists the latest outgoing emails, optionally of one status
+func (m *Repository) AdminMailOutbox(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if !models.IsOutboxStatus(status) {
+		status = ""
+	}
+
+	messages, err := m.DB.GetOutboxMessages(r.Context(), status, outboxPageSize)
+	if err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["messages"] = messages
+	data["statuses"] = models.OutboxStatuses
+
+	renders.RenderPageWithTemplate(w, r, "mail-outbox", &models.TemplateData{
+		PageTitle: "Mail Outbox",
+		StringMap: map[string]string{"status": status},
+		IntMap:    map[string]int{"max_attempts": mailer.MaxAttempts},
+		Data:      data,
+	})
+}
+
+// AdminPostRetryMail sends a pending or dead email again right away, with a fresh set of attempts
+func (m *Repository) AdminPostRetryMail(w http.ResponseWriter, r *http.Request) {
+	m.updateOutboxMessage(w, r, m.DB.RetryOutboxMessage, "The email will be sent again")
+	mailer.Notify()
+}
+
+// AdminPostDiscardMail gives up on a pending or dead email
+func (m *Repository) AdminPostDiscardMail(w http.ResponseWriter, r *http.Request) {
+	m.updateOutboxMessage(w, r, m.DB.DiscardOutboxMessage, "The email was discarded")
+}
+
+func (m *Repository) updateOutboxMessage(w http.ResponseWriter, r *http.Request,
+	update func(ctx context.Context, id int) error, flash string) {
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		logging.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	err = update(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		m.AddSessionError(r, "That email was already sent or discarded")
+	} else if err != nil {
+		logging.ServerError(w, err)
+		return
+	} else {
+		m.AddFlashMessage(r, flash)
+	}
+
+	http.Redirect(w, r, "/admin/mail-outbox?status="+r.URL.Query().Get("status"), http.StatusSeeOther)
+}
+
+//endregion
@@ -1,7 +1,9 @@
 package pages
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -15,6 +17,9 @@ import (
 	"github.com/patrickoliveros/bookings/internal/forms"
 	"github.com/patrickoliveros/bookings/internal/helpers"
 	"github.com/patrickoliveros/bookings/internal/logging"
+	"github.com/patrickoliveros/bookings/internal/mailer"
+	"github.com/patrickoliveros/bookings/internal/pricing"
+	"github.com/patrickoliveros/bookings/internal/ratelimit"
 	"github.com/patrickoliveros/bookings/internal/renders"
 	"github.com/patrickoliveros/bookings/internal/repository"
 	"github.com/patrickoliveros/bookings/internal/repository/dbrepo"
@@ -30,6 +35,9 @@ var Repo *Repository
 type Repository struct {
 	App *config.AppConfig
 	DB  repository.DatabaseRepo
+
+	resetsByAddress *ratelimit.Limiter
+	resetsByAccount *ratelimit.Limiter
 }
 
 func (r *Repository) AddSessionError(req *http.Request, message string) {
@@ -43,17 +51,28 @@ func (r *Repository) AddFlashMessage(req *http.Request, message string) {
 // NewRepo creates a new repository
 func NewRepo(a *config.AppConfig, db *driver.DB) *Repository {
 	return &Repository{
-		App: a,
-		DB:  dbrepo.NewPostGresRepo(db.SQL, a),
+		App:             a,
+		DB:              dbrepo.NewPostGresRepo(db.SQL, a),
+		resetsByAddress: ratelimit.New(resetsPerAddress),
+		resetsByAccount: ratelimit.New(resetsPerAccount),
 	}
 }
 
-func NewTestRepo(a *config.AppConfig) *Repository {
+// NewMemoryRepo creates a repository backed by the in-memory database
+func NewMemoryRepo(a *config.AppConfig) *Repository {
 	return &Repository{
-		App: a,
+		App:             a,
+		DB:              dbrepo.NewMemoryRepo(a),
+		resetsByAddress: ratelimit.New(resetsPerAddress),
+		resetsByAccount: ratelimit.New(resetsPerAccount),
 	}
 }
 
+// NewTestRepo creates a repository for tests, which never needs a live database
+func NewTestRepo(a *config.AppConfig) *Repository {
+	return NewMemoryRepo(a)
+}
+
 // NewHandlers sets the repository for the handlers
 func NewPageHandlers(r *Repository) {
 	Repo = r
@@ -132,25 +151,64 @@ func (m *Repository) PostLoginPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	email := r.Form.Get("email")
+	email := strings.TrimSpace(r.Form.Get("email"))
 	password := r.Form.Get("password")
+	ip := helpers.ClientIP(r)
+	now := time.Now()
+
+	user, err := m.loginUser(r.Context(), email)
+	if err != nil {
+		logging.ServerError(w, err)
+		return
+	}
 
-	id, displayName, _, err := m.DB.Authenticate(email, password)
+	throttled, err := m.loginThrottled(r.Context(), ip, user, now)
+	if err != nil {
+		logging.ServerError(w, err)
+		return
+	} else if throttled {
+		m.AddSessionError(r, errLoginThrottled)
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	id, displayName, _, err := m.DB.Authenticate(r.Context(), email, password)
 	if err != nil {
 		log.Println(err)
+		if err := m.recordFailedLogin(r.Context(), email, ip, user, now); err != nil {
+			logging.ServerError(w, err)
+			return
+		}
 		m.AddSessionError(r, "Invalid login credentials")
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
 	}
 
-	m.App.Session.Put(r.Context(), "user_id", id)
-	m.App.Session.Put(r.Context(), "user_displayname", displayName)
-	m.App.Session.Put(r.Context(), "flash", "Logged in successfully")
+	if user.HasTwoFactor() {
+		m.beginTwoFactorLogin(r, user)
+		http.Redirect(w, r, "/login/two-factor", http.StatusSeeOther)
+		return
+	}
+
+	if err := m.recordLogin(r.Context(), ip, user); err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	if err := m.logIn(r, id, displayName); err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
 func (m *Repository) LogoutPage(w http.ResponseWriter, r *http.Request) {
 
+	if err := m.endUserSession(r); err != nil {
+		log.Println(err)
+	}
+
 	_ = m.App.Session.Destroy(r.Context())
 	_ = m.App.Session.RenewToken(r.Context())
 
@@ -158,19 +216,16 @@ func (m *Repository) LogoutPage(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
-//endregion
+// Forbidden tells a logged in user that their role cannot open the page they asked for
+func (m *Repository) Forbidden(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusForbidden)
 
-func (m *Repository) RoomsGeneral(w http.ResponseWriter, r *http.Request) {
-	renders.RenderPageWithTemplate(w, r, "generals-quarters", &models.TemplateData{
-		PageTitle: "General's Quarters",
+	renders.RenderPageWithTemplate(w, r, "forbidden", &models.TemplateData{
+		PageTitle: "Access Denied",
 	})
 }
 
-func (m *Repository) RoomsMajor(w http.ResponseWriter, r *http.Request) {
-	renders.RenderPageWithTemplate(w, r, "majors-suite", &models.TemplateData{
-		PageTitle: "Major's Suite",
-	})
-}
+//endregion
 
 func (m *Repository) ReservationsPage(w http.ResponseWriter, r *http.Request) {
 	pageTemplate := "reservations"
@@ -206,7 +261,7 @@ func (m *Repository) PostReservationsPage(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	rooms, err := m.DB.SearchAvailabilityByDates(startDate, endDate)
+	rooms, err := m.DB.SearchAvailabilityByDates(r.Context(), startDate, endDate)
 	if err != nil {
 		m.AddSessionError(r, "can't get availability for rooms")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
@@ -253,12 +308,19 @@ func (m *Repository) AvailabilityReservationsPage(w http.ResponseWriter, r *http
 	sd := r.Form.Get("start")
 	ed := r.Form.Get("end")
 
-	startDate, _, _ := helpers.HandleDate(sd)
-	endDate, _, _ := helpers.HandleDate(ed)
+	startDate, _, errStart := helpers.HandleDate(sd)
+	endDate, _, errEnd := helpers.HandleDate(ed)
+	if errStart != nil || errEnd != nil {
+		outputJson(w, models.JsonReservationResponse{
+			OK:      false,
+			Message: "Invalid dates",
+		})
+		return
+	}
 
 	roomID, _ := strconv.Atoi(r.Form.Get("room_id"))
 
-	available, err := m.DB.SearchAvailabilityByDatesByRoom(startDate, endDate, roomID)
+	available, err := m.DB.SearchAvailabilityByDatesByRoom(r.Context(), startDate, endDate, roomID)
 	if err != nil {
 		// got a database error, so return appropriate json
 		resp := models.JsonReservationResponse{
@@ -289,7 +351,7 @@ func (m *Repository) MakeReservationPage(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	room, err := m.DB.GetRoomByID(res.RoomID)
+	room, err := m.DB.GetRoomByID(r.Context(), res.RoomID)
 	if err != nil {
 		m.AddSessionError(r, "can't find room!")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
@@ -325,36 +387,33 @@ func (m *Repository) PostMakeReservationPage(w http.ResponseWriter, r *http.Requ
 
 	if err != nil {
 		logging.ServerError(w, err)
+		return
 	}
 
-	sd := r.Form.Get("start_date")
-	ed := r.Form.Get("end_date")
+	form := forms.New(r.PostForm)
 
-	startDate, _, err := helpers.HandleDate(sd)
-	if err != nil {
-		log.Fatal("Cannot parse start date")
+	if !form.DateRange("start_date", "end_date") {
+		m.AddSessionError(r, "please choose an arrival and a departure after it")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
 	}
 
-	endDate, _, err := helpers.HandleDate(ed)
+	startDate, _ := time.Parse(forms.DateLayout, form.Get("start_date"))
+	endDate, _ := time.Parse(forms.DateLayout, form.Get("end_date"))
+
+	roomID, err := strconv.Atoi(r.Form.Get("room_id"))
 	if err != nil {
-		log.Fatal("Cannot parse end date")
+		m.AddSessionError(r, "invalid data!")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
 	}
 
-	roomID := 1
-	// todo: fix this one
-	// roomIDx, err := strconv.Atoi(r.Form.Get("room_id"))
-	// if err != nil {
-	// 	m.AddSessionError(r, "invalid data!")
-	// 	http.Redirect(w, r, "/", http.StatusSeeOther)
-	// 	return
-	// }
-
-	// room, err := m.DB.GetRoomByID(roomIDx)
-	// if err != nil {
-	// 	m.AddSessionError(r, "invalid data!")
-	// 	http.Redirect(w, r, "/", http.StatusSeeOther)
-	// 	return
-	// }
+	room, err := m.DB.GetRoomByID(r.Context(), roomID)
+	if err != nil || room.IsArchived() {
+		m.AddSessionError(r, "invalid data!")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
 
 	reservation := models.Reservation{
 		FirstName:        r.Form.Get("first_name"),
@@ -367,13 +426,7 @@ func (m *Repository) PostMakeReservationPage(w http.ResponseWriter, r *http.Requ
 		RoomID:           roomID,
 	}
 
-	form := forms.New(r.PostForm)
-	form.Required("first_name", "last_name", "email", "phone")
-	form.MinLength("first_name", 5)
-	form.MinLength("last_name", 5)
-	form.IsEmail("email")
-
-	if !form.Valid() {
+	if !form.GuestDetails() {
 		data := make(map[string]interface{})
 		data["reservation"] = reservation
 
@@ -386,36 +439,40 @@ func (m *Repository) PostMakeReservationPage(w http.ResponseWriter, r *http.Requ
 
 	reservation.Reference = helpers.GenerateGuid()
 
-	newReservationID, err := m.DB.InsertReservation(reservation)
-	if err != nil {
+	// the price is fixed when the guest books, later rate changes don't affect it
+	reservation.Quote, err = m.quoteStay(r.Context(), room, startDate, endDate)
+	if errors.Is(err, pricing.ErrNoNights) {
+		m.AddSessionError(r, "departure must be after arrival")
+		http.Redirect(w, r, "/reservations", http.StatusSeeOther)
+		return
+	} else if err != nil {
 		logging.ServerError(w, err)
 		return
 	}
 
-	restriction := models.RoomRestriction{
-		StartDate:     startDate,
-		EndDate:       endDate,
-		RoomID:        roomID,
-		ReservationID: newReservationID,
-		RestrictionID: 1,
-	}
+	// the confirmation is queued with the booking, so it is sent if and only if the booking is made
+	reservation.Room = room
 
-	err = m.DB.InsertRoomRestriction(restriction)
+	confirmation, err := mailer.Compose(mailer.ReservationConfirmation(reservation, m.App.FrontDesk))
 	if err != nil {
-		log.Println(err)
+		logging.ServerError(w, err)
 		return
 	}
 
-	// send notification to guest
-	msg := models.MailData{
-		To:   reservation.Email,
-		From: "there@domain.com",
-		Subject: fmt.Sprintf("Reservation Confirmation #%s - %s, %s",
-			reservation.Reference, reservation.LastName, reservation.FirstName),
-		Content: "hello! <strong>world</strong>!",
+	reservation.ID, err = m.DB.CreateBooking(r.Context(), reservation, confirmation)
+
+	var conflict *repository.BookingConflictError
+	if errors.As(err, &conflict) {
+		// someone else booked the room since availability was checked
+		m.AddSessionError(r, "Sorry, that room was just taken for those dates. Please search again.")
+		http.Redirect(w, r, "/reservations", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		logging.ServerError(w, err)
+		return
 	}
 
-	m.App.MailChannel <- msg
+	mailer.Notify()
 
 	m.App.Session.Put(r.Context(), "reservation", reservation)
 
@@ -472,12 +529,17 @@ func (m *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
 	sd := r.URL.Query().Get("s")
 	ed := r.URL.Query().Get("e")
 
-	startDate, _, _ := helpers.HandleDate(sd)
-	endDate, _, _ := helpers.HandleDate(ed)
+	startDate, _, errStart := helpers.HandleDate(sd)
+	endDate, _, errEnd := helpers.HandleDate(ed)
+	if errStart != nil || errEnd != nil {
+		m.AddSessionError(r, "can't parse the dates!")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
 
 	var res models.Reservation
 
-	room, err := m.DB.GetRoomByID(roomID)
+	room, err := m.DB.GetRoomByID(r.Context(), roomID)
 	if err != nil {
 		m.AddSessionError(r, "Can't get room from db!")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
@@ -524,7 +586,7 @@ func (m *Repository) AdminDashBoard(w http.ResponseWriter, r *http.Request) {
 
 func (m *Repository) AdminReservationsNew(w http.ResponseWriter, r *http.Request) {
 
-	reservations, err := m.DB.GetAllReservations(true)
+	reservations, err := m.DB.GetAllReservations(r.Context(), models.StatusPending)
 	if err != nil {
 		logging.ServerError(w, err)
 		return
@@ -540,9 +602,15 @@ func (m *Repository) AdminReservationsNew(w http.ResponseWriter, r *http.Request
 	})
 }
 
+// AdminReservationsAll lists every reservation, or only those in the status given by ?status=
 func (m *Repository) AdminReservationsAll(w http.ResponseWriter, r *http.Request) {
 
-	reservations, err := m.DB.GetAllReservations(false)
+	status := r.URL.Query().Get("status")
+	if !models.IsReservationStatus(status) {
+		status = ""
+	}
+
+	reservations, err := m.DB.GetAllReservations(r.Context(), status)
 	if err != nil {
 		logging.ServerError(w, err)
 		return
@@ -550,10 +618,12 @@ func (m *Repository) AdminReservationsAll(w http.ResponseWriter, r *http.Request
 
 	data := make(map[string]interface{})
 	data["reservations"] = reservations
+	data["statuses"] = models.ReservationStatuses
 
 	pageTitle := "reservations"
 	renders.RenderPageWithTemplate(w, r, "reservations-all", &models.TemplateData{
 		PageTitle: helpers.SanitizeString(pageTitle),
+		StringMap: map[string]string{"status": status},
 		Data:      data,
 	})
 }
@@ -573,7 +643,13 @@ func (m *Repository) AdminReservationsById(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	reservations, err := m.DB.GetReservationById(reservationId)
+	reservations, err := m.DB.GetReservationById(r.Context(), reservationId)
+	if err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	history, err := m.DB.GetReservationHistory(r.Context(), reservationId)
 	if err != nil {
 		logging.ServerError(w, err)
 		return
@@ -581,6 +657,7 @@ func (m *Repository) AdminReservationsById(w http.ResponseWriter, r *http.Reques
 
 	data := make(map[string]interface{})
 	data["reservations"] = reservations
+	data["history"] = history
 
 	page := "reservations-show"
 	pageTitle := fmt.Sprintf("Reservation #%s", reservations.Reference)
@@ -622,7 +699,7 @@ func (m *Repository) AdminPostReservationsById(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	reservations, err := m.DB.GetReservationById(reservationId)
+	reservations, err := m.DB.GetReservationById(r.Context(), reservationId)
 	if err != nil {
 		logging.ServerError(w, err)
 		return
@@ -634,7 +711,13 @@ func (m *Repository) AdminPostReservationsById(w http.ResponseWriter, r *http.Re
 	reservations.Email = r.Form.Get("email")
 	reservations.Phone = r.Form.Get("phone")
 
-	err = m.DB.UpdateReservation(reservations)
+	err = m.DB.UpdateReservation(r.Context(), reservations)
+	if err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	history, err := m.DB.GetReservationHistory(r.Context(), reservationId)
 	if err != nil {
 		logging.ServerError(w, err)
 		return
@@ -642,6 +725,7 @@ func (m *Repository) AdminPostReservationsById(w http.ResponseWriter, r *http.Re
 
 	data := make(map[string]interface{})
 	data["reservations"] = reservations
+	data["history"] = history
 
 	page := "reservations-show"
 	pageTitle := fmt.Sprintf("Reservation #%s", reservations.Reference)
@@ -684,7 +768,7 @@ func (m *Repository) AdminReservationsCalendar(w http.ResponseWriter, r *http.Re
 	intMap := make(map[string]int)
 	intMap["days_in_month"] = lastOfMonth.Day()
 
-	rooms, err := m.DB.GetAllRooms()
+	rooms, err := m.DB.GetAllRooms(r.Context())
 	if err != nil {
 		logging.ServerError(w, err)
 	}
@@ -701,7 +785,7 @@ func (m *Repository) AdminReservationsCalendar(w http.ResponseWriter, r *http.Re
 		}
 
 		// we need to get all the restrictions
-		restrictions, err := m.DB.GetRestrictionsForRoomByDate(x.ID, firstOfMonth, lastOfMonth)
+		restrictions, err := m.DB.GetRestrictionsForRoomByDate(r.Context(), x.ID, firstOfMonth, lastOfMonth)
 		if err != nil {
 			logging.ServerError(w, err)
 			return
@@ -748,7 +832,7 @@ func (m *Repository) AdminPostReservationsCalendar(w http.ResponseWriter, r *htt
 	month, _ := strconv.Atoi(r.Form.Get("m"))
 
 	// process blocks
-	rooms, err := m.DB.GetAllRooms()
+	rooms, err := m.DB.GetAllRooms(r.Context())
 	if err != nil {
 		logging.ServerError(w, err)
 	}
@@ -780,7 +864,7 @@ func (m *Repository) AdminPostReservationsCalendar(w http.ResponseWriter, r *htt
 
 		if len(idsForDeletion) > 0 {
 			// now delete the string
-			err := m.DB.DeleteBlocksForRoom(x.ID, strings.Join(idsForDeletion, ", "))
+			err := m.DB.DeleteBlocksForRoom(r.Context(), x.ID, strings.Join(idsForDeletion, ", "))
 			if err != nil {
 				logging.ServerError(w, err)
 				return
@@ -796,7 +880,7 @@ func (m *Repository) AdminPostReservationsCalendar(w http.ResponseWriter, r *htt
 			roomID, _ := strconv.Atoi(exploded[2])
 			t, _ := time.Parse("2006-01-2", exploded[3])
 			// insert a new block
-			err := m.DB.InsertBlockForRoom(roomID, t)
+			err := m.DB.InsertBlockForRoom(r.Context(), roomID, t)
 			if err != nil {
 				logging.ServerError(w, err)
 				return
@@ -808,22 +892,67 @@ func (m *Repository) AdminPostReservationsCalendar(w http.ResponseWriter, r *htt
 	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%d&m=%d", year, month), http.StatusSeeOther)
 }
 
-func (m *Repository) AdminProcessReservation(w http.ResponseWriter, r *http.Request) {
+// AdminPostReservationStatus moves a reservation to the posted status. Reservations are
+// never deleted; cancelling one frees its dates instead.
+func (m *Repository) AdminPostReservationStatus(w http.ResponseWriter, r *http.Request) {
 
-	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		logging.ClientError(w, http.StatusNotFound)
+		return
+	}
 
-	_ = m.DB.MarkProcessedReservation(id, 1)
+	if err := r.ParseForm(); err != nil {
+		logging.ServerError(w, err)
+		return
+	}
 
-	m.App.Session.Put(r.Context(), "flash", "Reservation marked as processed!")
-	http.Redirect(w, r, "/admin/reservations-all", http.StatusSeeOther)
-}
+	status := r.Form.Get("status")
+	note := strings.TrimSpace(r.Form.Get("note"))
+	userID := m.App.Session.GetInt(r.Context(), "user_id")
+
+	res, err := m.DB.GetReservationById(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		logging.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		logging.ServerError(w, err)
+		return
+	}
 
-func (m *Repository) AdminDeleteReservation(w http.ResponseWriter, r *http.Request) {
+	// the guest's email is queued with the cancellation, so it is sent if and only if it
+	// is made. The invite carries the sequence the reservation will have after it.
+	var outbox []models.OutboxMessage
+	if status == models.StatusCancelled {
+		cancelled := res
+		cancelled.Status = models.StatusCancelled
+		cancelled.Sequence++
+		cancelled.UpdatedAt = time.Now()
 
-	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+		msg, err := mailer.Compose(mailer.ReservationCancelled(cancelled, m.App.FrontDesk))
+		if err != nil {
+			logging.ServerError(w, err)
+			return
+		}
+		outbox = append(outbox, msg)
+	}
 
-	_ = m.DB.DeleteReservation(id)
+	err = m.DB.TransitionReservation(r.Context(), id, status, userID, note, outbox...)
+
+	var invalid *repository.InvalidTransitionError
+	if errors.Is(err, sql.ErrNoRows) {
+		logging.ClientError(w, http.StatusNotFound)
+		return
+	} else if errors.As(err, &invalid) {
+		m.AddSessionError(r, invalid.Error())
+	} else if err != nil {
+		logging.ServerError(w, err)
+		return
+	} else {
+		mailer.Notify()
+
+		m.AddFlashMessage(r, fmt.Sprintf("reservation marked as %s", models.StatusLabel(status)))
+	}
 
-	m.App.Session.Put(r.Context(), "flash", "Reservation deleted!")
-	http.Redirect(w, r, "/admin/reservations-all", http.StatusSeeOther)
+	http.Redirect(w, r, fmt.Sprintf("/admin/reservation/%d", id), http.StatusSeeOther)
 }
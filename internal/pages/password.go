@@ -0,0 +1,209 @@
+package pages
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/patrickoliveros/bookings/internal/forms"
+	"github.com/patrickoliveros/bookings/internal/helpers"
+	"github.com/patrickoliveros/bookings/internal/logging"
+	"github.com/patrickoliveros/bookings/internal/mailer"
+	"github.com/patrickoliveros/bookings/internal/renders"
+	"github.com/patrickoliveros/bookings/models"
+)
+
+// passwordResetTTL is how long a reset link can be used
+const passwordResetTTL = time.Hour
+
+// resetsPerAddress is how many reset links one IP address may ask for a minute, across
+// all accounts, and resetsPerAccount how many may be sent to one account
+const (
+	resetsPerAddress = 5
+	resetsPerAccount = 1
+)
+
+// errResetThrottled is shown instead of sending a link while an address has to wait
+const errResetThrottled = "too many password resets were asked for, please try again later"
+
+//region password reset
+
+// ForgotPasswordPage asks for the email of the account to reset
+func (m *Repository) ForgotPasswordPage(w http.ResponseWriter, r *http.Request) {
+	renders.RenderPageWithTemplate(w, r, "forgot-password", &models.TemplateData{
+		PageTitle: "Forgot Password",
+		Form:      forms.New(nil),
+	})
+}
+
+// PostForgotPasswordPage emails a reset link when the address belongs to an active user.
+// The same message is shown either way, so the form does not reveal who has an account;
+// it is also shown, without sending anything, when the account was sent a link moments ago.
+func (m *Repository) PostForgotPasswordPage(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("email")
+	form.IsEmail("email")
+
+	if !form.Valid() {
+		renders.RenderPageWithTemplate(w, r, "forgot-password", &models.TemplateData{
+			PageTitle: "Forgot Password",
+			Form:      form,
+		})
+		return
+	}
+
+	now := time.Now()
+	if ok, _ := m.resetsByAddress.Allow(helpers.ClientIP(r), now); !ok {
+		m.AddSessionError(r, errResetThrottled)
+		http.Redirect(w, r, "/forgot-password", http.StatusSeeOther)
+		return
+	}
+
+	email := strings.ToLower(strings.TrimSpace(form.Get("email")))
+
+	user, err := m.DB.GetUserByEmail(r.Context(), email)
+	if err == nil && user.IsActive() {
+		if ok, _ := m.resetsByAccount.Allow(email, now); ok {
+			token := newResetToken()
+
+			msg, err := mailer.Compose(m.passwordResetMail(user, token))
+			if err != nil {
+				logging.ServerError(w, err)
+				return
+			}
+
+			_, err = m.DB.InsertPasswordReset(r.Context(), models.PasswordReset{
+				UserID:    user.ID,
+				TokenHash: hashResetToken(token),
+				ExpiresAt: now.Add(passwordResetTTL),
+			}, msg)
+			if err != nil {
+				logging.ServerError(w, err)
+				return
+			}
+
+			mailer.Notify()
+		}
+	} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		logging.ServerError(w, err)
+		return
+	}
+
+	m.AddFlashMessage(r, "if that email belongs to an account, a reset link is on its way")
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+// ResetPasswordPage shows the new password form when the link can still be used
+func (m *Repository) ResetPasswordPage(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+
+	reset, err := m.DB.GetPasswordReset(r.Context(), hashResetToken(token))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		logging.ServerError(w, err)
+		return
+	}
+
+	m.renderResetPassword(w, r, token, err == nil && reset.IsUsable(time.Now()), forms.New(nil))
+}
+
+// PostResetPasswordPage sets the new password, uses up the link and ends the user's other sessions
+func (m *Repository) PostResetPasswordPage(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+
+	if err := r.ParseForm(); err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("password", "password_confirm")
+	form.IsPassword("password")
+
+	if form.Get("password") != form.Get("password_confirm") {
+		form.Errors.Add("password_confirm", "The passwords do not match")
+	}
+
+	if !form.Valid() {
+		m.renderResetPassword(w, r, token, true, form)
+		return
+	}
+
+	userID, err := m.DB.ResetPassword(r.Context(), hashResetToken(token), helpers.GenerateHashedPassword(form.Get("password")))
+	if errors.Is(err, sql.ErrNoRows) {
+		m.renderResetPassword(w, r, token, false, forms.New(nil))
+		return
+	} else if err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	if err := m.DB.RevokeUserSessions(r.Context(), userID, 0); err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	m.AddFlashMessage(r, "your password was changed, please log in")
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+func (m *Repository) renderResetPassword(w http.ResponseWriter, r *http.Request, token string, usable bool, form *forms.Form) {
+	intMap := make(map[string]int)
+	if usable {
+		intMap["usable"] = 1
+	}
+
+	renders.RenderPageWithTemplate(w, r, "reset-password", &models.TemplateData{
+		PageTitle: "Reset Password",
+		Form:      form,
+		StringMap: map[string]string{"token": token},
+		IntMap:    intMap,
+	})
+}
+
+// passwordResetMail is the email with the user's reset link
+func (m *Repository) passwordResetMail(user models.User, token string) models.MailData {
+	link := fmt.Sprintf("%s/reset-password/%s", m.App.SiteURL, token)
+
+	content := fmt.Sprintf(`<p>Hello %s,</p>
+<p>Someone asked to reset the password of your account. If it was you, choose a new password here:</p>
+<p><a href="%s">%s</a></p>
+<p>The link works once, for %d minutes. If you did not ask for it, you can ignore this email.</p>`,
+		html.EscapeString(user.FirstName), link, link, int(passwordResetTTL.Minutes()))
+
+	return models.MailData{
+		To:      user.Email,
+		From:    m.App.FrontDesk,
+		Subject: "Reset your password",
+		Content: content,
+	}
+}
+
+// newResetToken returns a random token for a reset link; only its hash is stored
+func newResetToken() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
+
+//endregion
@@ -0,0 +1,131 @@
+package pages
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/patrickoliveros/bookings/internal/logging"
+	"github.com/patrickoliveros/bookings/internal/pricing"
+	"github.com/patrickoliveros/bookings/models"
+)
+
+// quoteStay prices a stay in room with its seasonal rates and the configured fees and taxes
+func (m *Repository) quoteStay(ctx context.Context, room models.Room, start, end time.Time) (models.Quote, error) {
+	seasons, err := m.DB.GetSeasonalRatesForRoom(ctx, room.ID)
+	if err != nil {
+		return models.Quote{}, err
+	}
+
+	return pricing.Quote(room, seasons, start, end, m.App.Pricing)
+}
+
+//region admin seasonal rates
+
+// AdminPostSeasonalRate adds a seasonal rate to a room
+func (m *Repository) AdminPostSeasonalRate(w http.ResponseWriter, r *http.Request) {
+	room, ok := m.roomFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	redirect := fmt.Sprintf("/admin/rooms/%d", room.ID)
+
+	rate := models.SeasonalRate{
+		RoomID: room.ID,
+		Name:   strings.TrimSpace(r.Form.Get("name")),
+	}
+
+	var problems []string
+
+	if rate.Name == "" {
+		problems = append(problems, "name is required")
+	}
+
+	start, errStart := time.Parse("2006-01-02", r.Form.Get("start_date"))
+	end, errEnd := time.Parse("2006-01-02", r.Form.Get("end_date"))
+	if errStart != nil || errEnd != nil || end.Before(start) {
+		problems = append(problems, "dates must be valid and the season cannot end before it starts")
+	}
+	rate.StartDate = start
+	rate.EndDate = end
+
+	nightly, err := pricing.ParseAmount(r.Form.Get("nightly_rate"))
+	if err != nil {
+		problems = append(problems, "nightly rate must be an amount like 129.00")
+	}
+	rate.NightlyRate = nightly
+
+	if strings.TrimSpace(r.Form.Get("weekend_rate")) != "" {
+		weekend, err := pricing.ParseAmount(r.Form.Get("weekend_rate"))
+		if err != nil {
+			problems = append(problems, "weekend rate must be an amount like 149.00")
+		}
+		rate.WeekendRate = weekend
+	}
+
+	if len(problems) > 0 {
+		m.AddSessionError(r, strings.Join(problems, ", "))
+		http.Redirect(w, r, redirect, http.StatusSeeOther)
+		return
+	}
+
+	if _, err := m.DB.InsertSeasonalRate(r.Context(), rate); err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	m.AddFlashMessage(r, fmt.Sprintf("%s rate added", rate.Name))
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+}
+
+// AdminPostDeleteSeasonalRate removes a seasonal rate from a room. Quotes already
+// stored on reservations are not changed.
+func (m *Repository) AdminPostDeleteSeasonalRate(w http.ResponseWriter, r *http.Request) {
+	room, ok := m.roomFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	rateID, err := strconv.Atoi(chi.URLParam(r, "rateID"))
+	if err != nil {
+		logging.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	// only delete rates that belong to the room in the url
+	rates, err := m.DB.GetSeasonalRatesForRoom(r.Context(), room.ID)
+	if err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	found := false
+	for _, rate := range rates {
+		found = found || rate.ID == rateID
+	}
+
+	if !found {
+		logging.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	if err = m.DB.DeleteSeasonalRate(r.Context(), rateID); err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	m.AddFlashMessage(r, "rate deleted")
+	http.Redirect(w, r, fmt.Sprintf("/admin/rooms/%d", room.ID), http.StatusSeeOther)
+}
+
+//endregion
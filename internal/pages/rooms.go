@@ -0,0 +1,291 @@
+package pages
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/patrickoliveros/bookings/internal/forms"
+	"github.com/patrickoliveros/bookings/internal/helpers"
+	"github.com/patrickoliveros/bookings/internal/logging"
+	"github.com/patrickoliveros/bookings/internal/pricing"
+	"github.com/patrickoliveros/bookings/internal/renders"
+	"github.com/patrickoliveros/bookings/models"
+)
+
+//region rooms
+
+// RoomsPage lists every room guests can book
+func (m *Repository) RoomsPage(w http.ResponseWriter, r *http.Request) {
+	rooms, err := m.DB.GetActiveRooms(r.Context())
+	if err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["rooms"] = rooms
+
+	renders.RenderPageWithTemplate(w, r, "rooms", &models.TemplateData{
+		PageTitle: "Rooms",
+		StringMap: map[string]string{"currency": m.App.Pricing.Currency},
+		Data:      data,
+	})
+}
+
+// RoomPage shows a single room by its slug. Archived rooms are not found.
+func (m *Repository) RoomPage(w http.ResponseWriter, r *http.Request) {
+	room, err := m.DB.GetRoomBySlug(r.Context(), chi.URLParam(r, "slug"))
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && room.IsArchived()) {
+		logging.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["room"] = room
+
+	renders.RenderPageWithTemplate(w, r, "room", &models.TemplateData{
+		PageTitle: room.RoomName,
+		StringMap: map[string]string{"currency": m.App.Pricing.Currency},
+		Data:      data,
+	})
+}
+
+//endregion
+
+//region admin rooms
+
+func (m *Repository) AdminRoomsAll(w http.ResponseWriter, r *http.Request) {
+	rooms, err := m.DB.GetAllRooms(r.Context())
+	if err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["rooms"] = rooms
+
+	renders.RenderPageWithTemplate(w, r, "rooms-all", &models.TemplateData{
+		PageTitle: "Rooms",
+		Data:      data,
+	})
+}
+
+// AdminRoomsNew shows an empty room form
+func (m *Repository) AdminRoomsNew(w http.ResponseWriter, r *http.Request) {
+	data := make(map[string]interface{})
+	data["room"] = models.Room{Capacity: 2}
+
+	renders.RenderPageWithTemplate(w, r, "rooms-edit", &models.TemplateData{
+		PageTitle: "New Room",
+		Form:      forms.New(nil),
+		Data:      data,
+	})
+}
+
+func (m *Repository) AdminRoomsById(w http.ResponseWriter, r *http.Request) {
+	room, ok := m.roomFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	rates, err := m.DB.GetSeasonalRatesForRoom(r.Context(), room.ID)
+	if err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["room"] = room
+	data["rates"] = rates
+
+	stringMap := make(map[string]string)
+	if room.CalendarToken != "" {
+		stringMap["calendar_feed"] = m.calendarFeedURL(room.CalendarToken)
+	}
+
+	renders.RenderPageWithTemplate(w, r, "rooms-edit", &models.TemplateData{
+		PageTitle: room.RoomName,
+		StringMap: stringMap,
+		Form:      forms.New(nil),
+		Data:      data,
+	})
+}
+
+// AdminPostRoomsNew creates a room from the room form
+func (m *Repository) AdminPostRoomsNew(w http.ResponseWriter, r *http.Request) {
+	m.saveRoom(w, r, models.Room{})
+}
+
+// AdminPostRoomsById updates a room from the room form
+func (m *Repository) AdminPostRoomsById(w http.ResponseWriter, r *http.Request) {
+	room, ok := m.roomFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	m.saveRoom(w, r, room)
+}
+
+// AdminPostArchiveRoom archives a room, or restores it when restore=1 is posted.
+// Archived rooms keep their reservations but can no longer be found or booked by guests.
+func (m *Repository) AdminPostArchiveRoom(w http.ResponseWriter, r *http.Request) {
+	room, ok := m.roomFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	archive := r.Form.Get("restore") != "1"
+
+	if err := m.DB.ArchiveRoom(r.Context(), room.ID, archive); err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	if archive {
+		m.AddFlashMessage(r, fmt.Sprintf("%s archived", room.RoomName))
+	} else {
+		m.AddFlashMessage(r, fmt.Sprintf("%s restored", room.RoomName))
+	}
+
+	http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+}
+
+// roomFromURL loads the room in the {id} url parameter, writing the error response if it can't
+func (m *Repository) roomFromURL(w http.ResponseWriter, r *http.Request) (models.Room, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		logging.ClientError(w, http.StatusNotFound)
+		return models.Room{}, false
+	}
+
+	room, err := m.DB.GetRoomByID(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		logging.ClientError(w, http.StatusNotFound)
+		return room, false
+	} else if err != nil {
+		logging.ServerError(w, err)
+		return room, false
+	}
+
+	return room, true
+}
+
+// saveRoom validates the posted room form and inserts the room, or updates it when it has an ID
+func (m *Repository) saveRoom(w http.ResponseWriter, r *http.Request, room models.Room) {
+	if err := r.ParseForm(); err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	// an empty slug is generated from the name
+	if strings.TrimSpace(r.PostForm.Get("slug")) == "" {
+		r.PostForm.Set("slug", helpers.Slugify(r.PostForm.Get("room_name")))
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("room_name", "slug")
+	form.IsSlug("slug")
+	form.MinValue("capacity", 1)
+	form.Required("nightly_rate")
+
+	room.RoomName = strings.TrimSpace(form.Get("room_name"))
+	room.Slug = form.Get("slug")
+	room.Description = strings.TrimSpace(form.Get("description"))
+	room.Capacity, _ = strconv.Atoi(strings.TrimSpace(form.Get("capacity")))
+	room.Amenities = splitLines(form.Get("amenities"))
+	room.Photos = splitLines(form.Get("photos"))
+
+	if nightly, err := pricing.ParseAmount(form.Get("nightly_rate")); err == nil {
+		room.NightlyRate = nightly
+	} else if form.Has("nightly_rate") {
+		form.Errors.Add("nightly_rate", "Enter an amount like 129.00")
+	}
+
+	// an empty weekend rate charges the nightly rate every night
+	room.WeekendRate = 0
+	if strings.TrimSpace(form.Get("weekend_rate")) != "" {
+		if weekend, err := pricing.ParseAmount(form.Get("weekend_rate")); err == nil {
+			room.WeekendRate = weekend
+		} else {
+			form.Errors.Add("weekend_rate", "Enter an amount like 149.00")
+		}
+	}
+
+	if form.Valid() {
+		other, err := m.DB.GetRoomBySlug(r.Context(), room.Slug)
+		if err == nil && other.ID != room.ID {
+			form.Errors.Add("slug", "Another room already uses this slug")
+		} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			logging.ServerError(w, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		data := make(map[string]interface{})
+		data["room"] = room
+
+		if room.ID != 0 {
+			rates, err := m.DB.GetSeasonalRatesForRoom(r.Context(), room.ID)
+			if err != nil {
+				logging.ServerError(w, err)
+				return
+			}
+			data["rates"] = rates
+		}
+
+		pageTitle := room.RoomName
+		if room.ID == 0 {
+			pageTitle = "New Room"
+		}
+
+		renders.RenderPageWithTemplate(w, r, "rooms-edit", &models.TemplateData{
+			PageTitle: pageTitle,
+			Form:      form,
+			Data:      data,
+		})
+		return
+	}
+
+	var err error
+	if room.ID == 0 {
+		room.ID, err = m.DB.InsertRoom(r.Context(), room)
+	} else {
+		err = m.DB.UpdateRoom(r.Context(), room)
+	}
+
+	if err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	m.AddFlashMessage(r, "changes saved!")
+	http.Redirect(w, r, fmt.Sprintf("/admin/rooms/%d", room.ID), http.StatusSeeOther)
+}
+
+// splitLines returns the non-empty lines of a textarea
+func splitLines(s string) []string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines
+}
+
+//endregion
@@ -0,0 +1,214 @@
+package pages
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/patrickoliveros/bookings/internal/helpers"
+	"github.com/patrickoliveros/bookings/internal/logging"
+	"github.com/patrickoliveros/bookings/internal/renders"
+	"github.com/patrickoliveros/bookings/models"
+)
+
+// sessionKey holds the key of the user_sessions row for a logged in session
+const sessionKey = "session_key"
+
+// sessionTouchInterval is how stale last seen may get before a request updates it
+const sessionTouchInterval = time.Minute
+
+// userAgentLength is the most of a user agent that is kept
+const userAgentLength = 512
+
+//region staff sessions
+
+// startUserSession records a new login and ties it to the scs session
+func (m *Repository) startUserSession(r *http.Request, userID int) error {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	key := hex.EncodeToString(b)
+
+	userAgent := r.UserAgent()
+	if len(userAgent) > userAgentLength {
+		userAgent = userAgent[:userAgentLength]
+	}
+
+	_, err := m.DB.InsertUserSession(r.Context(), models.UserSession{
+		UserID:    userID,
+		Key:       key,
+		UserAgent: userAgent,
+		IPAddress: helpers.ClientIP(r),
+		ExpiresAt: time.Now().Add(m.App.Session.Lifetime),
+	})
+	if err != nil {
+		return err
+	}
+
+	m.App.Session.Put(r.Context(), sessionKey, key)
+
+	return nil
+}
+
+// currentUserSession returns the user_sessions row of the request's session
+func (m *Repository) currentUserSession(r *http.Request) (models.UserSession, error) {
+	key := m.App.Session.GetString(r.Context(), sessionKey)
+	if key == "" {
+		return models.UserSession{}, sql.ErrNoRows
+	}
+
+	return m.DB.GetUserSessionByKey(r.Context(), key)
+}
+
+// CheckUserSession reports whether the request's session still belongs to user and was
+// not revoked, and keeps its last seen time and address up to date
+func (m *Repository) CheckUserSession(r *http.Request, user models.User) (bool, error) {
+	session, err := m.currentUserSession(r)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	if session.UserID != user.ID || !session.IsActive(now) {
+		return false, nil
+	}
+
+	ip := helpers.ClientIP(r)
+	if now.Sub(session.LastSeenAt) > sessionTouchInterval || ip != session.IPAddress {
+		if err := m.DB.TouchUserSession(r.Context(), session.ID, ip); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// endUserSession revokes the request's session when logging out
+func (m *Repository) endUserSession(r *http.Request) error {
+	session, err := m.currentUserSession(r)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return m.DB.RevokeUserSession(r.Context(), session.UserID, session.ID)
+}
+
+//endregion
+
+//region admin sessions
+
+// AdminSessions lists where the logged in user is logged in
+func (m *Repository) AdminSessions(w http.ResponseWriter, r *http.Request) {
+	userID := m.App.Session.GetInt(r.Context(), "user_id")
+
+	sessions, err := m.DB.GetActiveUserSessions(r.Context(), userID)
+	if err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	current, err := m.currentUserSession(r)
+	if err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["sessions"] = sessions
+
+	renders.RenderPageWithTemplate(w, r, "sessions", &models.TemplateData{
+		PageTitle: "My Sessions",
+		Data:      data,
+		IntMap:    map[string]int{"current": current.ID},
+	})
+}
+
+// AdminPostRevokeSession logs the user out of one of their sessions
+func (m *Repository) AdminPostRevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID := m.App.Session.GetInt(r.Context(), "user_id")
+
+	if !m.revokeSessionFromURL(w, r, userID) {
+		return
+	}
+
+	m.AddFlashMessage(r, "session ended")
+	http.Redirect(w, r, "/admin/sessions", http.StatusSeeOther)
+}
+
+// AdminPostRevokeOtherSessions logs the user out everywhere except here
+func (m *Repository) AdminPostRevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	userID := m.App.Session.GetInt(r.Context(), "user_id")
+
+	current, err := m.currentUserSession(r)
+	if err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	if err := m.DB.RevokeUserSessions(r.Context(), userID, current.ID); err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	m.AddFlashMessage(r, "all other sessions ended")
+	http.Redirect(w, r, "/admin/sessions", http.StatusSeeOther)
+}
+
+// AdminPostRevokeUserSession ends one of a user's sessions
+func (m *Repository) AdminPostRevokeUserSession(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.userFromURL(w, r)
+	if !ok || !m.revokeSessionFromURL(w, r, user.ID) {
+		return
+	}
+
+	m.AddFlashMessage(r, "session ended")
+	http.Redirect(w, r, fmt.Sprintf("/admin/users/%d", user.ID), http.StatusSeeOther)
+}
+
+// AdminPostRevokeUserSessions ends all of a user's sessions
+func (m *Repository) AdminPostRevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.userFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	if err := m.DB.RevokeUserSessions(r.Context(), user.ID, 0); err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	m.AddFlashMessage(r, fmt.Sprintf("%s logged out everywhere", user.FirstName))
+	http.Redirect(w, r, fmt.Sprintf("/admin/users/%d", user.ID), http.StatusSeeOther)
+}
+
+// revokeSessionFromURL revokes the {sessionID} url parameter if it belongs to userID,
+// writing the error response if it can't
+func (m *Repository) revokeSessionFromURL(w http.ResponseWriter, r *http.Request, userID int) bool {
+	id, err := strconv.Atoi(chi.URLParam(r, "sessionID"))
+	if err != nil {
+		logging.ClientError(w, http.StatusNotFound)
+		return false
+	}
+
+	err = m.DB.RevokeUserSession(r.Context(), userID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		logging.ClientError(w, http.StatusNotFound)
+		return false
+	} else if err != nil {
+		logging.ServerError(w, err)
+		return false
+	}
+
+	return true
+}
+
+//endregion
@@ -0,0 +1,374 @@
+package pages
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/patrickoliveros/bookings/internal/forms"
+	"github.com/patrickoliveros/bookings/internal/helpers"
+	"github.com/patrickoliveros/bookings/internal/logging"
+	"github.com/patrickoliveros/bookings/internal/renders"
+	"github.com/patrickoliveros/bookings/internal/totp"
+	"github.com/patrickoliveros/bookings/models"
+	"github.com/skip2/go-qrcode"
+)
+
+// twoFactorLoginTTL is how long a user has to enter their code after their password
+const twoFactorLoginTTL = 5 * time.Minute
+
+// Session keys used while logging in with, and while setting up, two-factor authentication
+const (
+	twoFactorUserKey      = "two_factor_user_id"
+	twoFactorStartedKey   = "two_factor_started"
+	twoFactorSecretKey    = "two_factor_secret"
+	twoFactorRecoveryKey  = "recovery_codes"
+	errTwoFactorWrongCode = "That code is not valid"
+)
+
+//region two-factor login
+
+// TwoFactorLoginPage asks for the one-time code after the password was accepted
+func (m *Repository) TwoFactorLoginPage(w http.ResponseWriter, r *http.Request) {
+	if _, ok := m.pendingTwoFactorUser(r); !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	renders.RenderPageWithTemplate(w, r, "two-factor-login", &models.TemplateData{
+		PageTitle: "Two-Factor Authentication",
+		Form:      forms.New(nil),
+	})
+}
+
+// PostTwoFactorLoginPage finishes logging in with a code from the user's authenticator
+// app or one of their recovery codes. Wrong codes count as failed logins.
+func (m *Repository) PostTwoFactorLoginPage(w http.ResponseWriter, r *http.Request) {
+	id, ok := m.pendingTwoFactorUser(r)
+	if !ok {
+		m.AddSessionError(r, "please log in again")
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	user, err := m.DB.GetUserByID(r.Context(), id)
+	if err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	ip := helpers.ClientIP(r)
+	now := time.Now()
+
+	throttled, err := m.loginThrottled(r.Context(), ip, user, now)
+	if err != nil {
+		logging.ServerError(w, err)
+		return
+	} else if throttled || !user.IsActive() {
+		m.clearPendingTwoFactor(r)
+		m.AddSessionError(r, errLoginThrottled)
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("code")
+
+	if form.Valid() {
+		ok, err = m.checkSecondFactor(r.Context(), user, form.Get("code"), now)
+		if err != nil {
+			logging.ServerError(w, err)
+			return
+		}
+
+		if !ok {
+			form.Errors.Add("code", errTwoFactorWrongCode)
+			if err := m.recordFailedLogin(r.Context(), user.Email, ip, user, now); err != nil {
+				logging.ServerError(w, err)
+				return
+			}
+		}
+	}
+
+	if !form.Valid() {
+		renders.RenderPageWithTemplate(w, r, "two-factor-login", &models.TemplateData{
+			PageTitle: "Two-Factor Authentication",
+			Form:      form,
+		})
+		return
+	}
+
+	m.clearPendingTwoFactor(r)
+
+	if err := m.recordLogin(r.Context(), ip, user); err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	if err := m.logIn(r, user.ID, user.FirstName+" "+user.LastName); err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// beginTwoFactorLogin remembers a user whose password was accepted until they enter their code
+func (m *Repository) beginTwoFactorLogin(r *http.Request, user models.User) {
+	m.App.Session.Put(r.Context(), twoFactorUserKey, user.ID)
+	m.App.Session.Put(r.Context(), twoFactorStartedKey, time.Now())
+}
+
+// pendingTwoFactorUser returns the user waiting to enter their code, if they have not taken too long
+func (m *Repository) pendingTwoFactorUser(r *http.Request) (int, bool) {
+	id := m.App.Session.GetInt(r.Context(), twoFactorUserKey)
+	started := m.App.Session.GetTime(r.Context(), twoFactorStartedKey)
+
+	return id, id != 0 && time.Since(started) < twoFactorLoginTTL
+}
+
+func (m *Repository) clearPendingTwoFactor(r *http.Request) {
+	m.App.Session.Remove(r.Context(), twoFactorUserKey)
+	m.App.Session.Remove(r.Context(), twoFactorStartedKey)
+}
+
+// checkSecondFactor accepts a current code from the user's authenticator app, or one of
+// their unused recovery codes. Either can only be used once.
+func (m *Repository) checkSecondFactor(ctx context.Context, user models.User, code string, now time.Time) (bool, error) {
+	if !user.HasTwoFactor() {
+		return false, nil
+	}
+
+	if step, ok := totp.Validate(user.TOTPSecret, code, now, user.TOTPLastStep); ok {
+		return m.DB.UseTOTPStep(ctx, user.ID, step)
+	}
+
+	return m.DB.UseRecoveryCode(ctx, user.ID, totp.HashRecoveryCode(code))
+}
+
+// TwoFactorRequired reports whether the user's role has to log in with two-factor authentication
+func (m *Repository) TwoFactorRequired(user models.User) bool {
+	return m.App.TwoFactorRole != "" && user.HasRole(m.App.TwoFactorRole)
+}
+
+//endregion
+
+//region admin two-factor
+
+// AdminTwoFactor shows the logged in user's two-factor status. Until it is enabled, it
+// shows a new secret as a QR code for their authenticator app.
+func (m *Repository) AdminTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, err := m.DB.GetUserByID(r.Context(), m.App.Session.GetInt(r.Context(), "user_id"))
+	if err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	m.renderTwoFactor(w, r, user, forms.New(nil))
+}
+
+// AdminPostTwoFactor enables two-factor authentication once the user has entered a code
+// for the secret they were shown, and shows their recovery codes
+func (m *Repository) AdminPostTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, form, ok := m.twoFactorForm(w, r)
+	if !ok {
+		return
+	}
+
+	secret := m.App.Session.GetString(r.Context(), twoFactorSecretKey)
+
+	step, valid := totp.Validate(secret, form.Get("code"), time.Now(), 0)
+	if secret == "" || !valid {
+		form.Errors.Add("code", errTwoFactorWrongCode)
+		m.renderTwoFactor(w, r, user, form)
+		return
+	}
+
+	codes := totp.NewRecoveryCodes()
+
+	if err := m.DB.EnableTwoFactor(r.Context(), user.ID, secret, hashRecoveryCodes(codes)); err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	if _, err := m.DB.UseTOTPStep(r.Context(), user.ID, step); err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Remove(r.Context(), twoFactorSecretKey)
+	m.App.Session.Put(r.Context(), twoFactorRecoveryKey, strings.Join(codes, " "))
+	m.AddFlashMessage(r, "two-factor authentication enabled")
+	http.Redirect(w, r, "/admin/two-factor", http.StatusSeeOther)
+}
+
+// AdminPostRecoveryCodes replaces the user's recovery codes, after checking a current code
+func (m *Repository) AdminPostRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user, form, ok := m.twoFactorForm(w, r)
+	if !ok || !m.confirmSecondFactor(w, r, user, form) {
+		return
+	}
+
+	codes := totp.NewRecoveryCodes()
+
+	if err := m.DB.ReplaceRecoveryCodes(r.Context(), user.ID, hashRecoveryCodes(codes)); err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), twoFactorRecoveryKey, strings.Join(codes, " "))
+	m.AddFlashMessage(r, "new recovery codes created")
+	http.Redirect(w, r, "/admin/two-factor", http.StatusSeeOther)
+}
+
+// AdminPostDisableTwoFactor turns two-factor authentication off, after checking a current
+// code, unless the user's role requires it
+func (m *Repository) AdminPostDisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, form, ok := m.twoFactorForm(w, r)
+	if !ok {
+		return
+	}
+
+	if m.TwoFactorRequired(user) {
+		m.AddSessionError(r, "your role requires two-factor authentication")
+		http.Redirect(w, r, "/admin/two-factor", http.StatusSeeOther)
+		return
+	}
+
+	if !m.confirmSecondFactor(w, r, user, form) {
+		return
+	}
+
+	if err := m.DB.DisableTwoFactor(r.Context(), user.ID); err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	m.AddFlashMessage(r, "two-factor authentication disabled")
+	http.Redirect(w, r, "/admin/two-factor", http.StatusSeeOther)
+}
+
+// AdminPostResetTwoFactor turns off a user's two-factor authentication, for when they lost
+// their device and their recovery codes. They will have to set it up again if their role requires it.
+func (m *Repository) AdminPostResetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.userFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	if err := m.DB.DisableTwoFactor(r.Context(), user.ID); err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	m.AddFlashMessage(r, "two-factor authentication reset")
+	http.Redirect(w, r, fmt.Sprintf("/admin/users/%d", user.ID), http.StatusSeeOther)
+}
+
+// twoFactorForm loads the logged in user and the posted code
+func (m *Repository) twoFactorForm(w http.ResponseWriter, r *http.Request) (models.User, *forms.Form, bool) {
+	user, err := m.DB.GetUserByID(r.Context(), m.App.Session.GetInt(r.Context(), "user_id"))
+	if err != nil {
+		logging.ServerError(w, err)
+		return user, nil, false
+	}
+
+	if err := r.ParseForm(); err != nil {
+		logging.ServerError(w, err)
+		return user, nil, false
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("code")
+
+	return user, form, true
+}
+
+// confirmSecondFactor checks the posted code before a change to the user's two-factor
+// settings, showing the page again with an error when it is wrong
+func (m *Repository) confirmSecondFactor(w http.ResponseWriter, r *http.Request, user models.User, form *forms.Form) bool {
+	if form.Valid() {
+		ok, err := m.checkSecondFactor(r.Context(), user, form.Get("code"), time.Now())
+		if err != nil {
+			logging.ServerError(w, err)
+			return false
+		}
+
+		if !ok {
+			form.Errors.Add("code", errTwoFactorWrongCode)
+		}
+	}
+
+	if !form.Valid() {
+		m.renderTwoFactor(w, r, user, form)
+		return false
+	}
+
+	return true
+}
+
+func (m *Repository) renderTwoFactor(w http.ResponseWriter, r *http.Request, user models.User, form *forms.Form) {
+	stringMap := make(map[string]string)
+	data := make(map[string]interface{})
+	data["user"] = user
+
+	if user.HasTwoFactor() {
+		remaining, err := m.DB.CountRecoveryCodes(r.Context(), user.ID)
+		if err != nil {
+			logging.ServerError(w, err)
+			return
+		}
+
+		data["remaining"] = remaining
+
+		if codes := m.App.Session.PopString(r.Context(), twoFactorRecoveryKey); codes != "" {
+			data["recovery_codes"] = strings.Fields(codes)
+		}
+	} else {
+		secret := m.App.Session.GetString(r.Context(), twoFactorSecretKey)
+		if secret == "" {
+			secret = totp.NewSecret()
+			m.App.Session.Put(r.Context(), twoFactorSecretKey, secret)
+		}
+
+		stringMap["secret"] = secret
+		uri := totp.URI(m.App.SiteSuffix, user.Email, secret)
+
+		// the QR code is drawn here so the secret never leaves the site
+		png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+		if err != nil {
+			logging.ServerError(w, err)
+			return
+		}
+
+		data["qr_code"] = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png))
+	}
+
+	renders.RenderPageWithTemplate(w, r, "two-factor", &models.TemplateData{
+		PageTitle: "Two-Factor Authentication",
+		Form:      form,
+		Data:      data,
+		StringMap: stringMap,
+		IntMap:    map[string]int{"required": boolToInt(m.TwoFactorRequired(user))},
+	})
+}
+
+func hashRecoveryCodes(codes []string) []string {
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = totp.HashRecoveryCode(code)
+	}
+
+	return hashes
+}
+
+//endregion
@@ -0,0 +1,284 @@
+package pages
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/patrickoliveros/bookings/internal/forms"
+	"github.com/patrickoliveros/bookings/internal/helpers"
+	"github.com/patrickoliveros/bookings/internal/logging"
+	"github.com/patrickoliveros/bookings/internal/renders"
+	"github.com/patrickoliveros/bookings/models"
+)
+
+// temporaryPasswordKey holds a generated password until the owner has seen it once
+const temporaryPasswordKey = "temporary_password"
+
+// accessLevels are offered by the user form, lowest first
+var accessLevels = []int{models.AccessFrontDesk, models.AccessManager, models.AccessOwner}
+
+//region admin users
+
+// AdminUsersAll lists every staff account
+func (m *Repository) AdminUsersAll(w http.ResponseWriter, r *http.Request) {
+	users, err := m.DB.GetAllUsers(r.Context())
+	if err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["users"] = users
+	data["now"] = time.Now()
+
+	renders.RenderPageWithTemplate(w, r, "users-all", &models.TemplateData{
+		PageTitle: "Users",
+		Data:      data,
+	})
+}
+
+// AdminUsersNew shows an empty form to invite a member of staff
+func (m *Repository) AdminUsersNew(w http.ResponseWriter, r *http.Request) {
+	data := make(map[string]interface{})
+	data["user"] = models.User{AccessLevel: models.AccessFrontDesk}
+	data["access_levels"] = accessLevels
+	data["now"] = time.Now()
+
+	renders.RenderPageWithTemplate(w, r, "users-edit", &models.TemplateData{
+		PageTitle: "Invite User",
+		Form:      forms.New(nil),
+		Data:      data,
+	})
+}
+
+// AdminUserById shows a user's details, and their temporary password right after it was generated
+func (m *Repository) AdminUserById(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.userFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	sessions, err := m.DB.GetActiveUserSessions(r.Context(), user.ID)
+	if err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["user"] = user
+	data["access_levels"] = accessLevels
+	data["now"] = time.Now()
+	data["sessions"] = sessions
+
+	renders.RenderPageWithTemplate(w, r, "users-edit", &models.TemplateData{
+		PageTitle: fmt.Sprintf("%s %s", user.FirstName, user.LastName),
+		Form:      forms.New(nil),
+		Data:      data,
+		StringMap: map[string]string{
+			temporaryPasswordKey: m.App.Session.PopString(r.Context(), temporaryPasswordKey),
+		},
+		IntMap: map[string]int{"is_self": boolToInt(m.isCurrentUser(r, user.ID))},
+	})
+}
+
+// AdminPostUsersNew creates an account with a temporary password
+func (m *Repository) AdminPostUsersNew(w http.ResponseWriter, r *http.Request) {
+	m.saveUser(w, r, models.User{})
+}
+
+// AdminPostUserById updates a user's name, email and role
+func (m *Repository) AdminPostUserById(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.userFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	m.saveUser(w, r, user)
+}
+
+// AdminPostDeactivateUser stops a user from logging in, or lets them back in when restore=1 is posted.
+// Nobody can deactivate their own account.
+func (m *Repository) AdminPostDeactivateUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.userFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	redirect := fmt.Sprintf("/admin/users/%d", user.ID)
+	deactivate := r.Form.Get("restore") != "1"
+
+	if deactivate && m.isCurrentUser(r, user.ID) {
+		m.AddSessionError(r, "you cannot deactivate your own account")
+		http.Redirect(w, r, redirect, http.StatusSeeOther)
+		return
+	}
+
+	if err := m.DB.DeactivateUser(r.Context(), user.ID, deactivate); err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	if deactivate {
+		if err := m.DB.RevokeUserSessions(r.Context(), user.ID, 0); err != nil {
+			logging.ServerError(w, err)
+			return
+		}
+	}
+
+	if deactivate {
+		m.AddFlashMessage(r, fmt.Sprintf("%s deactivated", user.FirstName))
+	} else {
+		m.AddFlashMessage(r, fmt.Sprintf("%s reactivated", user.FirstName))
+	}
+
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+}
+
+// AdminPostResetUserPassword replaces a user's password with a new temporary one and
+// logs them out everywhere
+func (m *Repository) AdminPostResetUserPassword(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.userFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	password := helpers.GenerateTemporaryPassword()
+
+	if err := m.DB.UpdatePassword(r.Context(), user.ID, helpers.GenerateHashedPassword(password)); err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	if err := m.DB.RevokeUserSessions(r.Context(), user.ID, 0); err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), temporaryPasswordKey, password)
+	m.AddFlashMessage(r, "password reset")
+	http.Redirect(w, r, fmt.Sprintf("/admin/users/%d", user.ID), http.StatusSeeOther)
+}
+
+// userFromURL loads the user in the {id} url parameter, writing the error response if it can't
+func (m *Repository) userFromURL(w http.ResponseWriter, r *http.Request) (models.User, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		logging.ClientError(w, http.StatusNotFound)
+		return models.User{}, false
+	}
+
+	user, err := m.DB.GetUserByID(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		logging.ClientError(w, http.StatusNotFound)
+		return user, false
+	} else if err != nil {
+		logging.ServerError(w, err)
+		return user, false
+	}
+
+	return user, true
+}
+
+// saveUser validates the posted user form and inserts the user with a temporary password,
+// or updates them when they have an ID
+func (m *Repository) saveUser(w http.ResponseWriter, r *http.Request, user models.User) {
+	if err := r.ParseForm(); err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("first_name", "last_name", "email", "access_level")
+	form.IsEmail("email")
+
+	previousLevel := user.AccessLevel
+
+	user.FirstName = strings.TrimSpace(form.Get("first_name"))
+	user.LastName = strings.TrimSpace(form.Get("last_name"))
+	user.Email = strings.TrimSpace(form.Get("email"))
+	user.AccessLevel, _ = strconv.Atoi(form.Get("access_level"))
+
+	if models.RoleName(user.AccessLevel) == "" || user.AccessLevel > models.AccessOwner {
+		form.Errors.Add("access_level", "Choose a role")
+	} else if user.ID != 0 && m.isCurrentUser(r, user.ID) && user.AccessLevel != previousLevel {
+		// keeps the last owner from locking everyone out of user management
+		form.Errors.Add("access_level", "You cannot change your own role")
+	}
+
+	if form.Valid() {
+		other, err := m.DB.GetUserByEmail(r.Context(), user.Email)
+		if err == nil && other.ID != user.ID {
+			form.Errors.Add("email", "Another user already has this email")
+		} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			logging.ServerError(w, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		data := make(map[string]interface{})
+		data["user"] = user
+		data["access_levels"] = accessLevels
+		data["now"] = time.Now()
+
+		pageTitle := fmt.Sprintf("%s %s", user.FirstName, user.LastName)
+		if user.ID == 0 {
+			pageTitle = "Invite User"
+		}
+
+		renders.RenderPageWithTemplate(w, r, "users-edit", &models.TemplateData{
+			PageTitle: pageTitle,
+			Form:      form,
+			Data:      data,
+			IntMap:    map[string]int{"is_self": boolToInt(m.isCurrentUser(r, user.ID))},
+		})
+		return
+	}
+
+	var err error
+	if user.ID == 0 {
+		password := helpers.GenerateTemporaryPassword()
+		user.Password = helpers.GenerateHashedPassword(password)
+
+		user.ID, err = m.DB.InsertUser(r.Context(), user)
+		if err == nil {
+			m.App.Session.Put(r.Context(), temporaryPasswordKey, password)
+		}
+	} else {
+		err = m.DB.UpdateUser(r.Context(), user)
+	}
+
+	if err != nil {
+		logging.ServerError(w, err)
+		return
+	}
+
+	m.AddFlashMessage(r, "changes saved!")
+	http.Redirect(w, r, fmt.Sprintf("/admin/users/%d", user.ID), http.StatusSeeOther)
+}
+
+// isCurrentUser reports whether id is the logged in user
+func (m *Repository) isCurrentUser(r *http.Request, id int) bool {
+	return id != 0 && m.App.Session.GetInt(r.Context(), "user_id") == id
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+//endregion
@@ -0,0 +1,125 @@
+package pricing
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/patrickoliveros/bookings/internal/config"
+	"github.com/patrickoliveros/bookings/models"
+)
+
+// Rate names shown against each night of a quote
+const (
+	RateStandard = "Standard"
+	RateWeekend  = "Weekend"
+)
+
+// ErrNoNights is returned for a stay that does not end after it starts
+var ErrNoNights = errors.New("the stay must be at least one night")
+
+// ParseAmount reads a decimal amount like "129.50" as cents
+func ParseAmount(s string) (int, error) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || f < 0 || math.IsInf(f, 0) || math.IsNaN(f) {
+		return 0, fmt.Errorf("%q is not a valid amount", s)
+	}
+
+	return int(math.Round(f * 100)), nil
+}
+
+// IsWeekend reports whether the night starting on t is charged the weekend rate.
+// Friday and Saturday nights are weekend nights.
+func IsWeekend(t time.Time) bool {
+	return t.Weekday() == time.Friday || t.Weekday() == time.Saturday
+}
+
+// Quote prices a stay in room from start to end. Every night is charged the
+// room's rate unless a seasonal rate covers it, then the fees are added and the
+// taxes are worked out on the nights and fees together.
+func Quote(room models.Room, seasons []models.SeasonalRate, start, end time.Time, rules config.PricingConfig) (models.Quote, error) {
+	quote := models.Quote{
+		Currency: rules.Currency,
+	}
+
+	start = day(start)
+	end = day(end)
+
+	if !end.After(start) {
+		return quote, ErrNoNights
+	}
+
+	for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+		night := nightCharge(room, seasons, d)
+		quote.Nights = append(quote.Nights, night)
+		quote.Subtotal += night.Amount
+	}
+
+	for _, fee := range rules.Fees {
+		amount := fee.Amount
+		if fee.PerNight {
+			amount *= len(quote.Nights)
+		}
+
+		quote.Fees = append(quote.Fees, models.Charge{Name: fee.Name, Amount: amount})
+		quote.Subtotal += amount
+	}
+
+	quote.Total = quote.Subtotal
+
+	for _, tax := range rules.Taxes {
+		amount := int(math.Round(float64(quote.Subtotal) * tax.Percent / 100))
+
+		quote.Taxes = append(quote.Taxes, models.Charge{Name: tax.Name, Amount: amount})
+		quote.Total += amount
+	}
+
+	return quote, nil
+}
+
+func nightCharge(room models.Room, seasons []models.SeasonalRate, d time.Time) models.NightCharge {
+	weekend := IsWeekend(d)
+
+	if season, ok := seasonFor(seasons, room.ID, d); ok {
+		amount := season.NightlyRate
+		if weekend && season.WeekendRate > 0 {
+			amount = season.WeekendRate
+		}
+
+		return models.NightCharge{Date: d, Rate: season.Name, Amount: amount}
+	}
+
+	if weekend && room.WeekendRate > 0 {
+		return models.NightCharge{Date: d, Rate: RateWeekend, Amount: room.WeekendRate}
+	}
+
+	return models.NightCharge{Date: d, Rate: RateStandard, Amount: room.NightlyRate}
+}
+
+// seasonFor finds the seasonal rate covering the night d. When seasons overlap the
+// one starting last wins, so a short holiday rate can sit inside a longer season.
+func seasonFor(seasons []models.SeasonalRate, roomID int, d time.Time) (models.SeasonalRate, bool) {
+	var found models.SeasonalRate
+	ok := false
+
+	for _, s := range seasons {
+		if s.RoomID != roomID || d.Before(day(s.StartDate)) || d.After(day(s.EndDate)) {
+			continue
+		}
+
+		if !ok || s.StartDate.After(found.StartDate) || (s.StartDate.Equal(found.StartDate) && s.ID > found.ID) {
+			found = s
+			ok = true
+		}
+	}
+
+	return found, ok
+}
+
+// day drops the time of day so nights are counted by calendar date
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
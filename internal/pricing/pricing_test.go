@@ -0,0 +1,124 @@
+package pricing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/patrickoliveros/bookings/internal/config"
+	"github.com/patrickoliveros/bookings/models"
+)
+
+func date(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+var room = models.Room{ID: 1, NightlyRate: 10000, WeekendRate: 12000}
+
+func TestQuote_Nights(t *testing.T) {
+	seasons := []models.SeasonalRate{
+		{ID: 1, RoomID: 1, Name: "Summer", StartDate: date("2021-07-01"), EndDate: date("2021-08-31"), NightlyRate: 15000},
+		{ID: 2, RoomID: 1, Name: "Fireworks", StartDate: date("2021-07-04"), EndDate: date("2021-07-04"), NightlyRate: 30000},
+		{ID: 3, RoomID: 2, Name: "Other room", StartDate: date("2021-06-01"), EndDate: date("2021-09-30"), NightlyRate: 1},
+	}
+
+	// Tuesday 29 June to Monday 5 July
+	quote, err := Quote(room, seasons, date("2021-06-29"), date("2021-07-05"), config.PricingConfig{Currency: "USD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		rate   string
+		amount int
+	}{
+		{RateStandard, 10000}, // Tue 29
+		{RateStandard, 10000}, // Wed 30
+		{"Summer", 15000},     // Thu 1
+		{"Summer", 15000},     // Fri 2, the season has no weekend rate
+		{"Summer", 15000},     // Sat 3
+		{"Fireworks", 30000},  // Sun 4
+	}
+
+	if len(quote.Nights) != len(tests) {
+		t.Fatalf("expected %d nights, got %d", len(tests), len(quote.Nights))
+	}
+
+	for i, e := range tests {
+		if quote.Nights[i].Rate != e.rate || quote.Nights[i].Amount != e.amount {
+			t.Errorf("night %d: expected %s %d, got %s %d", i, e.rate, e.amount, quote.Nights[i].Rate, quote.Nights[i].Amount)
+		}
+	}
+
+	if quote.Total != 95000 {
+		t.Errorf("expected total 95000, got %d", quote.Total)
+	}
+}
+
+func TestQuote_Weekend(t *testing.T) {
+	// Friday and Saturday night
+	quote, _ := Quote(room, nil, date("2021-07-09"), date("2021-07-11"), config.PricingConfig{})
+
+	for _, night := range quote.Nights {
+		if night.Rate != RateWeekend || night.Amount != 12000 {
+			t.Errorf("expected the weekend rate on %s, got %s %d", night.Date.Weekday(), night.Rate, night.Amount)
+		}
+	}
+}
+
+func TestQuote_FeesAndTaxes(t *testing.T) {
+	rules := config.PricingConfig{
+		Currency: "USD",
+		Fees: []config.FeeConfig{
+			{Name: "Cleaning", Amount: 2500},
+			{Name: "Resort", Amount: 1000, PerNight: true},
+		},
+		Taxes: []config.TaxConfig{
+			{Name: "Sales tax", Percent: 8.5},
+		},
+	}
+
+	// two weekday nights
+	quote, _ := Quote(room, nil, date("2021-07-06"), date("2021-07-08"), rules)
+
+	if quote.Fees[0].Amount != 2500 || quote.Fees[1].Amount != 2000 {
+		t.Errorf("unexpected fees %+v", quote.Fees)
+	}
+
+	if quote.Subtotal != 24500 {
+		t.Errorf("expected subtotal 24500, got %d", quote.Subtotal)
+	}
+
+	// 8.5% of 245.00 is 20.825, rounded to the cent
+	if quote.Taxes[0].Amount != 2083 || quote.Total != 26583 {
+		t.Errorf("unexpected taxes %+v and total %d", quote.Taxes, quote.Total)
+	}
+}
+
+func TestQuote_NoNights(t *testing.T) {
+	if _, err := Quote(room, nil, date("2021-07-06"), date("2021-07-06"), config.PricingConfig{}); err != ErrNoNights {
+		t.Errorf("expected ErrNoNights, got %v", err)
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	var tests = []struct {
+		input string
+		cents int
+		valid bool
+	}{
+		{"129", 12900, true},
+		{"129.5", 12950, true},
+		{" 0.99 ", 99, true},
+		{"-1", 0, false},
+		{"ten", 0, false},
+		{"", 0, false},
+	}
+
+	for _, e := range tests {
+		cents, err := ParseAmount(e.input)
+		if (err == nil) != e.valid || cents != e.cents {
+			t.Errorf("%q: expected %d valid %v, got %d %v", e.input, e.cents, e.valid, cents, err)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Package ratelimit limits how often each client may make requests, with a token
+// bucket per client kept in memory
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter lets each key make a number of requests a minute, in bursts of up to that many
+type Limiter struct {
+	mu        sync.Mutex
+	perMinute int
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// New returns a limiter allowing perMinute requests a minute to each key
+func New(perMinute int) *Limiter {
+	return &Limiter{
+		perMinute: perMinute,
+		buckets:   map[string]*bucket{},
+	}
+}
+
+// Allow takes a request from key's allowance at now. When there is none left it
+// returns false and how long until there is.
+func (l *Limiter) Allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	burst := float64(l.perMinute)
+	perSecond := burst / time.Minute.Seconds()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, updated: now}
+		l.buckets[key] = b
+	}
+
+	if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * perSecond
+		if b.tokens > burst {
+			b.tokens = burst
+		}
+	}
+	b.updated = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+		return false, wait
+	}
+
+	b.tokens--
+
+	return true, 0
+}
+
+// sweep forgets keys that have been idle long enough to have a full allowance again,
+// so the limiter doesn't grow with every client it has ever seen
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) >= time.Minute {
+			delete(l.buckets, key)
+		}
+	}
+}
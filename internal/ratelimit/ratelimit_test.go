@@ -0,0 +1,39 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	l := New(3)
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("a", now); !ok {
+			t.Fatalf("request %d: expected the burst to be allowed", i+1)
+		}
+	}
+
+	ok, wait := l.Allow("a", now)
+	if ok || wait != 20*time.Second {
+		t.Errorf("expected the 4th request to wait 20s, got %v %s", ok, wait)
+	}
+
+	if ok, _ := l.Allow("b", now); !ok {
+		t.Error("expected another key to have its own allowance")
+	}
+
+	if ok, _ := l.Allow("a", now.Add(20*time.Second)); !ok {
+		t.Error("expected a request to be allowed once a token came back")
+	}
+
+	if ok, _ := l.Allow("a", now.Add(21*time.Second)); ok {
+		t.Error("expected the returned token to be used up")
+	}
+
+	l.Allow("c", now.Add(10*time.Minute))
+	if len(l.buckets) != 1 {
+		t.Errorf("expected idle keys to be forgotten, %d are kept", len(l.buckets))
+	}
+}
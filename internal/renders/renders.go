@@ -22,6 +22,11 @@ var functions = template.FuncMap{
 	"iterate":      helpers.Iterate,
 	"add":          helpers.Add,
 	"calendarDate": helpers.CalendarDate,
+	"amount":       helpers.Amount,
+	"money":        helpers.Money,
+	"statusLabel":  models.StatusLabel,
+	"roleName":     models.RoleName,
+	"device":       helpers.Device,
 }
 
 var app *config.AppConfig
@@ -36,6 +41,7 @@ func AddDefaultData(td *models.TemplateData, r *http.Request) *models.TemplateDa
 	td.Warning = app.Session.PopString(r.Context(), "warning")
 	td.CSRFToken = nosurf.Token(r)
 	td.IsAuthenticated = app.Session.Exists(r.Context(), "user_id")
+	td.AccessLevel = app.Session.GetInt(r.Context(), "access_level")
 	td.SiteSuffix = app.SiteSuffix
 
 	if app.Session.Exists(r.Context(), "user_id") {
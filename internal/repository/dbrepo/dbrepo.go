@@ -1,12 +1,17 @@
 package dbrepo
 
 import (
+	"context"
 	"database/sql"
+	"time"
 
 	"github.com/patrickoliveros/bookings/internal/config"
 	"github.com/patrickoliveros/bookings/internal/repository"
 )
 
+// defaultQueryTimeout is used when the application does not configure one
+const defaultQueryTimeout = 3 * time.Second
+
 type postgresDBRepo struct {
 	App *config.AppConfig
 	DB  *sql.DB
@@ -18,3 +23,14 @@ func NewPostGresRepo(conn *sql.DB, a *config.AppConfig) repository.DatabaseRepo
 		DB:  conn,
 	}
 }
+
+// withTimeout bounds a query by the configured timeout, while still ending it
+// early if the caller's context (usually the request) is cancelled
+func (m *postgresDBRepo) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := defaultQueryTimeout
+	if m.App != nil && m.App.QueryTimeout > 0 {
+		timeout = m.App.QueryTimeout
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
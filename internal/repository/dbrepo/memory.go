@@ -0,0 +1,1863 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/patrickoliveros/bookings/internal/config"
+	"github.com/patrickoliveros/bookings/internal/repository"
+	"github.com/patrickoliveros/bookings/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MemoryAdminEmail and MemoryAdminPassword are the login seeded into a new memory repository
+const (
+	MemoryAdminEmail    = "admin@here.com"
+	MemoryAdminPassword = "password"
+)
+
+// roomDescription is the description the migrations give the seeded rooms
+const roomDescription = "Your home away from home, set on the majestic waters of the Atlantic Ocean, this will be a vacation to remember."
+
+// memoryDBRepo keeps every table in memory. It mirrors the behaviour of
+// postgresDBRepo, including the availability overlap rules, so it can stand in
+// for the database in tests and demos.
+type memoryDBRepo struct {
+	App *config.AppConfig
+
+	mu               sync.RWMutex
+	lastID           map[string]int
+	users            []models.User
+	rooms            []models.Room
+	restrictions     []models.Restriction
+	reservations     []models.Reservation
+	roomRestrictions []models.RoomRestriction
+	seasonalRates    []models.SeasonalRate
+	statusChanges    []models.ReservationStatusChange
+	passwordResets   []models.PasswordReset
+	loginAttempts    []models.LoginAttempt
+	recoveryCodes    []recoveryCode
+	userSessions     []models.UserSession
+	apiKeys          []models.APIKey
+	outbox           []models.OutboxMessage
+}
+
+// recoveryCode is a row of the recovery_codes table
+type recoveryCode struct {
+	userID   int
+	codeHash string
+	used     bool
+}
+
+// NewMemoryRepo returns an in-memory repository seeded with the same rooms and
+// restrictions as the migrations, plus an admin user
+func NewMemoryRepo(a *config.AppConfig) repository.DatabaseRepo {
+	m := &memoryDBRepo{
+		App:    a,
+		lastID: map[string]int{},
+	}
+
+	now := time.Now()
+
+	m.rooms = []models.Room{
+		{
+			ID:          m.nextID("rooms"),
+			RoomName:    "Generals Quarters",
+			Slug:        "generals-quarters",
+			Description: roomDescription,
+			Capacity:    2,
+			NightlyRate: 8900,
+			WeekendRate: 9900,
+			Amenities:   []string{"Ocean view", "Queen bed", "Free wifi"},
+			Photos:      []string{"/static/images/rooms/generals-quarters.png"},
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		},
+		{
+			ID:          m.nextID("rooms"),
+			RoomName:    "Majors Suite",
+			Slug:        "majors-suite",
+			Description: roomDescription,
+			Capacity:    4,
+			NightlyRate: 12900,
+			WeekendRate: 14900,
+			Amenities:   []string{"Ocean view", "King bed", "Sitting room", "Free wifi"},
+			Photos:      []string{"/static/images/rooms/marjors-suite.png"},
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		},
+	}
+
+	m.restrictions = []models.Restriction{
+		{ID: m.nextID("restrictions"), RestrictionName: "Reservation", CreatedAt: now, UpdatedAt: now},
+		{ID: m.nextID("restrictions"), RestrictionName: "Owners Block", CreatedAt: now, UpdatedAt: now},
+	}
+
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(MemoryAdminPassword), bcrypt.MinCost)
+
+	m.users = []models.User{
+		{
+			ID:          m.nextID("users"),
+			FirstName:   "Admin",
+			LastName:    "User",
+			Email:       MemoryAdminEmail,
+			Password:    string(hashedPassword),
+			AccessLevel: 3,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		},
+	}
+
+	return m
+}
+
+func (m *memoryDBRepo) nextID(table string) int {
+	m.lastID[table]++
+	return m.lastID[table]
+}
+
+func (m *memoryDBRepo) roomIndex(id int) int {
+	for i := range m.rooms {
+		if m.rooms[i].ID == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (m *memoryDBRepo) userIndex(id int) int {
+	for i := range m.users {
+		if m.users[i].ID == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (m *memoryDBRepo) reservationIndex(id int) int {
+	for i := range m.reservations {
+		if m.reservations[i].ID == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// overlaps matches the "$1 < end_date and $2 > start_date" test used by the sql queries
+func overlaps(start, end time.Time, rr models.RoomRestriction) bool {
+	return start.Before(rr.EndDate) && end.After(rr.StartDate)
+}
+
+// region "Users"
+func (m *memoryDBRepo) GetAllUsers(ctx context.Context) ([]models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	users := append([]models.User(nil), m.users...)
+
+	sort.SliceStable(users, func(i, j int) bool {
+		if users[i].IsActive() != users[j].IsActive() {
+			return users[i].IsActive()
+		}
+		if users[i].FirstName != users[j].FirstName {
+			return users[i].FirstName < users[j].FirstName
+		}
+		return users[i].LastName < users[j].LastName
+	})
+
+	return users, nil
+}
+
+func (m *memoryDBRepo) GetUserByID(ctx context.Context, id int) (models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return models.User{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, u := range m.users {
+		if u.ID == id {
+			return u, nil
+		}
+	}
+
+	return models.User{}, sql.ErrNoRows
+}
+
+func (m *memoryDBRepo) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return models.User{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, u := range m.users {
+		if strings.EqualFold(u.Email, email) {
+			return u, nil
+		}
+	}
+
+	return models.User{}, sql.ErrNoRows
+}
+
+func (m *memoryDBRepo) InsertUser(ctx context.Context, u models.User) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// users_email_idx is unique
+	for _, other := range m.users {
+		if strings.EqualFold(other.Email, u.Email) {
+			return 0, fmt.Errorf("a user with email %s already exists", u.Email)
+		}
+	}
+
+	u.ID = m.nextID("users")
+	u.DeactivatedAt = time.Time{}
+	u.CreatedAt = time.Now()
+	u.UpdatedAt = time.Now()
+	m.users = append(m.users, u)
+
+	return u.ID, nil
+}
+
+func (m *memoryDBRepo) UpdateUser(ctx context.Context, u models.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.users {
+		if m.users[i].ID == u.ID {
+			m.users[i].FirstName = u.FirstName
+			m.users[i].LastName = u.LastName
+			m.users[i].Email = u.Email
+			m.users[i].Password = u.Password
+			m.users[i].AccessLevel = u.AccessLevel
+			m.users[i].UpdatedAt = time.Now()
+		}
+	}
+
+	return nil
+}
+
+func (m *memoryDBRepo) DeactivateUser(ctx context.Context, id int, deactivated bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.users {
+		if m.users[i].ID == id {
+			m.users[i].DeactivatedAt = time.Time{}
+			if deactivated {
+				m.users[i].DeactivatedAt = time.Now()
+			}
+			m.users[i].UpdatedAt = time.Now()
+		}
+	}
+
+	return nil
+}
+
+func (m *memoryDBRepo) UpdatePassword(ctx context.Context, id int, passwordHash string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.setPassword(id, passwordHash)
+
+	return nil
+}
+
+// setPassword changes a password and uses up the user's reset links; the caller holds the write lock
+func (m *memoryDBRepo) setPassword(id int, passwordHash string) {
+	now := time.Now()
+
+	for i := range m.users {
+		if m.users[i].ID == id {
+			m.users[i].Password = passwordHash
+			m.users[i].PasswordChangedAt = now
+			m.users[i].UpdatedAt = now
+		}
+	}
+
+	for i := range m.passwordResets {
+		if m.passwordResets[i].UserID == id && m.passwordResets[i].UsedAt.IsZero() {
+			m.passwordResets[i].UsedAt = now
+		}
+	}
+}
+
+func (m *memoryDBRepo) Authenticate(ctx context.Context, email, testPassword string) (int, string, string, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, "", "", err
+	}
+
+	m.mu.RLock()
+	var user *models.User
+	for i := range m.users {
+		if strings.EqualFold(m.users[i].Email, email) && m.users[i].IsActive() {
+			u := m.users[i]
+			user = &u
+			break
+		}
+	}
+	m.mu.RUnlock()
+
+	if user == nil {
+		return 0, "", "", sql.ErrNoRows
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(testPassword))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return 0, "", "", errors.New("incorrect password")
+	} else if err != nil {
+		return 0, "", "", err
+	}
+
+	return user.ID, fmt.Sprintf("%s %s", user.FirstName, user.LastName), user.Password, nil
+}
+
+// endregion
+
+// region "Login Attempts"
+func (m *memoryDBRepo) RecordLoginAttempt(ctx context.Context, attempt models.LoginAttempt) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	attempt.ID = m.nextID("login_attempts")
+	attempt.CreatedAt = time.Now()
+	m.loginAttempts = append(m.loginAttempts, attempt)
+
+	return nil
+}
+
+func (m *memoryDBRepo) GetLoginAttempts(ctx context.Context, limit int) ([]models.LoginAttempt, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var attempts []models.LoginAttempt
+	for i := len(m.loginAttempts) - 1; i >= 0 && len(attempts) < limit; i-- {
+		attempts = append(attempts, m.loginAttempts[i])
+	}
+
+	return attempts, nil
+}
+
+func (m *memoryDBRepo) GetFailedLoginsByIP(ctx context.Context, ip string, since time.Time) (int, time.Time, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, time.Time{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var count int
+	var latest time.Time
+	for _, attempt := range m.loginAttempts {
+		if attempt.IPAddress == ip && !attempt.Succeeded && attempt.CreatedAt.After(since) {
+			count++
+			if attempt.CreatedAt.After(latest) {
+				latest = attempt.CreatedAt
+			}
+		}
+	}
+
+	return count, latest, nil
+}
+
+func (m *memoryDBRepo) IncrementFailedLogins(ctx context.Context, userID int) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.users {
+		if m.users[i].ID == userID {
+			m.users[i].FailedLogins++
+			return m.users[i].FailedLogins, nil
+		}
+	}
+
+	return 0, sql.ErrNoRows
+}
+
+func (m *memoryDBRepo) LockUser(ctx context.Context, userID int, until time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.users {
+		if m.users[i].ID == userID {
+			m.users[i].LockedUntil = until
+		}
+	}
+
+	return nil
+}
+
+func (m *memoryDBRepo) UnlockUser(ctx context.Context, userID int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.users {
+		if m.users[i].ID == userID {
+			m.users[i].FailedLogins = 0
+			m.users[i].LockedUntil = time.Time{}
+		}
+	}
+
+	return nil
+}
+
+// endregion
+
+// region "Two-Factor Authentication"
+func (m *memoryDBRepo) EnableTwoFactor(ctx context.Context, userID int, secret string, recoveryCodeHashes []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.users {
+		if m.users[i].ID == userID {
+			m.users[i].TOTPSecret = secret
+			m.users[i].TOTPEnabledAt = time.Now()
+			m.users[i].TOTPLastStep = 0
+			m.replaceRecoveryCodes(userID, recoveryCodeHashes)
+			return nil
+		}
+	}
+
+	return sql.ErrNoRows
+}
+
+func (m *memoryDBRepo) DisableTwoFactor(ctx context.Context, userID int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.users {
+		if m.users[i].ID == userID {
+			m.users[i].TOTPSecret = ""
+			m.users[i].TOTPEnabledAt = time.Time{}
+			m.users[i].TOTPLastStep = 0
+		}
+	}
+	m.replaceRecoveryCodes(userID, nil)
+
+	return nil
+}
+
+func (m *memoryDBRepo) UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.users {
+		if m.users[i].ID == userID && m.users[i].TOTPLastStep < step {
+			m.users[i].TOTPLastStep = step
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (m *memoryDBRepo) ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.replaceRecoveryCodes(userID, codeHashes)
+
+	return nil
+}
+
+// replaceRecoveryCodes needs the write lock held
+func (m *memoryDBRepo) replaceRecoveryCodes(userID int, codeHashes []string) {
+	var kept []recoveryCode
+	for _, code := range m.recoveryCodes {
+		if code.userID != userID {
+			kept = append(kept, code)
+		}
+	}
+
+	for _, hash := range codeHashes {
+		kept = append(kept, recoveryCode{userID: userID, codeHash: hash})
+	}
+
+	m.recoveryCodes = kept
+}
+
+func (m *memoryDBRepo) UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.recoveryCodes {
+		code := &m.recoveryCodes[i]
+		if code.userID == userID && code.codeHash == codeHash && !code.used {
+			code.used = true
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (m *memoryDBRepo) CountRecoveryCodes(ctx context.Context, userID int) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var count int
+	for _, code := range m.recoveryCodes {
+		if code.userID == userID && !code.used {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// endregion
+
+// region "User Sessions"
+func (m *memoryDBRepo) InsertUserSession(ctx context.Context, session models.UserSession) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session.ID = m.nextID("user_sessions")
+	session.CreatedAt = time.Now()
+	session.LastSeenAt = session.CreatedAt
+	m.userSessions = append(m.userSessions, session)
+
+	return session.ID, nil
+}
+
+func (m *memoryDBRepo) GetUserSessionByKey(ctx context.Context, key string) (models.UserSession, error) {
+	if err := ctx.Err(); err != nil {
+		return models.UserSession{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, session := range m.userSessions {
+		if session.Key == key {
+			return session, nil
+		}
+	}
+
+	return models.UserSession{}, sql.ErrNoRows
+}
+
+func (m *memoryDBRepo) GetActiveUserSessions(ctx context.Context, userID int) ([]models.UserSession, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+
+	var sessions []models.UserSession
+	for _, session := range m.userSessions {
+		if session.UserID == userID && session.IsActive(now) {
+			sessions = append(sessions, session)
+		}
+	}
+
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+
+	return sessions, nil
+}
+
+func (m *memoryDBRepo) TouchUserSession(ctx context.Context, id int, ip string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.userSessions {
+		if m.userSessions[i].ID == id {
+			m.userSessions[i].LastSeenAt = time.Now()
+			m.userSessions[i].IPAddress = ip
+		}
+	}
+
+	return nil
+}
+
+func (m *memoryDBRepo) RevokeUserSession(ctx context.Context, userID, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.userSessions {
+		session := &m.userSessions[i]
+		if session.ID == id && session.UserID == userID {
+			if session.RevokedAt.IsZero() {
+				session.RevokedAt = time.Now()
+			}
+			return nil
+		}
+	}
+
+	return sql.ErrNoRows
+}
+
+func (m *memoryDBRepo) RevokeUserSessions(ctx context.Context, userID, keepID int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for i := range m.userSessions {
+		session := &m.userSessions[i]
+		if session.UserID == userID && session.ID != keepID && session.RevokedAt.IsZero() {
+			session.RevokedAt = now
+		}
+	}
+
+	return nil
+}
+
+// endregion
+
+// region "API Keys"
+func (m *memoryDBRepo) InsertAPIKey(ctx context.Context, key models.APIKey) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// api_keys.created_by references users
+	if m.userIndex(key.CreatedBy) < 0 {
+		return 0, fmt.Errorf("user %d does not exist", key.CreatedBy)
+	}
+
+	key.ID = m.nextID("api_keys")
+	key.Scopes = append([]string(nil), key.Scopes...)
+	key.CreatedAt = time.Now()
+	m.apiKeys = append(m.apiKeys, key)
+
+	return key.ID, nil
+}
+
+func (m *memoryDBRepo) GetAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var keys []models.APIKey
+	for i := len(m.apiKeys) - 1; i >= 0; i-- {
+		keys = append(keys, m.withCreator(m.apiKeys[i]))
+	}
+
+	return keys, nil
+}
+
+func (m *memoryDBRepo) GetAPIKeyByHash(ctx context.Context, keyHash string) (models.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return models.APIKey{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, key := range m.apiKeys {
+		if key.KeyHash == keyHash {
+			return m.withCreator(key), nil
+		}
+	}
+
+	return models.APIKey{}, sql.ErrNoRows
+}
+
+func (m *memoryDBRepo) TouchAPIKey(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.apiKeys {
+		if m.apiKeys[i].ID == id {
+			m.apiKeys[i].LastUsedAt = time.Now()
+		}
+	}
+
+	return nil
+}
+
+func (m *memoryDBRepo) RevokeAPIKey(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.apiKeys {
+		key := &m.apiKeys[i]
+		if key.ID == id {
+			if key.RevokedAt.IsZero() {
+				key.RevokedAt = time.Now()
+			}
+			return nil
+		}
+	}
+
+	return sql.ErrNoRows
+}
+
+// withCreator fills in the name of the user who created key, like the join in the
+// postgres queries. The caller must hold mu.
+func (m *memoryDBRepo) withCreator(key models.APIKey) models.APIKey {
+	if i := m.userIndex(key.CreatedBy); i >= 0 {
+		key.CreatedByName = m.users[i].FirstName + " " + m.users[i].LastName
+	}
+	key.Scopes = append([]string(nil), key.Scopes...)
+
+	return key
+}
+
+// endregion
+
+// region "Mail Outbox"
+func (m *memoryDBRepo) InsertOutboxMessage(ctx context.Context, msg models.OutboxMessage) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.addOutboxMessage(msg), nil
+}
+
+// addOutboxMessage stores a new pending message. The caller must hold mu.
+func (m *memoryDBRepo) addOutboxMessage(msg models.OutboxMessage) int {
+	now := time.Now()
+
+	msg.ID = m.nextID("mail_outbox")
+	msg.Status = models.OutboxPending
+	msg.Attempts = 0
+	msg.LastError = ""
+	msg.CreatedAt = now
+	msg.UpdatedAt = now
+	msg.SentAt = time.Time{}
+	if msg.NextAttemptAt.IsZero() {
+		msg.NextAttemptAt = now
+	}
+	m.outbox = append(m.outbox, msg)
+
+	return msg.ID
+}
+
+func (m *memoryDBRepo) ClaimOutboxMessages(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxMessage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+
+	var due []int
+	for i, msg := range m.outbox {
+		if msg.Status == models.OutboxPending && !msg.NextAttemptAt.After(now) {
+			due = append(due, i)
+		}
+	}
+
+	sort.SliceStable(due, func(a, b int) bool {
+		return m.outbox[due[a]].NextAttemptAt.Before(m.outbox[due[b]].NextAttemptAt)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	var messages []models.OutboxMessage
+	for _, i := range due {
+		msg := &m.outbox[i]
+		msg.Attempts++
+		msg.NextAttemptAt = now.Add(lease)
+		msg.UpdatedAt = now
+
+		messages = append(messages, *msg)
+	}
+
+	sort.Slice(messages, func(i, j int) bool { return messages[i].ID < messages[j].ID })
+
+	return messages, nil
+}
+
+func (m *memoryDBRepo) MarkOutboxMessageSent(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if i := m.outboxIndex(id); i >= 0 {
+		now := time.Now()
+
+		m.outbox[i].Status = models.OutboxSent
+		m.outbox[i].SentAt = now
+		m.outbox[i].UpdatedAt = now
+		m.outbox[i].LastError = ""
+	}
+
+	return nil
+}
+
+func (m *memoryDBRepo) FailOutboxMessage(ctx context.Context, id int, lastError string, retryAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.outboxIndex(id)
+	if i < 0 || m.outbox[i].Status != models.OutboxPending {
+		return nil
+	}
+
+	msg := &m.outbox[i]
+	msg.LastError = lastError
+	msg.UpdatedAt = time.Now()
+
+	if retryAt.IsZero() {
+		msg.Status = models.OutboxDead
+	} else {
+		msg.NextAttemptAt = retryAt
+	}
+
+	return nil
+}
+
+func (m *memoryDBRepo) GetOutboxMessages(ctx context.Context, status string, limit int) ([]models.OutboxMessage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var messages []models.OutboxMessage
+	for i := len(m.outbox) - 1; i >= 0 && len(messages) < limit; i-- {
+		if status == "" || m.outbox[i].Status == status {
+			messages = append(messages, m.outbox[i])
+		}
+	}
+
+	return messages, nil
+}
+
+func (m *memoryDBRepo) RetryOutboxMessage(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.outboxIndex(id)
+	if i < 0 || !m.outbox[i].CanRetry() {
+		return sql.ErrNoRows
+	}
+
+	now := time.Now()
+
+	msg := &m.outbox[i]
+	msg.Status = models.OutboxPending
+	msg.Attempts = 0
+	msg.NextAttemptAt = now
+	msg.UpdatedAt = now
+
+	return nil
+}
+
+func (m *memoryDBRepo) DiscardOutboxMessage(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.outboxIndex(id)
+	if i < 0 || !m.outbox[i].CanRetry() {
+		return sql.ErrNoRows
+	}
+
+	m.outbox[i].Status = models.OutboxDiscarded
+	m.outbox[i].UpdatedAt = time.Now()
+
+	return nil
+}
+
+func (m *memoryDBRepo) outboxIndex(id int) int {
+	for i := range m.outbox {
+		if m.outbox[i].ID == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// endregion
+
+// region "Password Resets"
+func (m *memoryDBRepo) InsertPasswordReset(ctx context.Context, reset models.PasswordReset, outbox ...models.OutboxMessage) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	reset.ID = m.nextID("password_resets")
+	reset.UsedAt = time.Time{}
+	reset.CreatedAt = time.Now()
+	m.passwordResets = append(m.passwordResets, reset)
+
+	for _, msg := range outbox {
+		m.addOutboxMessage(msg)
+	}
+
+	return reset.ID, nil
+}
+
+func (m *memoryDBRepo) GetPasswordReset(ctx context.Context, tokenHash string) (models.PasswordReset, error) {
+	if err := ctx.Err(); err != nil {
+		return models.PasswordReset{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, reset := range m.passwordResets {
+		if reset.TokenHash == tokenHash {
+			return reset, nil
+		}
+	}
+
+	return models.PasswordReset{}, sql.ErrNoRows
+}
+
+func (m *memoryDBRepo) ResetPassword(ctx context.Context, tokenHash, passwordHash string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, reset := range m.passwordResets {
+		if reset.TokenHash != tokenHash || !reset.IsUsable(time.Now()) {
+			continue
+		}
+
+		for _, u := range m.users {
+			if u.ID == reset.UserID && u.IsActive() {
+				m.setPassword(u.ID, passwordHash)
+				return u.ID, nil
+			}
+		}
+	}
+
+	return 0, sql.ErrNoRows
+}
+
+// endregion
+
+// region "Rooms"
+func (m *memoryDBRepo) sortedRooms(include func(models.Room) bool) []models.Room {
+	var rooms []models.Room
+	for _, rm := range m.rooms {
+		if include(rm) {
+			rooms = append(rooms, rm)
+		}
+	}
+
+	sort.SliceStable(rooms, func(i, j int) bool {
+		return rooms[i].RoomName < rooms[j].RoomName
+	})
+
+	return rooms
+}
+
+func (m *memoryDBRepo) GetAllRooms(ctx context.Context) ([]models.Room, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.sortedRooms(func(models.Room) bool { return true }), nil
+}
+
+func (m *memoryDBRepo) GetActiveRooms(ctx context.Context) ([]models.Room, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.sortedRooms(func(rm models.Room) bool { return !rm.IsArchived() }), nil
+}
+
+func (m *memoryDBRepo) GetRoomByID(ctx context.Context, id int) (models.Room, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Room{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	i := m.roomIndex(id)
+	if i < 0 {
+		return models.Room{}, sql.ErrNoRows
+	}
+
+	return m.rooms[i], nil
+}
+
+func (m *memoryDBRepo) GetRoomBySlug(ctx context.Context, slug string) (models.Room, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Room{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, rm := range m.rooms {
+		if rm.Slug == slug {
+			return rm, nil
+		}
+	}
+
+	return models.Room{}, sql.ErrNoRows
+}
+
+// slugTaken mirrors the unique index on rooms.slug
+func (m *memoryDBRepo) slugTaken(slug string, exceptID int) bool {
+	for _, rm := range m.rooms {
+		if rm.Slug == slug && rm.ID != exceptID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *memoryDBRepo) InsertRoom(ctx context.Context, room models.Room) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.slugTaken(room.Slug, 0) {
+		return 0, fmt.Errorf("slug %s is already used", room.Slug)
+	}
+
+	now := time.Now()
+
+	room.ID = m.nextID("rooms")
+	room.ArchivedAt = time.Time{}
+	room.CalendarToken = ""
+	room.CreatedAt = now
+	room.UpdatedAt = now
+	m.rooms = append(m.rooms, room)
+
+	return room.ID, nil
+}
+
+func (m *memoryDBRepo) UpdateRoom(ctx context.Context, room models.Room) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.roomIndex(room.ID)
+	if i < 0 {
+		return nil
+	}
+
+	if m.slugTaken(room.Slug, room.ID) {
+		return fmt.Errorf("slug %s is already used", room.Slug)
+	}
+
+	rm := &m.rooms[i]
+	rm.RoomName = room.RoomName
+	rm.Slug = room.Slug
+	rm.Description = room.Description
+	rm.Capacity = room.Capacity
+	rm.NightlyRate = room.NightlyRate
+	rm.WeekendRate = room.WeekendRate
+	rm.Amenities = room.Amenities
+	rm.Photos = room.Photos
+	rm.UpdatedAt = time.Now()
+
+	return nil
+}
+
+func (m *memoryDBRepo) ArchiveRoom(ctx context.Context, id int, archived bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.roomIndex(id)
+	if i < 0 {
+		return nil
+	}
+
+	m.rooms[i].ArchivedAt = time.Time{}
+	if archived {
+		m.rooms[i].ArchivedAt = time.Now()
+	}
+	m.rooms[i].UpdatedAt = time.Now()
+
+	return nil
+}
+
+func (m *memoryDBRepo) GetRoomByCalendarToken(ctx context.Context, token string) (models.Room, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Room{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, rm := range m.rooms {
+		if token != "" && rm.CalendarToken == token {
+			return rm, nil
+		}
+	}
+
+	return models.Room{}, sql.ErrNoRows
+}
+
+func (m *memoryDBRepo) SetRoomCalendarToken(ctx context.Context, id int, token string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if i := m.roomIndex(id); i >= 0 {
+		m.rooms[i].CalendarToken = token
+		m.rooms[i].UpdatedAt = time.Now()
+	}
+
+	return nil
+}
+
+// endregion
+
+// region "Seasonal Rates"
+func (m *memoryDBRepo) GetSeasonalRatesForRoom(ctx context.Context, roomID int) ([]models.SeasonalRate, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var rates []models.SeasonalRate
+	for _, rate := range m.seasonalRates {
+		if rate.RoomID == roomID {
+			rates = append(rates, rate)
+		}
+	}
+
+	sort.SliceStable(rates, func(i, j int) bool {
+		return rates[i].StartDate.Before(rates[j].StartDate)
+	})
+
+	return rates, nil
+}
+
+func (m *memoryDBRepo) InsertSeasonalRate(ctx context.Context, rate models.SeasonalRate) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.roomIndex(rate.RoomID) < 0 {
+		return 0, fmt.Errorf("room %d does not exist", rate.RoomID)
+	}
+
+	now := time.Now()
+
+	rate.ID = m.nextID("seasonal_rates")
+	rate.CreatedAt = now
+	rate.UpdatedAt = now
+	m.seasonalRates = append(m.seasonalRates, rate)
+
+	return rate.ID, nil
+}
+
+func (m *memoryDBRepo) DeleteSeasonalRate(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.seasonalRates[:0]
+	for _, rate := range m.seasonalRates {
+		if rate.ID != id {
+			kept = append(kept, rate)
+		}
+	}
+	m.seasonalRates = kept
+
+	return nil
+}
+
+// endregion
+
+// region "Reservations"
+func (m *memoryDBRepo) GetAllReservations(ctx context.Context, status string) ([]models.Reservation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var reservations []models.Reservation
+	for _, r := range m.reservations {
+		if status != "" && r.Status != status {
+			continue
+		}
+
+		reservations = append(reservations, m.withRoom(r))
+	}
+
+	sort.SliceStable(reservations, func(i, j int) bool {
+		return reservations[i].CreatedAt.Before(reservations[j].CreatedAt)
+	})
+
+	return reservations, nil
+}
+
+// withRoom fills in the room the way the sql join does
+func (m *memoryDBRepo) withRoom(r models.Reservation) models.Reservation {
+	if i := m.roomIndex(r.RoomID); i >= 0 {
+		r.Room.ID = m.rooms[i].ID
+		r.Room.RoomName = m.rooms[i].RoomName
+	}
+
+	return r
+}
+
+func (m *memoryDBRepo) GetReservationById(ctx context.Context, id int) (models.Reservation, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Reservation{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	i := m.reservationIndex(id)
+	if i < 0 {
+		return models.Reservation{}, sql.ErrNoRows
+	}
+
+	return m.withRoom(m.reservations[i]), nil
+}
+
+func (m *memoryDBRepo) GetReservationByReference(ctx context.Context, reference, email string) (models.Reservation, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Reservation{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, r := range m.reservations {
+		if r.Reference == reference && strings.EqualFold(r.Email, email) {
+			return m.withRoom(r), nil
+		}
+	}
+
+	return models.Reservation{}, sql.ErrNoRows
+}
+
+func (m *memoryDBRepo) InsertReservation(ctx context.Context, res models.Reservation) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// reservations.room_id references rooms
+	i := m.roomIndex(res.RoomID)
+	if i < 0 {
+		return 0, fmt.Errorf("room %d does not exist", res.RoomID)
+	}
+
+	// archived rooms cannot be booked
+	if m.rooms[i].IsArchived() {
+		return 0, &repository.BookingConflictError{
+			RoomID:    res.RoomID,
+			StartDate: res.StartDate,
+			EndDate:   res.EndDate,
+		}
+	}
+
+	res.ID = m.nextID("reservations")
+	res.Status = models.StatusPending
+	res.Sequence = 0
+	res.CreatedAt = time.Now()
+	res.UpdatedAt = time.Now()
+	res.Room = models.Room{}
+
+	m.reservations = append(m.reservations, res)
+
+	return res.ID, nil
+}
+
+// CreateBooking checks availability and stores the reservation, its room restriction
+// and the outbox messages under a single lock
+func (m *memoryDBRepo) CreateBooking(ctx context.Context, res models.Reservation, outbox ...models.OutboxMessage) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.roomIndex(res.RoomID)
+	if i < 0 {
+		return 0, fmt.Errorf("room %d does not exist", res.RoomID)
+	}
+
+	// archived rooms cannot be booked
+	if m.rooms[i].IsArchived() {
+		return 0, &repository.BookingConflictError{
+			RoomID:    res.RoomID,
+			StartDate: res.StartDate,
+			EndDate:   res.EndDate,
+		}
+	}
+
+	for _, rr := range m.roomRestrictions {
+		if rr.RoomID == res.RoomID && overlaps(res.StartDate, res.EndDate, rr) {
+			return 0, &repository.BookingConflictError{
+				RoomID:    res.RoomID,
+				StartDate: res.StartDate,
+				EndDate:   res.EndDate,
+			}
+		}
+	}
+
+	now := time.Now()
+
+	res.ID = m.nextID("reservations")
+	res.Status = models.StatusPending
+	res.Sequence = 0
+	res.CreatedAt = now
+	res.UpdatedAt = now
+	res.Room = models.Room{}
+	m.reservations = append(m.reservations, res)
+	m.addStatusChange(res.ID, "", models.StatusPending, 0, "")
+
+	m.roomRestrictions = append(m.roomRestrictions, models.RoomRestriction{
+		ID:            m.nextID("room_restrictions"),
+		StartDate:     res.StartDate,
+		EndDate:       res.EndDate,
+		RoomID:        res.RoomID,
+		ReservationID: res.ID,
+		RestrictionID: 1,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	})
+
+	for _, msg := range outbox {
+		m.addOutboxMessage(msg)
+	}
+
+	return res.ID, nil
+}
+
+// ChangeBookingDates moves a reservation and its room restriction and queues the outbox
+// messages under a single lock, ignoring the reservation's own dates when looking for overlaps
+func (m *memoryDBRepo) ChangeBookingDates(ctx context.Context, res models.Reservation, outbox ...models.OutboxMessage) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	conflict := &repository.BookingConflictError{
+		RoomID:    res.RoomID,
+		StartDate: res.StartDate,
+		EndDate:   res.EndDate,
+	}
+
+	room := m.roomIndex(res.RoomID)
+	if room < 0 || m.rooms[room].IsArchived() {
+		return conflict
+	}
+
+	i := m.reservationIndex(res.ID)
+	if i < 0 {
+		return sql.ErrNoRows
+	}
+
+	// staff may have cancelled the booking since the guest loaded it
+	if found := m.reservations[i]; (found.Status != models.StatusPending && found.Status != models.StatusConfirmed) ||
+		!found.CancellationRequestedAt.IsZero() {
+		return &repository.BookingClosedError{ID: res.ID, Status: found.Status}
+	}
+
+	for _, rr := range m.roomRestrictions {
+		if rr.RoomID == res.RoomID && rr.ReservationID != res.ID && overlaps(res.StartDate, res.EndDate, rr) {
+			return conflict
+		}
+	}
+
+	now := time.Now()
+
+	m.reservations[i].StartDate = res.StartDate
+	m.reservations[i].EndDate = res.EndDate
+	m.reservations[i].Quote = res.Quote
+	m.reservations[i].Sequence++
+	m.reservations[i].UpdatedAt = now
+
+	for j := range m.roomRestrictions {
+		rr := &m.roomRestrictions[j]
+		if rr.ReservationID == res.ID && rr.RestrictionID == 1 {
+			rr.StartDate = res.StartDate
+			rr.EndDate = res.EndDate
+			rr.UpdatedAt = now
+		}
+	}
+
+	for _, msg := range outbox {
+		m.addOutboxMessage(msg)
+	}
+
+	return nil
+}
+
+func (m *memoryDBRepo) RequestCancellation(ctx context.Context, id int, outbox ...models.OutboxMessage) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if i := m.reservationIndex(id); i >= 0 && m.reservations[i].CancellationRequestedAt.IsZero() {
+		m.reservations[i].CancellationRequestedAt = time.Now()
+		m.reservations[i].UpdatedAt = time.Now()
+
+		for _, msg := range outbox {
+			m.addOutboxMessage(msg)
+		}
+	}
+
+	return nil
+}
+
+func (m *memoryDBRepo) UpdateReservation(ctx context.Context, r models.Reservation, outbox ...models.OutboxMessage) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if i := m.reservationIndex(r.ID); i >= 0 {
+		m.reservations[i].FirstName = r.FirstName
+		m.reservations[i].LastName = r.LastName
+		m.reservations[i].Email = r.Email
+		m.reservations[i].Phone = r.Phone
+		m.reservations[i].Sequence++
+		m.reservations[i].UpdatedAt = time.Now()
+
+		for _, msg := range outbox {
+			m.addOutboxMessage(msg)
+		}
+	}
+
+	return nil
+}
+
+// TransitionReservation moves a reservation to a new status and records the change.
+// Cancelling frees the reservation's room restrictions. The outbox messages are queued with it.
+func (m *memoryDBRepo) TransitionReservation(ctx context.Context, id int, to string, userID int, note string, outbox ...models.OutboxMessage) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.reservationIndex(id)
+	if i < 0 {
+		return sql.ErrNoRows
+	}
+
+	from := m.reservations[i].Status
+	if !models.CanTransition(from, to) {
+		return &repository.InvalidTransitionError{From: from, To: to}
+	}
+
+	m.reservations[i].Status = to
+	m.reservations[i].Sequence++
+	m.reservations[i].UpdatedAt = time.Now()
+
+	if to == models.StatusCancelled {
+		kept := m.roomRestrictions[:0]
+		for _, rr := range m.roomRestrictions {
+			if rr.ReservationID != id {
+				kept = append(kept, rr)
+			}
+		}
+		m.roomRestrictions = kept
+	}
+
+	m.addStatusChange(id, from, to, userID, note)
+
+	for _, msg := range outbox {
+		m.addOutboxMessage(msg)
+	}
+
+	return nil
+}
+
+func (m *memoryDBRepo) GetReservationHistory(ctx context.Context, id int) ([]models.ReservationStatusChange, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var history []models.ReservationStatusChange
+	for _, c := range m.statusChanges {
+		if c.ReservationID == id {
+			history = append(history, c)
+		}
+	}
+
+	return history, nil
+}
+
+// addStatusChange appends to the status history; the caller holds the write lock
+func (m *memoryDBRepo) addStatusChange(reservationID int, from, to string, userID int, note string) {
+	m.statusChanges = append(m.statusChanges, models.ReservationStatusChange{
+		ID:            m.nextID("reservation_status_changes"),
+		ReservationID: reservationID,
+		FromStatus:    from,
+		ToStatus:      to,
+		Note:          note,
+		UserID:        userID,
+		CreatedAt:     time.Now(),
+	})
+}
+
+// endregion
+
+// region "Room Restrictions"
+func (m *memoryDBRepo) InsertRoomRestriction(ctx context.Context, res models.RoomRestriction) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.roomIndex(res.RoomID) < 0 {
+		return fmt.Errorf("room %d does not exist", res.RoomID)
+	}
+
+	if res.ReservationID > 0 && m.reservationIndex(res.ReservationID) < 0 {
+		return fmt.Errorf("reservation %d does not exist", res.ReservationID)
+	}
+
+	// the room_restrictions_no_overlap constraint
+	for _, rr := range m.roomRestrictions {
+		if rr.RoomID == res.RoomID && overlaps(res.StartDate, res.EndDate, rr) {
+			return &repository.BookingConflictError{
+				RoomID:    res.RoomID,
+				StartDate: res.StartDate,
+				EndDate:   res.EndDate,
+			}
+		}
+	}
+
+	res.ID = m.nextID("room_restrictions")
+	res.CreatedAt = time.Now()
+	res.UpdatedAt = time.Now()
+
+	m.roomRestrictions = append(m.roomRestrictions, res)
+
+	return nil
+}
+
+func (m *memoryDBRepo) GetRestrictionsForRoomByDate(ctx context.Context, roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var restrictions []models.RoomRestriction
+	for _, rr := range m.roomRestrictions {
+		// $1 < end_date and $2 >= start_date
+		if rr.RoomID == roomID && start.Before(rr.EndDate) && !end.Before(rr.StartDate) {
+			restrictions = append(restrictions, models.RoomRestriction{
+				ID:            rr.ID,
+				ReservationID: rr.ReservationID,
+				RestrictionID: rr.RestrictionID,
+				RoomID:        rr.RoomID,
+				StartDate:     rr.StartDate,
+				EndDate:       rr.EndDate,
+			})
+		}
+	}
+
+	return restrictions, nil
+}
+
+func (m *memoryDBRepo) GetCalendarForRoom(ctx context.Context, roomID int, since time.Time) ([]models.RoomRestriction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var restrictions []models.RoomRestriction
+	for _, rr := range m.roomRestrictions {
+		if rr.RoomID != roomID || !rr.EndDate.After(since) {
+			continue
+		}
+
+		rr.Room = models.Room{}
+		rr.Reservation = models.Reservation{}
+		if i := m.reservationIndex(rr.ReservationID); rr.ReservationID > 0 && i >= 0 {
+			res := m.reservations[i]
+			rr.Reservation = models.Reservation{
+				ID:        res.ID,
+				FirstName: res.FirstName,
+				LastName:  res.LastName,
+				RoomID:    rr.RoomID,
+				StartDate: rr.StartDate,
+				EndDate:   rr.EndDate,
+				Status:    res.Status,
+				Reference: res.Reference,
+				Sequence:  res.Sequence,
+				UpdatedAt: res.UpdatedAt,
+			}
+		}
+
+		restrictions = append(restrictions, rr)
+	}
+
+	sort.Slice(restrictions, func(i, j int) bool {
+		if !restrictions[i].StartDate.Equal(restrictions[j].StartDate) {
+			return restrictions[i].StartDate.Before(restrictions[j].StartDate)
+		}
+		return restrictions[i].ID < restrictions[j].ID
+	})
+
+	return restrictions, nil
+}
+
+func (m *memoryDBRepo) InsertBlockForRoom(ctx context.Context, id int, startDate time.Time) error {
+	return m.InsertRoomRestriction(ctx, models.RoomRestriction{
+		StartDate:     startDate,
+		EndDate:       startDate.AddDate(0, 0, 1),
+		RoomID:        id,
+		RestrictionID: 2,
+	})
+}
+
+func (m *memoryDBRepo) DeleteBlocksForRoom(ctx context.Context, id int, blocks string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ids := map[int]bool{}
+	for _, x := range strings.Split(blocks, ",") {
+		blockID, err := strconv.Atoi(strings.TrimSpace(x))
+		if err != nil {
+			return fmt.Errorf("invalid block id %q", x)
+		}
+		ids[blockID] = true
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.roomRestrictions[:0]
+	for _, rr := range m.roomRestrictions {
+		if rr.RoomID == id && ids[rr.ID] {
+			continue
+		}
+		kept = append(kept, rr)
+	}
+	m.roomRestrictions = kept
+
+	return nil
+}
+
+// endregion
+
+// region "Availability"
+func (m *memoryDBRepo) SearchAvailabilityByDatesByRoom(ctx context.Context, start, end time.Time, roomID int) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, rr := range m.roomRestrictions {
+		if rr.RoomID == roomID && overlaps(start, end, rr) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func (m *memoryDBRepo) SearchAvailabilityByDates(ctx context.Context, start, end time.Time) ([]models.Room, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	taken := map[int]bool{}
+	for _, rr := range m.roomRestrictions {
+		if overlaps(start, end, rr) {
+			taken[rr.RoomID] = true
+		}
+	}
+
+	var rooms []models.Room
+	for _, rm := range m.rooms {
+		if !taken[rm.ID] && !rm.IsArchived() {
+			rooms = append(rooms, models.Room{ID: rm.ID, RoomName: rm.RoomName})
+		}
+	}
+
+	return rooms, nil
+}
+
+//endregion
@@ -0,0 +1,672 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/patrickoliveros/bookings/internal/repository"
+	"github.com/patrickoliveros/bookings/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func date(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+func TestMemoryRepo_Availability(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo(nil)
+
+	id, err := repo.InsertReservation(ctx, models.Reservation{
+		FirstName: "John",
+		LastName:  "Smith",
+		Email:     "john@here.com",
+		StartDate: date("2021-10-10"),
+		EndDate:   date("2021-10-12"),
+		RoomID:    1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.InsertRoomRestriction(ctx, models.RoomRestriction{
+		StartDate:     date("2021-10-10"),
+		EndDate:       date("2021-10-12"),
+		RoomID:        1,
+		ReservationID: id,
+		RestrictionID: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name      string
+		start     string
+		end       string
+		available bool
+	}{
+		{"before", "2021-10-08", "2021-10-10", true},
+		{"after", "2021-10-12", "2021-10-14", true},
+		{"overlapping start", "2021-10-09", "2021-10-11", false},
+		{"overlapping end", "2021-10-11", "2021-10-13", false},
+		{"inside", "2021-10-10", "2021-10-11", false},
+		{"surrounding", "2021-10-01", "2021-10-20", false},
+	}
+
+	for _, e := range tests {
+		available, err := repo.SearchAvailabilityByDatesByRoom(ctx, date(e.start), date(e.end), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if available != e.available {
+			t.Errorf("%s: expected available %v, got %v", e.name, e.available, available)
+		}
+
+		rooms, _ := repo.SearchAvailabilityByDates(ctx, date(e.start), date(e.end))
+		expectedRooms := 1
+		if e.available {
+			expectedRooms = 2
+		}
+
+		if len(rooms) != expectedRooms {
+			t.Errorf("%s: expected %d free rooms, got %d", e.name, expectedRooms, len(rooms))
+		}
+	}
+
+	// cancelling the reservation frees its dates
+	_ = repo.TransitionReservation(ctx, id, models.StatusCancelled, 0, "")
+
+	available, _ := repo.SearchAvailabilityByDatesByRoom(ctx, date("2021-10-10"), date("2021-10-12"), 1)
+	if !available {
+		t.Error("room should be available after its reservation is cancelled")
+	}
+}
+
+func TestMemoryRepo_Blocks(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo(nil)
+
+	_ = repo.InsertBlockForRoom(ctx, 2, date("2021-11-05"))
+
+	restrictions, _ := repo.GetRestrictionsForRoomByDate(ctx, 2, date("2021-11-01"), date("2021-11-30"))
+	if len(restrictions) != 1 {
+		t.Fatalf("expected 1 block, got %d", len(restrictions))
+	}
+
+	if restrictions[0].ReservationID != 0 || restrictions[0].RestrictionID != 2 {
+		t.Errorf("unexpected block %+v", restrictions[0])
+	}
+
+	// a room cannot be blocked twice for the same night, nor booked over a block
+	err := repo.InsertBlockForRoom(ctx, 2, date("2021-11-05"))
+
+	var conflict *repository.BookingConflictError
+	if !errors.As(err, &conflict) {
+		t.Errorf("expected a BookingConflictError for the same night, got %v", err)
+	}
+
+	err = repo.InsertRoomRestriction(ctx, models.RoomRestriction{
+		StartDate:     date("2021-11-04"),
+		EndDate:       date("2021-11-06"),
+		RoomID:        2,
+		RestrictionID: 1,
+	})
+	if !errors.As(err, &conflict) {
+		t.Errorf("expected a BookingConflictError over the block, got %v", err)
+	}
+
+	if err = repo.InsertBlockForRoom(ctx, 2, date("2021-11-06")); err != nil {
+		t.Errorf("expected the next night to be free, got %v", err)
+	}
+
+	_ = repo.DeleteBlocksForRoom(ctx, 2, "1, 2")
+
+	restrictions, _ = repo.GetRestrictionsForRoomByDate(ctx, 2, date("2021-11-01"), date("2021-11-30"))
+	if len(restrictions) != 0 {
+		t.Errorf("expected block to be deleted, got %d", len(restrictions))
+	}
+}
+
+func TestMemoryRepo_CalendarFeed(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo(nil)
+
+	if _, err := repo.GetRoomByCalendarToken(ctx, ""); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected no room for an empty token, got %v", err)
+	}
+
+	_ = repo.SetRoomCalendarToken(ctx, 1, "secret")
+	if room, err := repo.GetRoomByCalendarToken(ctx, "secret"); err != nil || room.ID != 1 {
+		t.Errorf("expected room 1 for its token, got %d %v", room.ID, err)
+	}
+
+	_ = repo.InsertBlockForRoom(ctx, 1, date("2022-02-10"))
+	_ = repo.InsertBlockForRoom(ctx, 1, date("2021-12-01"))
+	_, _ = repo.CreateBooking(ctx, models.Reservation{
+		FirstName: "Jane",
+		Reference: "A1B2C3D4",
+		StartDate: date("2022-02-01"),
+		EndDate:   date("2022-02-03"),
+		RoomID:    1,
+	})
+
+	restrictions, _ := repo.GetCalendarForRoom(ctx, 1, date("2022-01-01"))
+	if len(restrictions) != 2 {
+		t.Fatalf("expected the booking and the block ahead, got %+v", restrictions)
+	}
+
+	if res := restrictions[0].Reservation; res.Reference != "A1B2C3D4" || res.Status != models.StatusPending {
+		t.Errorf("expected the booking first with its reservation, got %+v", restrictions[0])
+	}
+	if restrictions[1].ReservationID != 0 || restrictions[1].Reservation.Reference != "" {
+		t.Errorf("expected the block last, got %+v", restrictions[1])
+	}
+
+	_ = repo.SetRoomCalendarToken(ctx, 1, "")
+	if _, err := repo.GetRoomByCalendarToken(ctx, "secret"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected the old token to stop working, got %v", err)
+	}
+}
+
+func TestMemoryRepo_Authenticate(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo(nil)
+
+	id, name, _, err := repo.Authenticate(ctx, MemoryAdminEmail, MemoryAdminPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id != 1 || name != "Admin User" {
+		t.Errorf("unexpected user %d %s", id, name)
+	}
+
+	if _, _, _, err = repo.Authenticate(ctx, MemoryAdminEmail, "wrong"); err == nil {
+		t.Error("expected an error for a wrong password")
+	}
+
+	if _, _, _, err = repo.Authenticate(ctx, "nobody@here.com", MemoryAdminPassword); err == nil {
+		t.Error("expected an error for an unknown email")
+	}
+
+	// emails are matched the way GetUserByEmail matches them
+	if id, _, _, err = repo.Authenticate(ctx, strings.ToUpper(MemoryAdminEmail), MemoryAdminPassword); err != nil || id != 1 {
+		t.Errorf("expected the email to match in any case, got %d %v", id, err)
+	}
+
+	if _, err = repo.InsertUser(ctx, models.User{Email: strings.ToUpper(MemoryAdminEmail)}); err == nil {
+		t.Error("expected an error for an email that differs only in case")
+	}
+}
+
+func TestMemoryRepo_Users(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo(nil)
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	user := models.User{FirstName: "Desk", LastName: "Clerk", Email: "desk@here.com", Password: string(hash), AccessLevel: 1}
+
+	id, err := repo.InsertUser(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = repo.InsertUser(ctx, user); err == nil {
+		t.Error("expected an error for a duplicate email")
+	}
+
+	if found, err := repo.GetUserByEmail(ctx, "DESK@here.com"); err != nil || found.ID != id {
+		t.Errorf("expected to find user %d by email, got %d %v", id, found.ID, err)
+	}
+
+	_ = repo.DeactivateUser(ctx, id, true)
+
+	if _, _, _, err = repo.Authenticate(ctx, "desk@here.com", "secret"); err == nil {
+		t.Error("a deactivated user should not log in")
+	}
+
+	users, _ := repo.GetAllUsers(ctx)
+	if len(users) != 2 || users[1].ID != id {
+		t.Errorf("expected the deactivated user last, got %+v", users)
+	}
+
+	_ = repo.DeactivateUser(ctx, id, false)
+
+	if _, _, _, err = repo.Authenticate(ctx, "desk@here.com", "secret"); err != nil {
+		t.Errorf("a reactivated user should log in, got %v", err)
+	}
+}
+
+func TestMemoryRepo_ResetPassword(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo(nil)
+
+	_, _ = repo.InsertPasswordReset(ctx, models.PasswordReset{UserID: 1, TokenHash: "old", ExpiresAt: time.Now().Add(-time.Minute)})
+	_, _ = repo.InsertPasswordReset(ctx, models.PasswordReset{UserID: 1, TokenHash: "first", ExpiresAt: time.Now().Add(time.Hour)})
+	_, _ = repo.InsertPasswordReset(ctx, models.PasswordReset{UserID: 1, TokenHash: "second", ExpiresAt: time.Now().Add(time.Hour)})
+
+	if _, err := repo.ResetPassword(ctx, "old", "hash"); err != sql.ErrNoRows {
+		t.Errorf("an expired link should not work, got %v", err)
+	}
+
+	id, err := repo.ResetPassword(ctx, "first", "hash")
+	if err != nil || id != 1 {
+		t.Fatalf("expected user 1, got %d %v", id, err)
+	}
+
+	user, _ := repo.GetUserByID(ctx, 1)
+	if user.Password != "hash" || user.PasswordChangedAt.IsZero() {
+		t.Errorf("expected the password to change, got %+v", user)
+	}
+
+	// using one link uses up the others
+	for _, token := range []string{"first", "second"} {
+		if _, err := repo.ResetPassword(ctx, token, "again"); err != sql.ErrNoRows {
+			t.Errorf("%s: expected the link to be used up, got %v", token, err)
+		}
+	}
+}
+
+func TestMemoryRepo_InsertPasswordResetOutbox(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo(nil)
+
+	_, err := repo.InsertPasswordReset(ctx, models.PasswordReset{UserID: 1, TokenHash: "hash", ExpiresAt: time.Now().Add(time.Hour)},
+		models.OutboxMessage{To: "admin@admin.com", Subject: "Reset your password"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if messages, _ := repo.GetOutboxMessages(ctx, "", 10); len(messages) != 1 || messages[0].Subject != "Reset your password" {
+		t.Errorf("expected the reset email to be queued with the link, got %+v", messages)
+	}
+}
+
+func TestMemoryRepo_LoginAttempts(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo(nil)
+	since := time.Now().Add(-time.Minute)
+
+	_ = repo.RecordLoginAttempt(ctx, models.LoginAttempt{Email: "admin@here.com", UserID: 1, IPAddress: "10.0.0.1"})
+	_ = repo.RecordLoginAttempt(ctx, models.LoginAttempt{Email: "nobody@here.com", IPAddress: "10.0.0.1"})
+	_ = repo.RecordLoginAttempt(ctx, models.LoginAttempt{Email: "admin@here.com", UserID: 1, IPAddress: "10.0.0.1", Succeeded: true})
+	_ = repo.RecordLoginAttempt(ctx, models.LoginAttempt{Email: "admin@here.com", UserID: 1, IPAddress: "10.0.0.2"})
+
+	count, latest, err := repo.GetFailedLoginsByIP(ctx, "10.0.0.1", since)
+	if err != nil || count != 2 || latest.IsZero() {
+		t.Errorf("expected 2 failures from 10.0.0.1, got %d %v %v", count, latest, err)
+	}
+
+	attempts, _ := repo.GetLoginAttempts(ctx, 3)
+	if len(attempts) != 3 || attempts[0].IPAddress != "10.0.0.2" {
+		t.Errorf("expected the 3 newest attempts first, got %+v", attempts)
+	}
+
+	for i := 1; i <= 3; i++ {
+		if n, _ := repo.IncrementFailedLogins(ctx, 1); n != i {
+			t.Errorf("expected %d failed logins, got %d", i, n)
+		}
+	}
+
+	_ = repo.LockUser(ctx, 1, time.Now().Add(time.Minute))
+	user, _ := repo.GetUserByID(ctx, 1)
+	if !user.IsLocked(time.Now()) {
+		t.Error("expected the user to be locked")
+	}
+
+	_ = repo.UnlockUser(ctx, 1)
+	user, _ = repo.GetUserByID(ctx, 1)
+	if user.IsLocked(time.Now()) || user.FailedLogins != 0 {
+		t.Errorf("expected the user to be unlocked, got %+v", user)
+	}
+}
+
+func TestMemoryRepo_TwoFactor(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo(nil)
+
+	_ = repo.EnableTwoFactor(ctx, 1, "SECRET", []string{"a", "b"})
+
+	user, _ := repo.GetUserByID(ctx, 1)
+	if !user.HasTwoFactor() || user.TOTPEnabledAt.IsZero() {
+		t.Fatalf("expected two-factor to be on, got %+v", user)
+	}
+
+	if ok, _ := repo.UseTOTPStep(ctx, 1, 100); !ok {
+		t.Error("expected a new step to be accepted")
+	}
+	if ok, _ := repo.UseTOTPStep(ctx, 1, 100); ok {
+		t.Error("expected a used step to be refused")
+	}
+
+	if ok, _ := repo.UseRecoveryCode(ctx, 1, "a"); !ok {
+		t.Error("expected the recovery code to work")
+	}
+	if ok, _ := repo.UseRecoveryCode(ctx, 1, "a"); ok {
+		t.Error("expected a used recovery code to be refused")
+	}
+	if n, _ := repo.CountRecoveryCodes(ctx, 1); n != 1 {
+		t.Errorf("expected 1 recovery code left, got %d", n)
+	}
+
+	_ = repo.DisableTwoFactor(ctx, 1)
+
+	user, _ = repo.GetUserByID(ctx, 1)
+	if n, _ := repo.CountRecoveryCodes(ctx, 1); user.HasTwoFactor() || n != 0 {
+		t.Errorf("expected two-factor to be off with no recovery codes, got %+v and %d codes", user, n)
+	}
+}
+
+func TestMemoryRepo_UserSessions(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo(nil)
+	expires := time.Now().Add(time.Hour)
+
+	first, _ := repo.InsertUserSession(ctx, models.UserSession{UserID: 1, Key: "first", ExpiresAt: expires})
+	second, _ := repo.InsertUserSession(ctx, models.UserSession{UserID: 1, Key: "second", ExpiresAt: expires})
+	_, _ = repo.InsertUserSession(ctx, models.UserSession{UserID: 1, Key: "expired", ExpiresAt: time.Now().Add(-time.Minute)})
+
+	if sessions, _ := repo.GetActiveUserSessions(ctx, 1); len(sessions) != 2 {
+		t.Errorf("expected 2 active sessions, got %+v", sessions)
+	}
+
+	if err := repo.RevokeUserSession(ctx, 2, first); err != sql.ErrNoRows {
+		t.Errorf("another user should not revoke the session, got %v", err)
+	}
+
+	_ = repo.RevokeUserSessions(ctx, 1, second)
+
+	session, _ := repo.GetUserSessionByKey(ctx, "first")
+	if session.IsActive(time.Now()) {
+		t.Error("expected the first session to be revoked")
+	}
+
+	session, _ = repo.GetUserSessionByKey(ctx, "second")
+	if !session.IsActive(time.Now()) {
+		t.Error("expected the kept session to stay active")
+	}
+}
+
+func TestMemoryRepo_APIKeys(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo(nil)
+
+	if _, err := repo.InsertAPIKey(ctx, models.APIKey{Name: "orphan", KeyHash: "x", CreatedBy: 99}); err == nil {
+		t.Error("expected an error for a key created by an unknown user")
+	}
+
+	id, _ := repo.InsertAPIKey(ctx, models.APIKey{Name: "partner", KeyHash: "hash", Scopes: []string{models.ScopeReadAvailability}, CreatedBy: 1})
+
+	key, err := repo.GetAPIKeyByHash(ctx, "hash")
+	if err != nil || key.ID != id || key.CreatedByName == "" || !key.HasScope(models.ScopeReadAvailability) {
+		t.Fatalf("expected the key with its creator and scope, got %+v %v", key, err)
+	}
+
+	if err := repo.RevokeAPIKey(ctx, 99); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows revoking an unknown key, got %v", err)
+	}
+
+	_ = repo.RevokeAPIKey(ctx, id)
+
+	if keys, _ := repo.GetAPIKeys(ctx); len(keys) != 1 || keys[0].IsActive() {
+		t.Errorf("expected the revoked key to still be listed, got %+v", keys)
+	}
+}
+
+func TestMemoryRepo_MailOutbox(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo(nil)
+
+	res := models.Reservation{Email: "john@here.com", StartDate: date("2021-12-01"), EndDate: date("2021-12-05"), RoomID: 1}
+	confirmation := models.OutboxMessage{To: "john@here.com", Subject: "Confirmation"}
+
+	_, _ = repo.CreateBooking(ctx, res, confirmation)
+	_, _ = repo.CreateBooking(ctx, res, confirmation)
+
+	if messages, _ := repo.GetOutboxMessages(ctx, "", 10); len(messages) != 1 {
+		t.Fatalf("expected only the booking that was made to queue its email, got %d", len(messages))
+	}
+
+	later, _ := repo.InsertOutboxMessage(ctx, models.OutboxMessage{To: "desk@here.com", NextAttemptAt: time.Now().Add(time.Hour)})
+
+	claimed, _ := repo.ClaimOutboxMessages(ctx, 10, time.Minute)
+	if len(claimed) != 1 || claimed[0].Attempts != 1 || claimed[0].ID == later {
+		t.Fatalf("expected the due message with its attempt counted, got %+v", claimed)
+	}
+
+	if again, _ := repo.ClaimOutboxMessages(ctx, 10, time.Minute); len(again) != 0 {
+		t.Errorf("expected a claimed message to be left alone during its lease, got %+v", again)
+	}
+
+	id := claimed[0].ID
+	_ = repo.FailOutboxMessage(ctx, id, "550 no such user", time.Time{})
+
+	if dead, _ := repo.GetOutboxMessages(ctx, models.OutboxDead, 10); len(dead) != 1 || dead[0].LastError != "550 no such user" {
+		t.Fatalf("expected the message to be dead with its error, got %+v", dead)
+	}
+
+	if err := repo.RetryOutboxMessage(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+
+	claimed, _ = repo.ClaimOutboxMessages(ctx, 10, time.Minute)
+	if len(claimed) != 1 || claimed[0].Attempts != 1 {
+		t.Fatalf("expected the retried message to be due with fresh attempts, got %+v", claimed)
+	}
+
+	_ = repo.MarkOutboxMessageSent(ctx, id)
+
+	if err := repo.DiscardOutboxMessage(ctx, id); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows discarding a sent message, got %v", err)
+	}
+	if err := repo.DiscardOutboxMessage(ctx, later); err != nil {
+		t.Errorf("expected a pending message to be discarded, got %v", err)
+	}
+
+	if sent, _ := repo.GetOutboxMessages(ctx, models.OutboxSent, 10); len(sent) != 1 || sent[0].SentAt.IsZero() {
+		t.Errorf("expected the message to be sent, got %+v", sent)
+	}
+}
+
+func TestMemoryRepo_CancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	repo := NewMemoryRepo(nil)
+
+	if _, err := repo.GetAllRooms(ctx); err == nil {
+		t.Error("expected an error for a cancelled context")
+	}
+}
+
+func TestMemoryRepo_CreateBookingConflict(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo(nil)
+
+	res := models.Reservation{
+		FirstName: "John",
+		LastName:  "Smith",
+		Email:     "john@here.com",
+		StartDate: date("2021-12-01"),
+		EndDate:   date("2021-12-05"),
+		RoomID:    1,
+	}
+
+	id, err := repo.CreateBooking(ctx, res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restrictions, _ := repo.GetRestrictionsForRoomByDate(ctx, 1, date("2021-12-01"), date("2021-12-31"))
+	if len(restrictions) != 1 || restrictions[0].ReservationID != id {
+		t.Errorf("expected a restriction for reservation %d, got %+v", id, restrictions)
+	}
+
+	res.StartDate = date("2021-12-04")
+	res.EndDate = date("2021-12-06")
+
+	_, err = repo.CreateBooking(ctx, res)
+
+	var conflict *repository.BookingConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("expected a BookingConflictError, got %v", err)
+	}
+
+	// checking in on the departure day is fine
+	res.StartDate = date("2021-12-05")
+
+	if _, err = repo.CreateBooking(ctx, res); err != nil {
+		t.Errorf("expected booking from the departure day to succeed, got %v", err)
+	}
+}
+
+func TestMemoryRepo_ChangeBookingDates(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo(nil)
+
+	res := models.Reservation{
+		Email:     "john@here.com",
+		Reference: "A1B2C3D4",
+		StartDate: date("2022-01-10"),
+		EndDate:   date("2022-01-12"),
+		RoomID:    1,
+	}
+
+	id, _ := repo.CreateBooking(ctx, res)
+
+	other := res
+	other.Reference = "E5F6G7H8"
+	other.StartDate = date("2022-01-20")
+	other.EndDate = date("2022-01-22")
+	_, _ = repo.CreateBooking(ctx, other)
+
+	found, err := repo.GetReservationByReference(ctx, "A1B2C3D4", "JOHN@here.com")
+	if err != nil || found.ID != id {
+		t.Fatalf("expected to find reservation %d by reference, got %d %v", id, found.ID, err)
+	}
+
+	if _, err = repo.GetReservationByReference(ctx, "A1B2C3D4", "someone@else.com"); err == nil {
+		t.Error("expected no reservation for another email")
+	}
+
+	// overlapping its own dates is fine
+	found.StartDate = date("2022-01-11")
+	found.EndDate = date("2022-01-14")
+	if err = repo.ChangeBookingDates(ctx, found); err != nil {
+		t.Fatalf("expected the dates to change, got %v", err)
+	}
+
+	restrictions, _ := repo.GetRestrictionsForRoomByDate(ctx, 1, date("2022-01-01"), date("2022-01-31"))
+	for _, rr := range restrictions {
+		if rr.ReservationID == id && !rr.EndDate.Equal(date("2022-01-14")) {
+			t.Errorf("expected the restriction to move with the reservation, got %+v", rr)
+		}
+	}
+
+	found.EndDate = date("2022-01-21")
+
+	var conflict *repository.BookingConflictError
+	if err = repo.ChangeBookingDates(ctx, found, models.OutboxMessage{To: "john@here.com"}); !errors.As(err, &conflict) {
+		t.Errorf("expected a BookingConflictError, got %v", err)
+	}
+
+	if found, _ = repo.GetReservationById(ctx, id); found.Sequence != 1 {
+		t.Errorf("expected only the change that was made to count, got sequence %d", found.Sequence)
+	}
+
+	if messages, _ := repo.GetOutboxMessages(ctx, "", 10); len(messages) != 0 {
+		t.Errorf("expected no email for a change that was not made, got %+v", messages)
+	}
+
+	notice := models.OutboxMessage{To: "desk@here.com", Subject: "Cancellation requested"}
+	_ = repo.RequestCancellation(ctx, id, notice)
+	_ = repo.RequestCancellation(ctx, id, notice)
+
+	if messages, _ := repo.GetOutboxMessages(ctx, "", 10); len(messages) != 1 {
+		t.Errorf("expected the first request only to queue its email, got %+v", messages)
+	}
+
+	// a booking the guest asked to cancel, or staff cancelled, keeps its dates
+	found.EndDate = date("2022-01-15")
+
+	var closed *repository.BookingClosedError
+	if err = repo.ChangeBookingDates(ctx, found); !errors.As(err, &closed) {
+		t.Errorf("expected a BookingClosedError after the cancellation request, got %v", err)
+	}
+
+	_ = repo.TransitionReservation(ctx, id, models.StatusCancelled, 0, "")
+
+	if err = repo.ChangeBookingDates(ctx, found); !errors.As(err, &closed) || closed.Status != models.StatusCancelled {
+		t.Errorf("expected a BookingClosedError for the cancelled booking, got %v", err)
+	}
+
+	found.ID = 99
+	if err = repo.ChangeBookingDates(ctx, found); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows for an unknown reservation, got %v", err)
+	}
+}
+
+func TestMemoryRepo_TransitionReservation(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo(nil)
+
+	id, err := repo.CreateBooking(ctx, models.Reservation{
+		FirstName: "Jane",
+		StartDate: date("2021-12-01"),
+		EndDate:   date("2021-12-03"),
+		RoomID:    1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notice := models.OutboxMessage{To: "jane@here.com", Subject: "Checked in"}
+
+	if err = repo.TransitionReservation(ctx, id, models.StatusCheckedIn, 0, "", notice); err == nil {
+		t.Error("a pending reservation should not be checked in")
+	}
+
+	var invalid *repository.InvalidTransitionError
+	if !errors.As(err, &invalid) {
+		t.Errorf("expected an InvalidTransitionError, got %v", err)
+	}
+
+	if messages, _ := repo.GetOutboxMessages(ctx, "", 10); len(messages) != 0 {
+		t.Errorf("expected no email for a change that was not made, got %+v", messages)
+	}
+
+	for _, status := range []string{models.StatusConfirmed, models.StatusCheckedIn, models.StatusCheckedOut} {
+		if err := repo.TransitionReservation(ctx, id, status, 1, "desk"); err != nil {
+			t.Fatalf("%s: %v", status, err)
+		}
+	}
+
+	res, _ := repo.GetReservationById(ctx, id)
+	if res.Status != models.StatusCheckedOut || res.Sequence != 3 {
+		t.Errorf("expected checked-out after 3 changes, got %s and sequence %d", res.Status, res.Sequence)
+	}
+
+	history, _ := repo.GetReservationHistory(ctx, id)
+	if len(history) != 4 || history[0].ToStatus != models.StatusPending || history[3].FromStatus != models.StatusCheckedIn {
+		t.Errorf("unexpected history %+v", history)
+	}
+
+	pending, _ := repo.GetAllReservations(ctx, models.StatusPending)
+	if len(pending) != 0 {
+		t.Errorf("expected no pending reservations, got %d", len(pending))
+	}
+
+	res.Phone = "555-0100"
+	_ = repo.UpdateReservation(ctx, res, models.OutboxMessage{To: "desk@here.com", Subject: "Contact details changed"})
+
+	if messages, _ := repo.GetOutboxMessages(ctx, "", 10); len(messages) != 1 || messages[0].Subject != "Contact details changed" {
+		t.Errorf("expected the update to queue its email, got %+v", messages)
+	}
+}
@@ -2,31 +2,40 @@ package dbrepo
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
-	"strings"
+	"sort"
 	"time"
 
+	"github.com/jackc/pgconn"
+	"github.com/patrickoliveros/bookings/internal/repository"
 	"github.com/patrickoliveros/bookings/models"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// region "Users"
-func (m *postgresDBRepo) GetAllUsers() bool {
-	return true
+// exclusionViolation is the postgres error code raised by an exclusion constraint
+const exclusionViolation = "23P01"
+
+func isExclusionViolation(err error) bool {
+	var pgErr *pgconn.PgError
+
+	return errors.As(err, &pgErr) && pgErr.Code == exclusionViolation
 }
 
-func (m *postgresDBRepo) GetUserByID(id int) (models.User, error) {
+// region "Users"
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+// userColumns are selected by every user query and read back with scanUser
+const userColumns = `id, first_name, last_name, email, password, access_level, deactivated_at,
+	password_changed_at, failed_logins, locked_until, totp_secret, totp_enabled_at, totp_last_step,
+	created_at, updated_at`
 
+func scanUser(row scanner) (models.User, error) {
 	var user models.User
+	var deactivatedAt, passwordChangedAt, lockedUntil, totpEnabledAt sql.NullTime
 
-	query := `select id, first_name, last_name, email, password, access_level from users where id = $1`
-
-	row := m.DB.QueryRowContext(ctx, query, id)
 	err := row.Scan(
 		&user.ID,
 		&user.FirstName,
@@ -34,288 +43,1877 @@ func (m *postgresDBRepo) GetUserByID(id int) (models.User, error) {
 		&user.Email,
 		&user.Password,
 		&user.AccessLevel,
+		&deactivatedAt,
+		&passwordChangedAt,
+		&user.FailedLogins,
+		&lockedUntil,
+		&user.TOTPSecret,
+		&totpEnabledAt,
+		&user.TOTPLastStep,
+		&user.CreatedAt,
+		&user.UpdatedAt,
 	)
 
+	user.DeactivatedAt = deactivatedAt.Time
+	user.PasswordChangedAt = passwordChangedAt.Time
+	user.LockedUntil = lockedUntil.Time
+	user.TOTPEnabledAt = totpEnabledAt.Time
+
+	return user, err
+}
+
+// GetAllUsers returns every user, active ones first, then by name
+func (m *postgresDBRepo) GetAllUsers(ctx context.Context) ([]models.User, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var users []models.User
+
+	query := `select ` + userColumns + ` from users
+		order by deactivated_at is not null, first_name, last_name`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return users, err
+		}
+
+		users = append(users, user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return users, err
+	}
+
+	return users, nil
+}
+
+func (m *postgresDBRepo) GetUserByID(ctx context.Context, id int) (models.User, error) {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `select ` + userColumns + ` from users where id = $1`
+
+	return scanUser(m.DB.QueryRowContext(ctx, query, id))
+}
+
+// GetUserByEmail finds a user by email, ignoring case
+func (m *postgresDBRepo) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `select ` + userColumns + ` from users where lower(email) = lower($1)`
+
+	return scanUser(m.DB.QueryRowContext(ctx, query, email))
+}
+
+// InsertUser adds a user; u.Password must already be hashed
+func (m *postgresDBRepo) InsertUser(ctx context.Context, u models.User) (int, error) {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var newID int
+
+	stmt := `insert into users (first_name, last_name, email, password, access_level, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt, u.FirstName, u.LastName, u.Email, u.Password, u.AccessLevel,
+		time.Now(), time.Now()).Scan(&newID)
+
+	return newID, err
+}
+
+func (m *postgresDBRepo) UpdateUser(ctx context.Context, u models.User) error {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		update users set first_name = $2, last_name = $3, 
+		email = $4, password = $5, access_level = $6, updated_at = $7 where id = $1`
+
+	_, err := m.DB.ExecContext(ctx, query, u.ID, u.FirstName, u.LastName, u.Email, u.Password, u.AccessLevel, time.Now())
+
+	return err
+}
+
+// DeactivateUser stops a user from logging in, or lets them back in when deactivated is false
+func (m *postgresDBRepo) DeactivateUser(ctx context.Context, id int, deactivated bool) error {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var deactivatedAt sql.NullTime
+	if deactivated {
+		deactivatedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	}
+
+	query := `update users set deactivated_at = $2, updated_at = $3 where id = $1`
+
+	_, err := m.DB.ExecContext(ctx, query, id, deactivatedAt, time.Now())
+
+	return err
+}
+
+// UpdatePassword sets a new password hash, which ends the user's other sessions and
+// any reset links they still have
+func (m *postgresDBRepo) UpdatePassword(ctx context.Context, id int, passwordHash string) error {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = setPassword(ctx, tx, id, passwordHash); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func setPassword(ctx context.Context, tx *sql.Tx, id int, passwordHash string) error {
+	now := time.Now()
+
+	_, err := tx.ExecContext(ctx, `update users set password = $2, password_changed_at = $3, updated_at = $3 where id = $1`,
+		id, passwordHash, now)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `update password_resets set used_at = $2 where user_id = $1 and used_at is null`, id, now)
+
+	return err
+}
+
+func (m *postgresDBRepo) Authenticate(ctx context.Context, email, testPassword string) (int, string, string, error) {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var id int
+	var hashedPassword, firstName, lastName string
+
+	query := `select id, password, first_name, last_name from users
+		where lower(email) = lower($1) and deactivated_at is null`
+
+	row := m.DB.QueryRowContext(ctx, query, email)
+	err := row.Scan(&id, &hashedPassword, &firstName, &lastName)
+
+	if err != nil {
+		return id, "", "", err
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(testPassword))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return 0, "", "", errors.New("incorrect password")
+	} else if err != nil {
+		return 0, "", "", err
+	}
+
+	return id, fmt.Sprintf("%s %s", firstName, lastName), hashedPassword, nil
+}
+
+// endregion
+
+// region "Login Attempts"
+
+// RecordLoginAttempt adds a login to the audit log
+func (m *postgresDBRepo) RecordLoginAttempt(ctx context.Context, attempt models.LoginAttempt) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var userID sql.NullInt64
+	if attempt.UserID > 0 {
+		userID = sql.NullInt64{Int64: int64(attempt.UserID), Valid: true}
+	}
+
+	stmt := `insert into login_attempts (email, user_id, ip_address, succeeded, created_at)
+		values ($1, $2, $3, $4, $5)`
+
+	_, err := m.DB.ExecContext(ctx, stmt, attempt.Email, userID, attempt.IPAddress, attempt.Succeeded, time.Now())
+
+	return err
+}
+
+// GetLoginAttempts returns the most recent logins, newest first
+func (m *postgresDBRepo) GetLoginAttempts(ctx context.Context, limit int) ([]models.LoginAttempt, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var attempts []models.LoginAttempt
+
+	query := `
+		select id, email, coalesce(user_id, 0), ip_address, succeeded, created_at
+			from login_attempts
+				order by created_at desc, id desc
+					limit $1`
+
+	rows, err := m.DB.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var attempt models.LoginAttempt
+
+		err := rows.Scan(
+			&attempt.ID,
+			&attempt.Email,
+			&attempt.UserID,
+			&attempt.IPAddress,
+			&attempt.Succeeded,
+			&attempt.CreatedAt,
+		)
+
+		if err != nil {
+			return attempts, err
+		}
+
+		attempts = append(attempts, attempt)
+	}
+
+	if err = rows.Err(); err != nil {
+		return attempts, err
+	}
+
+	return attempts, nil
+}
+
+// GetFailedLoginsByIP counts the failed logins from an address since a time, and
+// returns when the latest of them happened
+func (m *postgresDBRepo) GetFailedLoginsByIP(ctx context.Context, ip string, since time.Time) (int, time.Time, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var count int
+	var latest sql.NullTime
+
+	query := `
+		select count(id), max(created_at)
+			from login_attempts
+				where ip_address = $1 and succeeded = false and created_at > $2`
+
+	err := m.DB.QueryRowContext(ctx, query, ip, since).Scan(&count, &latest)
+
+	return count, latest.Time, err
+}
+
+// IncrementFailedLogins adds one to a user's failed logins and returns the new count
+func (m *postgresDBRepo) IncrementFailedLogins(ctx context.Context, userID int) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var failures int
+
+	query := `update users set failed_logins = failed_logins + 1 where id = $1 returning failed_logins`
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&failures)
+
+	return failures, err
+}
+
+// LockUser stops a user from logging in until the given time
+func (m *postgresDBRepo) LockUser(ctx context.Context, userID int, until time.Time) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `update users set locked_until = $2 where id = $1`, userID, until)
+
+	return err
+}
+
+// UnlockUser clears a user's failed logins and lock
+func (m *postgresDBRepo) UnlockUser(ctx context.Context, userID int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `update users set failed_logins = 0, locked_until = null where id = $1`, userID)
+
+	return err
+}
+
+// endregion
+
+// region "Two-Factor Authentication"
+
+// EnableTwoFactor stores a user's TOTP secret and gives them a new set of recovery codes
+func (m *postgresDBRepo) EnableTwoFactor(ctx context.Context, userID int, secret string, recoveryCodeHashes []string) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	_, err = tx.ExecContext(ctx, `update users set totp_secret = $2, totp_enabled_at = $3, totp_last_step = 0, updated_at = $3
+		where id = $1`, userID, secret, now)
+	if err != nil {
+		return err
+	}
+
+	if err = replaceRecoveryCodes(ctx, tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DisableTwoFactor removes a user's TOTP secret and recovery codes
+func (m *postgresDBRepo) DisableTwoFactor(ctx context.Context, userID int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `update users set totp_secret = '', totp_enabled_at = null, totp_last_step = 0, updated_at = $2
+		where id = $1`, userID, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if err = replaceRecoveryCodes(ctx, tx, userID, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseTOTPStep records that a code period was used. It returns false when that period,
+// or a later one, was already used.
+func (m *postgresDBRepo) UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `update users set totp_last_step = $2 where id = $1 and totp_last_step < $2`,
+		userID, step)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+
+	return rows == 1, err
+}
+
+// ReplaceRecoveryCodes throws away a user's recovery codes and stores new ones
+func (m *postgresDBRepo) ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return user, err
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int, codeHashes []string) error {
+	if _, err := tx.ExecContext(ctx, `delete from recovery_codes where user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, hash := range codeHashes {
+		_, err := tx.ExecContext(ctx, `insert into recovery_codes (user_id, code_hash, created_at) values ($1, $2, $3)`,
+			userID, hash, now)
+		if err != nil {
+			return err
+		}
 	}
 
-	return user, nil
+	return nil
 }
 
-func (m *postgresDBRepo) UpdateUser(u models.User) error {
+// UseRecoveryCode marks one of a user's recovery codes as used. It returns false when
+// the code is unknown or was used before.
+func (m *postgresDBRepo) UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `update recovery_codes set used_at = $3
+		where user_id = $1 and code_hash = $2 and used_at is null`, userID, codeHash, time.Now())
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	return rows > 0, err
+}
+
+// CountRecoveryCodes returns how many of a user's recovery codes are unused
+func (m *postgresDBRepo) CountRecoveryCodes(ctx context.Context, userID int) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
-	query := `
-		update users set first_name = $2, last_name = $3, 
-		email = $4, password = $5, access_level = $6, updated_at = $7 where id = $1`
+	var count int
+
+	err := m.DB.QueryRowContext(ctx, `select count(id) from recovery_codes where user_id = $1 and used_at is null`,
+		userID).Scan(&count)
+
+	return count, err
+}
+
+// endregion
+
+// region "User Sessions"
+
+const userSessionColumns = `id, user_id, session_key, user_agent, ip_address, created_at, last_seen_at, expires_at, revoked_at`
+
+func scanUserSession(row scanner) (models.UserSession, error) {
+	var session models.UserSession
+	var revokedAt sql.NullTime
+
+	err := row.Scan(
+		&session.ID,
+		&session.UserID,
+		&session.Key,
+		&session.UserAgent,
+		&session.IPAddress,
+		&session.CreatedAt,
+		&session.LastSeenAt,
+		&session.ExpiresAt,
+		&revokedAt,
+	)
+
+	session.RevokedAt = revokedAt.Time
+
+	return session, err
+}
+
+// InsertUserSession records a new staff login
+func (m *postgresDBRepo) InsertUserSession(ctx context.Context, session models.UserSession) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var newID int
+	now := time.Now()
+
+	stmt := `insert into user_sessions (user_id, session_key, user_agent, ip_address, created_at, last_seen_at, expires_at)
+		values ($1, $2, $3, $4, $5, $5, $6) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		session.UserID,
+		session.Key,
+		session.UserAgent,
+		session.IPAddress,
+		now,
+		session.ExpiresAt,
+	).Scan(&newID)
+
+	return newID, err
+}
+
+// GetUserSessionByKey returns a staff session by the key kept in its scs session
+func (m *postgresDBRepo) GetUserSessionByKey(ctx context.Context, key string) (models.UserSession, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `select ` + userSessionColumns + ` from user_sessions where session_key = $1`
+
+	return scanUserSession(m.DB.QueryRowContext(ctx, query, key))
+}
+
+// GetActiveUserSessions returns a user's sessions that are neither revoked nor expired,
+// most recently used first
+func (m *postgresDBRepo) GetActiveUserSessions(ctx context.Context, userID int) ([]models.UserSession, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var sessions []models.UserSession
+
+	query := `select ` + userSessionColumns + ` from user_sessions
+		where user_id = $1 and revoked_at is null and expires_at > $2
+			order by last_seen_at desc`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		session, err := scanUserSession(rows)
+		if err != nil {
+			return sessions, err
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return sessions, err
+	}
+
+	return sessions, nil
+}
+
+// TouchUserSession records that a session was just used, and from where
+func (m *postgresDBRepo) TouchUserSession(ctx context.Context, id int, ip string) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `update user_sessions set last_seen_at = $2, ip_address = $3 where id = $1`,
+		id, time.Now(), ip)
+
+	return err
+}
+
+// RevokeUserSession ends one of a user's sessions; it returns sql.ErrNoRows when the
+// user has no such session
+func (m *postgresDBRepo) RevokeUserSession(ctx context.Context, userID, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `update user_sessions set revoked_at = coalesce(revoked_at, $3)
+		where id = $1 and user_id = $2`, id, userID, time.Now())
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err == nil && rows == 0 {
+		err = sql.ErrNoRows
+	}
+
+	return err
+}
+
+// RevokeUserSessions ends all of a user's sessions except keepID, which can be 0
+func (m *postgresDBRepo) RevokeUserSessions(ctx context.Context, userID, keepID int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `update user_sessions set revoked_at = $3
+		where user_id = $1 and id <> $2 and revoked_at is null`, userID, keepID, time.Now())
+
+	return err
+}
+
+// endregion
+
+// region "API Keys"
+
+const apiKeyColumns = `k.id, k.name, k.prefix, k.key_hash, k.scopes, k.created_by, u.first_name || ' ' || u.last_name,
+	k.created_at, k.last_used_at, k.revoked_at`
+
+func scanAPIKey(row scanner) (models.APIKey, error) {
+	var key models.APIKey
+	var scopes []byte
+	var lastUsedAt, revokedAt sql.NullTime
+
+	err := row.Scan(
+		&key.ID,
+		&key.Name,
+		&key.Prefix,
+		&key.KeyHash,
+		&scopes,
+		&key.CreatedBy,
+		&key.CreatedByName,
+		&key.CreatedAt,
+		&lastUsedAt,
+		&revokedAt,
+	)
+	if err != nil {
+		return key, err
+	}
+
+	key.LastUsedAt = lastUsedAt.Time
+	key.RevokedAt = revokedAt.Time
+
+	return key, json.Unmarshal(scopes, &key.Scopes)
+}
+
+// InsertAPIKey stores a new API key
+func (m *postgresDBRepo) InsertAPIKey(ctx context.Context, key models.APIKey) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	scopes, err := json.Marshal(key.Scopes)
+	if err != nil {
+		return 0, err
+	}
+
+	var newID int
+
+	stmt := `insert into api_keys (name, prefix, key_hash, scopes, created_by, created_at)
+		values ($1, $2, $3, $4, $5, $6) returning id`
+
+	err = m.DB.QueryRowContext(ctx, stmt,
+		key.Name,
+		key.Prefix,
+		key.KeyHash,
+		string(scopes),
+		key.CreatedBy,
+		time.Now(),
+	).Scan(&newID)
+
+	return newID, err
+}
+
+// GetAPIKeys returns every API key, revoked ones included, newest first
+func (m *postgresDBRepo) GetAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var keys []models.APIKey
+
+	query := `select ` + apiKeyColumns + ` from api_keys k
+		inner join users u on u.id = k.created_by
+			order by k.created_at desc, k.id desc`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return keys, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return keys, err
+	}
+
+	return keys, nil
+}
+
+// GetAPIKeyByHash finds an API key by the hash of the key, whether or not it was revoked
+func (m *postgresDBRepo) GetAPIKeyByHash(ctx context.Context, keyHash string) (models.APIKey, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `select ` + apiKeyColumns + ` from api_keys k
+		inner join users u on u.id = k.created_by
+			where k.key_hash = $1`
+
+	return scanAPIKey(m.DB.QueryRowContext(ctx, query, keyHash))
+}
+
+// TouchAPIKey records that a key was just used
+func (m *postgresDBRepo) TouchAPIKey(ctx context.Context, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `update api_keys set last_used_at = $2 where id = $1`, id, time.Now())
+
+	return err
+}
+
+// RevokeAPIKey stops a key from working; it returns sql.ErrNoRows when there is no such key
+func (m *postgresDBRepo) RevokeAPIKey(ctx context.Context, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `update api_keys set revoked_at = coalesce(revoked_at, $2)
+		where id = $1`, id, time.Now())
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err == nil && rows == 0 {
+		err = sql.ErrNoRows
+	}
+
+	return err
+}
+
+// endregion
+
+// region "Mail Outbox"
+
+// rowQuerier is what *sql.DB and *sql.Tx have in common for queries returning one row
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+const outboxColumns = `id, to_address, from_address, subject, html_body, text_body, status, attempts,
+	next_attempt_at, last_error, created_at, updated_at, sent_at, attachments`
+
+func scanOutboxMessage(row scanner) (models.OutboxMessage, error) {
+	var msg models.OutboxMessage
+	var sentAt sql.NullTime
+	var attachments []byte
+
+	err := row.Scan(
+		&msg.ID,
+		&msg.To,
+		&msg.From,
+		&msg.Subject,
+		&msg.HTMLBody,
+		&msg.TextBody,
+		&msg.Status,
+		&msg.Attempts,
+		&msg.NextAttemptAt,
+		&msg.LastError,
+		&msg.CreatedAt,
+		&msg.UpdatedAt,
+		&sentAt,
+		&attachments,
+	)
+
+	if err != nil {
+		return msg, err
+	}
+
+	msg.SentAt = sentAt.Time
+
+	return msg, json.Unmarshal(attachments, &msg.Attachments)
+}
+
+func insertOutboxMessage(ctx context.Context, q rowQuerier, msg models.OutboxMessage) (int, error) {
+	var newID int
+
+	now := time.Now()
+	if msg.NextAttemptAt.IsZero() {
+		msg.NextAttemptAt = now
+	}
+
+	if msg.Attachments == nil {
+		msg.Attachments = []models.Attachment{}
+	}
+
+	attachments, err := json.Marshal(msg.Attachments)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt := `insert into mail_outbox (to_address, from_address, subject, html_body, text_body, status,
+		next_attempt_at, created_at, updated_at, attachments)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) returning id`
+
+	err = q.QueryRowContext(ctx, stmt,
+		msg.To,
+		msg.From,
+		msg.Subject,
+		msg.HTMLBody,
+		msg.TextBody,
+		models.OutboxPending,
+		msg.NextAttemptAt,
+		now,
+		now,
+		string(attachments),
+	).Scan(&newID)
+
+	return newID, err
+}
+
+// InsertOutboxMessage adds a message to the outbox, due now unless it says otherwise
+func (m *postgresDBRepo) InsertOutboxMessage(ctx context.Context, msg models.OutboxMessage) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	return insertOutboxMessage(ctx, m.DB, msg)
+}
+
+// ClaimOutboxMessages returns up to limit pending messages that are due, counting an attempt
+// for each. They are not due again until the lease has passed, so other workers skip them
+// while they are being sent, and a worker that dies mid-send doesn't lose them.
+func (m *postgresDBRepo) ClaimOutboxMessages(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxMessage, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var messages []models.OutboxMessage
+
+	now := time.Now()
+
+	query := `update mail_outbox set attempts = attempts + 1, next_attempt_at = $2, updated_at = $3
+		where id in (
+			select id from mail_outbox
+			where status = 'pending' and next_attempt_at <= $3
+			order by next_attempt_at, id
+			limit $1
+			for update skip locked)
+		returning ` + outboxColumns
+
+	rows, err := m.DB.QueryContext(ctx, query, limit, now.Add(lease), now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		msg, err := scanOutboxMessage(rows)
+		if err != nil {
+			return messages, err
+		}
+
+		messages = append(messages, msg)
+	}
+
+	if err = rows.Err(); err != nil {
+		return messages, err
+	}
+
+	sort.Slice(messages, func(i, j int) bool { return messages[i].ID < messages[j].ID })
+
+	return messages, nil
+}
+
+// MarkOutboxMessageSent records that a message was delivered
+func (m *postgresDBRepo) MarkOutboxMessageSent(ctx context.Context, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `update mail_outbox set status = 'sent', sent_at = $2, updated_at = $2,
+		last_error = '' where id = $1`, id, time.Now())
+
+	return err
+}
+
+// FailOutboxMessage records why a message could not be sent. It is tried again at retryAt,
+// or, when retryAt is zero, moved to the dead letters.
+func (m *postgresDBRepo) FailOutboxMessage(ctx context.Context, id int, lastError string, retryAt time.Time) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var err error
+
+	if retryAt.IsZero() {
+		_, err = m.DB.ExecContext(ctx, `update mail_outbox set status = 'dead', last_error = $2, updated_at = $3
+			where id = $1 and status = 'pending'`, id, lastError, time.Now())
+	} else {
+		_, err = m.DB.ExecContext(ctx, `update mail_outbox set next_attempt_at = $3, last_error = $2, updated_at = $4
+			where id = $1 and status = 'pending'`, id, lastError, retryAt, time.Now())
+	}
+
+	return err
+}
+
+// GetOutboxMessages returns up to limit messages with the status, or with any status
+// when it is empty, newest first
+func (m *postgresDBRepo) GetOutboxMessages(ctx context.Context, status string, limit int) ([]models.OutboxMessage, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var messages []models.OutboxMessage
+
+	query := `select ` + outboxColumns + ` from mail_outbox
+		where $1 = '' or status = $1
+		order by created_at desc, id desc
+		limit $2`
+
+	rows, err := m.DB.QueryContext(ctx, query, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		msg, err := scanOutboxMessage(rows)
+		if err != nil {
+			return messages, err
+		}
+
+		messages = append(messages, msg)
+	}
+
+	if err = rows.Err(); err != nil {
+		return messages, err
+	}
+
+	return messages, nil
+}
+
+// RetryOutboxMessage makes a pending or dead message due now, with a fresh set of attempts.
+// It returns sql.ErrNoRows when there is no such message or it was sent or discarded.
+func (m *postgresDBRepo) RetryOutboxMessage(ctx context.Context, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `update mail_outbox set status = 'pending', attempts = 0,
+		next_attempt_at = $2, updated_at = $2
+		where id = $1 and status in ('pending', 'dead')`, id, time.Now())
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err == nil && rows == 0 {
+		err = sql.ErrNoRows
+	}
+
+	return err
+}
+
+// DiscardOutboxMessage gives up on a pending or dead message. It returns sql.ErrNoRows
+// when there is no such message or it was sent or discarded.
+func (m *postgresDBRepo) DiscardOutboxMessage(ctx context.Context, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `update mail_outbox set status = 'discarded', updated_at = $2
+		where id = $1 and status in ('pending', 'dead')`, id, time.Now())
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err == nil && rows == 0 {
+		err = sql.ErrNoRows
+	}
+
+	return err
+}
+
+// endregion
+
+// region "Password Resets"
+
+// InsertPasswordReset stores a reset link for a user. The outbox messages, the email with
+// the link, are queued in the same transaction.
+func (m *postgresDBRepo) InsertPasswordReset(ctx context.Context, reset models.PasswordReset, outbox ...models.OutboxMessage) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var newID int
+
+	stmt := `insert into password_resets (user_id, token_hash, expires_at, created_at)
+		values ($1, $2, $3, $4) returning id`
+
+	err = tx.QueryRowContext(ctx, stmt, reset.UserID, reset.TokenHash, reset.ExpiresAt, time.Now()).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, msg := range outbox {
+		if _, err = insertOutboxMessage(ctx, tx, msg); err != nil {
+			return 0, err
+		}
+	}
+
+	return newID, tx.Commit()
+}
+
+// GetPasswordReset finds a reset link by the hash of its token, whether or not it can still be used
+func (m *postgresDBRepo) GetPasswordReset(ctx context.Context, tokenHash string) (models.PasswordReset, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var reset models.PasswordReset
+	var usedAt sql.NullTime
+
+	query := `select id, user_id, token_hash, expires_at, used_at, created_at
+		from password_resets where token_hash = $1`
+
+	err := m.DB.QueryRowContext(ctx, query, tokenHash).Scan(
+		&reset.ID,
+		&reset.UserID,
+		&reset.TokenHash,
+		&reset.ExpiresAt,
+		&usedAt,
+		&reset.CreatedAt,
+	)
+
+	reset.UsedAt = usedAt.Time
+
+	return reset, err
+}
+
+// ResetPassword uses a reset link to set a new password and returns the user's id.
+// Links that are unknown, used or expired, or whose user was deactivated, give sql.ErrNoRows.
+func (m *postgresDBRepo) ResetPassword(ctx context.Context, tokenHash, passwordHash string) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var userID int
+
+	query := `
+		select pr.user_id from password_resets pr
+			inner join users u on u.id = pr.user_id
+				where pr.token_hash = $1 and pr.used_at is null and pr.expires_at > $2
+					and u.deactivated_at is null
+						for update of pr`
+
+	if err = tx.QueryRowContext(ctx, query, tokenHash, time.Now()).Scan(&userID); err != nil {
+		return 0, err
+	}
+
+	if err = setPassword(ctx, tx, userID, passwordHash); err != nil {
+		return 0, err
+	}
+
+	return userID, tx.Commit()
+}
+
+// endregion
+
+// region "Rooms"
+
+// roomColumns are selected by every room query and read back with scanRoom
+const roomColumns = `rm.id, rm.room_name, rm.slug, rm.description, rm.capacity,
+	rm.nightly_rate, rm.weekend_rate, rm.amenities, rm.photos, rm.archived_at,
+	rm.created_at, rm.updated_at, coalesce(rm.calendar_token, '')`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRoom(row scanner) (models.Room, error) {
+	var room models.Room
+	var amenities, photos []byte
+	var archivedAt sql.NullTime
+
+	err := row.Scan(
+		&room.ID,
+		&room.RoomName,
+		&room.Slug,
+		&room.Description,
+		&room.Capacity,
+		&room.NightlyRate,
+		&room.WeekendRate,
+		&amenities,
+		&photos,
+		&archivedAt,
+		&room.CreatedAt,
+		&room.UpdatedAt,
+		&room.CalendarToken,
+	)
+
+	if err != nil {
+		return room, err
+	}
+
+	if err = json.Unmarshal(amenities, &room.Amenities); err != nil {
+		return room, err
+	}
+
+	if err = json.Unmarshal(photos, &room.Photos); err != nil {
+		return room, err
+	}
+
+	if archivedAt.Valid {
+		room.ArchivedAt = archivedAt.Time
+	}
+
+	return room, nil
+}
+
+func (m *postgresDBRepo) queryRooms(ctx context.Context, query string, args ...interface{}) ([]models.Room, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var rooms []models.Room
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item, err := scanRoom(rows)
+		if err != nil {
+			return rooms, err
+		}
+
+		rooms = append(rooms, item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return rooms, err
+	}
+
+	return rooms, nil
+}
+
+// GetAllRooms returns every room, including archived ones
+func (m *postgresDBRepo) GetAllRooms(ctx context.Context) ([]models.Room, error) {
+	query := `
+		select ` + roomColumns + `
+			from rooms rm 
+					order by room_name asc
+		`
+
+	return m.queryRooms(ctx, query)
+}
+
+// GetActiveRooms returns the rooms guests can see and book
+func (m *postgresDBRepo) GetActiveRooms(ctx context.Context) ([]models.Room, error) {
+	query := `
+		select ` + roomColumns + `
+			from rooms rm 
+				where rm.archived_at is null
+					order by room_name asc
+		`
+
+	return m.queryRooms(ctx, query)
+}
+
+func (m *postgresDBRepo) GetRoomByID(ctx context.Context, id int) (models.Room, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `select ` + roomColumns + ` from rooms rm where rm.id = $1`
+
+	return scanRoom(m.DB.QueryRowContext(ctx, query, id))
+}
+
+func (m *postgresDBRepo) GetRoomBySlug(ctx context.Context, slug string) (models.Room, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `select ` + roomColumns + ` from rooms rm where rm.slug = $1`
+
+	return scanRoom(m.DB.QueryRowContext(ctx, query, slug))
+}
+
+func (m *postgresDBRepo) InsertRoom(ctx context.Context, room models.Room) (int, error) {
+	var newID int
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	amenities, photos, err := marshalRoomLists(room)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt := `insert into rooms (room_name, slug, description, capacity, nightly_rate, weekend_rate,
+		amenities, photos, created_at, updated_at) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) returning id`
+
+	err = m.DB.QueryRowContext(ctx, stmt,
+		room.RoomName, room.Slug, room.Description, room.Capacity, room.NightlyRate, room.WeekendRate,
+		amenities, photos, time.Now(), time.Now()).Scan(&newID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+func (m *postgresDBRepo) UpdateRoom(ctx context.Context, room models.Room) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	amenities, photos, err := marshalRoomLists(room)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		update rooms set room_name = $2, slug = $3, description = $4, capacity = $5,
+		nightly_rate = $6, weekend_rate = $7, amenities = $8, photos = $9, updated_at = $10 where id = $1`
+
+	_, err = m.DB.ExecContext(ctx, query,
+		room.ID, room.RoomName, room.Slug, room.Description, room.Capacity,
+		room.NightlyRate, room.WeekendRate, amenities, photos, time.Now())
+
+	return err
+}
+
+// ArchiveRoom hides a room from guests, or brings it back when archived is false.
+// Its reservations and history are kept.
+func (m *postgresDBRepo) ArchiveRoom(ctx context.Context, id int, archived bool) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var archivedAt sql.NullTime
+	if archived {
+		archivedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	}
+
+	query := `update rooms set archived_at = $2, updated_at = $3 where id = $1`
+
+	_, err := m.DB.ExecContext(ctx, query, id, archivedAt, time.Now())
+
+	return err
+}
+
+// GetRoomByCalendarToken returns the room whose calendar feed has the token
+func (m *postgresDBRepo) GetRoomByCalendarToken(ctx context.Context, token string) (models.Room, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `select ` + roomColumns + ` from rooms rm where rm.calendar_token = $1`
+
+	return scanRoom(m.DB.QueryRowContext(ctx, query, token))
+}
+
+// SetRoomCalendarToken gives the room's calendar feed a new address, or turns the
+// feed off when token is empty. The previous address stops working either way.
+func (m *postgresDBRepo) SetRoomCalendarToken(ctx context.Context, id int, token string) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var calendarToken sql.NullString
+	if token != "" {
+		calendarToken = sql.NullString{String: token, Valid: true}
+	}
+
+	query := `update rooms set calendar_token = $2, updated_at = $3 where id = $1`
+
+	_, err := m.DB.ExecContext(ctx, query, id, calendarToken, time.Now())
+
+	return err
+}
+
+// marshalRoomLists encodes the jsonb columns of a room
+func marshalRoomLists(room models.Room) (string, string, error) {
+	amenities := room.Amenities
+	if amenities == nil {
+		amenities = []string{}
+	}
+
+	photos := room.Photos
+	if photos == nil {
+		photos = []string{}
+	}
+
+	a, err := json.Marshal(amenities)
+	if err != nil {
+		return "", "", err
+	}
+
+	p, err := json.Marshal(photos)
+	if err != nil {
+		return "", "", err
+	}
+
+	return string(a), string(p), nil
+}
+
+// endregion
+
+// region "Seasonal Rates"
+
+// GetSeasonalRatesForRoom returns every seasonal rate of a room, earliest first
+func (m *postgresDBRepo) GetSeasonalRatesForRoom(ctx context.Context, roomID int) ([]models.SeasonalRate, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var rates []models.SeasonalRate
+
+	query := `
+		select id, room_id, name, start_date, end_date, nightly_rate, weekend_rate, created_at, updated_at
+			from seasonal_rates 
+				where room_id = $1
+					order by start_date asc, id asc`
+
+	rows, err := m.DB.QueryContext(ctx, query, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.SeasonalRate
+
+		err := rows.Scan(
+			&item.ID,
+			&item.RoomID,
+			&item.Name,
+			&item.StartDate,
+			&item.EndDate,
+			&item.NightlyRate,
+			&item.WeekendRate,
+			&item.CreatedAt,
+			&item.UpdatedAt,
+		)
+
+		if err != nil {
+			return rates, err
+		}
+
+		rates = append(rates, item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return rates, err
+	}
+
+	return rates, nil
+}
+
+func (m *postgresDBRepo) InsertSeasonalRate(ctx context.Context, rate models.SeasonalRate) (int, error) {
+	var newID int
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	stmt := `insert into seasonal_rates (room_id, name, start_date, end_date, nightly_rate, weekend_rate,
+		created_at, updated_at) values ($1, $2, $3, $4, $5, $6, $7, $8) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		rate.RoomID, rate.Name, rate.StartDate, rate.EndDate, rate.NightlyRate, rate.WeekendRate,
+		time.Now(), time.Now()).Scan(&newID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+func (m *postgresDBRepo) DeleteSeasonalRate(ctx context.Context, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `delete from seasonal_rates where id = $1`, id)
+
+	return err
+}
+
+// endregion
+
+// region "Reservations"
+
+// reservationColumns are selected by every reservation query and read back with
+// scanReservation. The queries join rooms as rm.
+const reservationColumns = `r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date,
+		r.end_date, r.room_id, r.status, r.reference, r.quote, r.cancellation_requested_at,
+		r.sequence, r.created_at, r.updated_at, rm.id, rm.room_name`
+
+func scanReservation(row scanner) (models.Reservation, error) {
+	var reservation models.Reservation
+	var quote []byte
+	var cancellationRequestedAt sql.NullTime
+
+	err := row.Scan(
+		&reservation.ID,
+		&reservation.FirstName,
+		&reservation.LastName,
+		&reservation.Email,
+		&reservation.Phone,
+		&reservation.StartDate,
+		&reservation.EndDate,
+		&reservation.RoomID,
+		&reservation.Status,
+		&reservation.Reference,
+		&quote,
+		&cancellationRequestedAt,
+		&reservation.Sequence,
+		&reservation.CreatedAt,
+		&reservation.UpdatedAt,
+		&reservation.Room.ID,
+		&reservation.Room.RoomName,
+	)
+
+	if err != nil {
+		return reservation, err
+	}
+
+	if err = json.Unmarshal(quote, &reservation.Quote); err != nil {
+		return reservation, err
+	}
+
+	if cancellationRequestedAt.Valid {
+		reservation.CancellationRequestedAt = cancellationRequestedAt.Time
+	}
+
+	return reservation, nil
+}
+
+// GetAllReservations returns the reservations with the given status, or every
+// reservation when status is empty, oldest booking first
+func (m *postgresDBRepo) GetAllReservations(ctx context.Context, status string) ([]models.Reservation, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var reservations []models.Reservation
+
+	query := `
+		select ` + reservationColumns + `
+			from reservations r
+				inner join rooms rm on r.room_id  = rm.id 
+					where $1 = '' or r.status = $1
+						order by r.created_at asc`
+
+	rows, err := m.DB.QueryContext(ctx, query, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item, err := scanReservation(rows)
+		if err != nil {
+			return reservations, err
+		}
+
+		reservations = append(reservations, item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+
+	return reservations, nil
+}
+
+func (m *postgresDBRepo) GetReservationById(ctx context.Context, id int) (models.Reservation, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		select ` + reservationColumns + `
+					from reservations r
+						inner join rooms rm on r.room_id  = rm.id 
+			 				where r.id = $1`
+
+	return scanReservation(m.DB.QueryRowContext(ctx, query, id))
+}
+
+// GetReservationByReference finds a reservation by its reference and the guest's email,
+// which must both match. The email is compared without regard to case.
+func (m *postgresDBRepo) GetReservationByReference(ctx context.Context, reference, email string) (models.Reservation, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		select ` + reservationColumns + `
+					from reservations r
+						inner join rooms rm on r.room_id  = rm.id 
+			 				where r.reference = $1 and lower(r.email) = lower($2)`
+
+	return scanReservation(m.DB.QueryRowContext(ctx, query, reference, email))
+}
+
+func (m *postgresDBRepo) InsertReservation(ctx context.Context, res models.Reservation) (int, error) {
+	var newID int
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	stmt := `insert into reservations (first_name, last_name, email, phone,
+		start_date, end_date, room_id, reference, quote, total_amount, created_at, updated_at) values
+		($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) returning id `
+
+	quote, err := json.Marshal(res.Quote)
+	if err != nil {
+		return 0, err
+	}
+
+	err = m.DB.QueryRowContext(ctx, stmt,
+		res.FirstName, res.LastName, res.Email, res.Phone,
+		res.StartDate, res.EndDate, res.RoomID, res.Reference,
+		string(quote), res.Quote.Total, time.Now(), time.Now()).Scan(&newID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// CreateBooking inserts the reservation and its room restriction in one transaction.
+// The room row is locked so concurrent bookings for it run one after the other, and
+// the room_restrictions_no_overlap constraint backs this up inside the database.
+// The outbox messages are added in the same transaction, so they exist only if the booking does.
+func (m *postgresDBRepo) CreateBooking(ctx context.Context, res models.Reservation, outbox ...models.OutboxMessage) (int, error) {
+	var newID int
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	conflict := &repository.BookingConflictError{
+		RoomID:    res.RoomID,
+		StartDate: res.StartDate,
+		EndDate:   res.EndDate,
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// archived rooms cannot be booked
+	var lockedID int
+
+	err = tx.QueryRowContext(ctx, `select id from rooms where id = $1 and archived_at is null for update`, res.RoomID).Scan(&lockedID)
+	if err == sql.ErrNoRows {
+		return 0, conflict
+	} else if err != nil {
+		return 0, err
+	}
+
+	var taken int
+
+	query := `select 
+					count(id)
+				from 
+					room_restrictions rr 
+				where 
+					room_id = $1
+					and $2 < end_date and $3 > start_date`
+
+	err = tx.QueryRowContext(ctx, query, res.RoomID, res.StartDate, res.EndDate).Scan(&taken)
+	if err != nil {
+		return 0, err
+	}
+
+	if taken > 0 {
+		return 0, conflict
+	}
+
+	stmt := `insert into reservations (first_name, last_name, email, phone,
+		start_date, end_date, room_id, reference, quote, total_amount, created_at, updated_at) values
+		($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) returning id `
+
+	quote, err := json.Marshal(res.Quote)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.QueryRowContext(ctx, stmt,
+		res.FirstName, res.LastName, res.Email, res.Phone,
+		res.StartDate, res.EndDate, res.RoomID, res.Reference,
+		string(quote), res.Quote.Total, time.Now(), time.Now()).Scan(&newID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	stmt = `insert into room_restrictions (start_date, end_date, room_id, reservation_id, restriction_id, created_at, updated_at) values
+		($1, $2, $3, $4, $5, $6, $7) `
+
+	_, err = tx.ExecContext(ctx, stmt, res.StartDate, res.EndDate, res.RoomID, newID, 1, time.Now(), time.Now())
+	if isExclusionViolation(err) {
+		return 0, conflict
+	} else if err != nil {
+		return 0, err
+	}
+
+	if err = insertStatusChange(ctx, tx, newID, "", models.StatusPending, 0, ""); err != nil {
+		return 0, err
+	}
+
+	for _, msg := range outbox {
+		if _, err = insertOutboxMessage(ctx, tx, msg); err != nil {
+			return 0, err
+		}
+	}
 
-	_, err := m.DB.ExecContext(ctx, query, u.ID, u.FirstName, u.LastName, u.Email, u.Password, u.AccessLevel, time.Now())
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
 
-	return err
+	return newID, nil
 }
 
-func (m *postgresDBRepo) Authenticate(email, testPassword string) (int, string, string, error) {
+// UpdateReservation stores the guest's details and queues the outbox messages in the same transaction
+func (m *postgresDBRepo) UpdateReservation(ctx context.Context, r models.Reservation, outbox ...models.OutboxMessage) error {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
-	var id int
-	var hashedPassword, firstName, lastName string
-
-	query := `select id, password, first_name, last_name from users where email = $1`
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	row := m.DB.QueryRowContext(ctx, query, email)
-	err := row.Scan(&id, &hashedPassword, &firstName, &lastName)
+	query := `
+		update reservations set first_name = $2, last_name = $3, 
+		email = $4, phone = $5, sequence = sequence + 1, updated_at = $6 where id = $1`
 
+	_, err = tx.ExecContext(ctx, query,
+		r.ID, r.FirstName, r.LastName, r.Email, r.Phone, time.Now())
 	if err != nil {
-		return id, "", "", err
+		return err
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(testPassword))
-	if err == bcrypt.ErrMismatchedHashAndPassword {
-		return 0, "", "", errors.New("incorrect password")
-	} else if err != nil {
-		return 0, "", "", err
+	for _, msg := range outbox {
+		if _, err = insertOutboxMessage(ctx, tx, msg); err != nil {
+			return err
+		}
 	}
 
-	return id, fmt.Sprintf("%s %s", firstName, lastName), hashedPassword, nil
+	return tx.Commit()
 }
 
-// endregion
-
-// region "Rooms"
-func (m *postgresDBRepo) GetAllRooms() ([]models.Room, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// ChangeBookingDates moves a reservation and its room restriction to res.StartDate and
+// res.EndDate and stores the new quote. The room is locked and checked for overlaps the
+// same way as SearchAvailabilityByDatesByRoom, leaving out the reservation's own dates.
+// Only pending or confirmed reservations without a cancellation request can be moved;
+// others give a BookingClosedError. The outbox messages are queued in the same transaction.
+func (m *postgresDBRepo) ChangeBookingDates(ctx context.Context, res models.Reservation, outbox ...models.OutboxMessage) error {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
-	var rooms []models.Room
-
-	query := `
-		select rm.id, rm.room_name
-			from rooms rm 
-					order by room_name asc
-		`
+	conflict := &repository.BookingConflictError{
+		RoomID:    res.RoomID,
+		StartDate: res.StartDate,
+		EndDate:   res.EndDate,
+	}
 
-	rows, err := m.DB.QueryContext(ctx, query)
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
+	defer tx.Rollback()
 
-	for rows.Next() {
-		var item models.Room
+	var lockedID int
 
-		err := rows.Scan(
-			&item.ID,
-			&item.RoomName,
-		)
+	err = tx.QueryRowContext(ctx, `select id from rooms where id = $1 and archived_at is null for update`, res.RoomID).Scan(&lockedID)
+	if err == sql.ErrNoRows {
+		return conflict
+	} else if err != nil {
+		return err
+	}
 
-		if err != nil {
-			return rooms, err
-		}
+	// staff may have cancelled the booking since the guest loaded it
+	var status string
+	var cancellationRequested bool
 
-		rooms = append(rooms, item)
+	err = tx.QueryRowContext(ctx, `select status, cancellation_requested_at is not null from reservations
+		where id = $1 for update`, res.ID).Scan(&status, &cancellationRequested)
+	if err != nil {
+		return err
 	}
 
-	if err = rows.Err(); err != nil {
-		return rooms, err
+	closed := &repository.BookingClosedError{ID: res.ID, Status: status}
+	if (status != models.StatusPending && status != models.StatusConfirmed) || cancellationRequested {
+		return closed
 	}
 
-	return rooms, nil
-}
-
-func (m *postgresDBRepo) GetRoomByID(id int) (models.Room, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	var taken int
 
-	var room models.Room
+	query := `select 
+					count(id)
+				from 
+					room_restrictions rr 
+				where 
+					room_id = $1
+					and $2 < end_date and $3 > start_date
+					and reservation_id is distinct from $4`
 
-	query := `select id, room_name, created_at, updated_at from rooms where id = $1`
+	if err = tx.QueryRowContext(ctx, query, res.RoomID, res.StartDate, res.EndDate, res.ID).Scan(&taken); err != nil {
+		return err
+	}
 
-	row := m.DB.QueryRowContext(ctx, query, id)
-	err := row.Scan(
-		&room.ID,
-		&room.RoomName,
-		&room.CreatedAt,
-		&room.UpdatedAt,
-	)
+	if taken > 0 {
+		return conflict
+	}
 
+	quote, err := json.Marshal(res.Quote)
 	if err != nil {
-		return room, err
+		return err
 	}
 
-	return room, nil
-}
-
-// endregion
+	stmt := `update reservations set start_date = $2, end_date = $3, quote = $4, total_amount = $5,
+		sequence = sequence + 1, updated_at = $6
+		where id = $1 and status in ('pending', 'confirmed') and cancellation_requested_at is null`
 
-// region "Reservations"
-func (m *postgresDBRepo) GetAllReservations(onlyNew bool) ([]models.Reservation, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	result, err := tx.ExecContext(ctx, stmt, res.ID, res.StartDate, res.EndDate, string(quote), res.Quote.Total, time.Now())
+	if err != nil {
+		return err
+	}
 
-	var reservations []models.Reservation
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return closed
+	}
 
-	var sb strings.Builder
+	stmt = `update room_restrictions set start_date = $2, end_date = $3, updated_at = $4
+		where reservation_id = $1 and restriction_id = 1`
 
-	query := `
-		select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date,
-		r.end_date, r.room_id, r.processed, r.reference, r.created_at, r.updated_at, 
-		rm.id, rm.room_name
-			from reservations r
-				inner join rooms rm on r.room_id  = rm.id 
-					
-		`
-	sb.WriteString(query)
+	_, err = tx.ExecContext(ctx, stmt, res.ID, res.StartDate, res.EndDate, time.Now())
+	if isExclusionViolation(err) {
+		return conflict
+	} else if err != nil {
+		return err
+	}
 
-	if onlyNew {
-		sb.WriteString(`where r.processed = 0`)
+	for _, msg := range outbox {
+		if _, err = insertOutboxMessage(ctx, tx, msg); err != nil {
+			return err
+		}
 	}
 
-	sb.WriteString(`order by r.created_at asc`)
+	return tx.Commit()
+}
 
-	rows, err := m.DB.QueryContext(ctx, query)
+// RequestCancellation records that the guest asked to cancel and queues the outbox
+// messages in the same transaction. Asking again keeps the first time and queues nothing.
+func (m *postgresDBRepo) RequestCancellation(ctx context.Context, id int, outbox ...models.OutboxMessage) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
+	defer tx.Rollback()
 
-	for rows.Next() {
-		var item models.Reservation
-
-		err := rows.Scan(
-			&item.ID,
-			&item.FirstName,
-			&item.LastName,
-			&item.Email,
-			&item.Phone,
-			&item.StartDate,
-			&item.EndDate,
-			&item.RoomID,
-			&item.Processed,
-			&item.Reference,
-			&item.CreatedAt,
-			&item.UpdatedAt,
-			&item.Room.ID,
-			&item.Room.RoomName,
-		)
+	query := `
+		update reservations set cancellation_requested_at = $2, updated_at = $2
+			where id = $1 and cancellation_requested_at is null`
 
-		if err != nil {
-			return reservations, err
-		}
+	result, err := tx.ExecContext(ctx, query, id, time.Now())
+	if err != nil {
+		return err
+	}
 
-		reservations = append(reservations, item)
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return err
 	}
 
-	if err = rows.Err(); err != nil {
-		return reservations, err
+	for _, msg := range outbox {
+		if _, err = insertOutboxMessage(ctx, tx, msg); err != nil {
+			return err
+		}
 	}
 
-	return reservations, nil
+	return tx.Commit()
 }
 
-func (m *postgresDBRepo) GetReservationById(id int) (models.Reservation, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// TransitionReservation moves a reservation to a new status and records the change.
+// Cancelling frees the reservation's dates in room_restrictions. The outbox messages are
+// queued in the same transaction.
+func (m *postgresDBRepo) TransitionReservation(ctx context.Context, id int, to string, userID int, note string, outbox ...models.OutboxMessage) error {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
-	var reservation models.Reservation
-
-	query := `
-		select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date,
-			r.end_date, r.room_id, r.processed, r.created_at, r.updated_at, r.reference,
-				rm.id, rm.room_name
-					from reservations r
-						inner join rooms rm on r.room_id  = rm.id 
-			 				where r.id = $1`
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	row := m.DB.QueryRowContext(ctx, query, id)
-	err := row.Scan(
-		&reservation.ID,
-		&reservation.FirstName,
-		&reservation.LastName,
-		&reservation.Email,
-		&reservation.Phone,
-		&reservation.StartDate,
-		&reservation.EndDate,
-		&reservation.RoomID,
-		&reservation.Processed,
-		&reservation.CreatedAt,
-		&reservation.UpdatedAt,
-		&reservation.Reference,
-		&reservation.Room.ID,
-		&reservation.Room.RoomName,
-	)
+	var from string
 
+	err = tx.QueryRowContext(ctx, `select status from reservations where id = $1 for update`, id).Scan(&from)
 	if err != nil {
-		return reservation, err
+		return err
 	}
 
-	return reservation, nil
-}
-
-func (m *postgresDBRepo) InsertReservation(res models.Reservation) (int, error) {
-	var newID int
+	if !models.CanTransition(from, to) {
+		return &repository.InvalidTransitionError{From: from, To: to}
+	}
 
-	// we need to put things into context. if the process doesn't work within 3 seconds, something is wrong
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
-	defer cancel()
+	_, err = tx.ExecContext(ctx, `update reservations set status = $2, sequence = sequence + 1, updated_at = $3
+		where id = $1`, id, to, time.Now())
+	if err != nil {
+		return err
+	}
 
-	stmt := `insert into reservations (first_name, last_name, email, phone,
-		start_date, end_date, room_id, reference, created_at, updated_at) values
-		($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) returning id `
+	if to == models.StatusCancelled {
+		_, err = tx.ExecContext(ctx, `delete from room_restrictions where reservation_id = $1`, id)
+		if err != nil {
+			return err
+		}
+	}
 
-	err := m.DB.QueryRowContext(ctx, stmt,
-		res.FirstName, res.LastName, res.Email, res.Phone,
-		res.StartDate, res.EndDate, res.RoomID, res.Reference,
-		time.Now(), time.Now()).Scan(&newID)
+	if err = insertStatusChange(ctx, tx, id, from, to, userID, note); err != nil {
+		return err
+	}
 
-	if err != nil {
-		return 0, err
+	for _, msg := range outbox {
+		if _, err = insertOutboxMessage(ctx, tx, msg); err != nil {
+			return err
+		}
 	}
 
-	return newID, nil
+	return tx.Commit()
 }
 
-func (m *postgresDBRepo) UpdateReservation(r models.Reservation) error {
-
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// GetReservationHistory returns the status changes of a reservation, oldest first
+func (m *postgresDBRepo) GetReservationHistory(ctx context.Context, id int) ([]models.ReservationStatusChange, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
+	var history []models.ReservationStatusChange
+
 	query := `
-		update reservations set first_name = $2, last_name = $3, 
-		email = $4, phone = $5, updated_at = $6 where id = $1`
+		select id, reservation_id, from_status, to_status, note, coalesce(user_id, 0), created_at
+			from reservation_status_changes
+				where reservation_id = $1
+					order by created_at asc, id asc`
 
-	_, err := m.DB.ExecContext(ctx, query,
-		r.ID, r.FirstName, r.LastName, r.Email, r.Phone, time.Now())
+	rows, err := m.DB.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	return err
-}
+	for rows.Next() {
+		var item models.ReservationStatusChange
 
-func (m *postgresDBRepo) DeleteReservation(id int) error {
+		err := rows.Scan(
+			&item.ID,
+			&item.ReservationID,
+			&item.FromStatus,
+			&item.ToStatus,
+			&item.Note,
+			&item.UserID,
+			&item.CreatedAt,
+		)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+		if err != nil {
+			return history, err
+		}
 
-	query := `
-		delete from reservations where id = $1`
+		history = append(history, item)
+	}
 
-	_, err := m.DB.ExecContext(ctx, query, id)
+	if err = rows.Err(); err != nil {
+		return history, err
+	}
 
-	return err
+	return history, nil
 }
 
-func (m *postgresDBRepo) MarkProcessedReservation(id, processed int) error {
-
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+func insertStatusChange(ctx context.Context, tx *sql.Tx, reservationID int, from, to string, userID int, note string) error {
+	var user sql.NullInt64
+	if userID > 0 {
+		user = sql.NullInt64{Int64: int64(userID), Valid: true}
+	}
 
-	query := `
-		update reservations set processed = $1 where id = $2`
+	stmt := `insert into reservation_status_changes (reservation_id, from_status, to_status, note, user_id, created_at)
+		values ($1, $2, $3, $4, $5, $6)`
 
-	_, err := m.DB.ExecContext(ctx, query, processed, id)
+	_, err := tx.ExecContext(ctx, stmt, reservationID, from, to, note, user, time.Now())
 
 	return err
 }
@@ -323,17 +1921,19 @@ func (m *postgresDBRepo) MarkProcessedReservation(id, processed int) error {
 // endregion
 
 // region "Room Restrictions"
-func (m *postgresDBRepo) InsertRoomRestriction(res models.RoomRestriction) error {
+func (m *postgresDBRepo) InsertRoomRestriction(ctx context.Context, res models.RoomRestriction) error {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	stmt := `insert into room_restrictions (start_date, end_date, room_id, reservation_id, restriction_id, created_at, updated_at) values
 		($1, $2, $3, $4, $5, $6, $7) `
 
-	_, err := m.DB.ExecContext(ctx, stmt, res.StartDate, res.EndDate, res.RoomID, res.ReservationID, res.RestrictionID, time.Now(), time.Now())
+	_, err := m.DB.ExecContext(ctx, stmt, res.StartDate, res.EndDate, res.RoomID, reservationRef(res.ReservationID), res.RestrictionID, time.Now(), time.Now())
 
-	if err != nil {
+	if isExclusionViolation(err) {
+		return &repository.BookingConflictError{RoomID: res.RoomID, StartDate: res.StartDate, EndDate: res.EndDate}
+	} else if err != nil {
 		log.Println(err)
 		return err
 	}
@@ -341,9 +1941,19 @@ func (m *postgresDBRepo) InsertRoomRestriction(res models.RoomRestriction) error
 	return nil
 }
 
-func (m *postgresDBRepo) GetRestrictionsForRoomByDate(roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
+// reservationRef is the room_restrictions.reservation_id of a restriction: null for owner
+// blocks, which have no reservation for the foreign key to point at
+func reservationRef(id int) sql.NullInt64 {
+	if id == 0 {
+		return sql.NullInt64{}
+	}
+
+	return sql.NullInt64{Int64: int64(id), Valid: true}
+}
+
+func (m *postgresDBRepo) GetRestrictionsForRoomByDate(ctx context.Context, roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	var restrictions []models.RoomRestriction
@@ -361,20 +1971,91 @@ func (m *postgresDBRepo) GetRestrictionsForRoomByDate(roomID int, start, end tim
 
 	for rows.Next() {
 		var item models.RoomRestriction
+		var reservationID sql.NullInt64
 
 		err := rows.Scan(
 			&item.ID,
-			&item.ReservationID,
+			&reservationID,
+			&item.RestrictionID,
+			&item.RoomID,
+			&item.StartDate,
+			&item.EndDate,
+		)
+
+		if err != nil {
+			return restrictions, err
+		}
+
+		item.ReservationID = int(reservationID.Int64)
+		restrictions = append(restrictions, item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return restrictions, err
+	}
+
+	return restrictions, nil
+}
+
+// GetCalendarForRoom returns the restrictions of a room that end after since, earliest
+// first. Those of reservations come with the reservation's reference, guest, status and sequence.
+func (m *postgresDBRepo) GetCalendarForRoom(ctx context.Context, roomID int, since time.Time) ([]models.RoomRestriction, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var restrictions []models.RoomRestriction
+
+	query := `
+		select rr.id, rr.reservation_id, rr.restriction_id, rr.room_id, rr.start_date, rr.end_date,
+			rr.created_at, rr.updated_at, coalesce(r.reference, ''), coalesce(r.first_name, ''),
+			coalesce(r.last_name, ''), coalesce(r.status, ''), coalesce(r.sequence, 0), r.updated_at
+		from room_restrictions rr
+			left join reservations r on r.id = rr.reservation_id
+		where rr.room_id = $1 and rr.end_date > $2
+		order by rr.start_date, rr.id`
+
+	rows, err := m.DB.QueryContext(ctx, query, roomID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.RoomRestriction
+		var reservationID sql.NullInt64
+		var reservationUpdatedAt sql.NullTime
+
+		err := rows.Scan(
+			&item.ID,
+			&reservationID,
 			&item.RestrictionID,
 			&item.RoomID,
 			&item.StartDate,
 			&item.EndDate,
+			&item.CreatedAt,
+			&item.UpdatedAt,
+			&item.Reservation.Reference,
+			&item.Reservation.FirstName,
+			&item.Reservation.LastName,
+			&item.Reservation.Status,
+			&item.Reservation.Sequence,
+			&reservationUpdatedAt,
 		)
 
 		if err != nil {
 			return restrictions, err
 		}
 
+		// owner blocks have no reservation
+		item.ReservationID = int(reservationID.Int64)
+		if item.ReservationID > 0 {
+			item.Reservation.ID = item.ReservationID
+			item.Reservation.RoomID = item.RoomID
+			item.Reservation.StartDate = item.StartDate
+			item.Reservation.EndDate = item.EndDate
+			item.Reservation.UpdatedAt = reservationUpdatedAt.Time
+		}
+
 		restrictions = append(restrictions, item)
 	}
 
@@ -388,9 +2069,9 @@ func (m *postgresDBRepo) GetRestrictionsForRoomByDate(roomID int, start, end tim
 // endregion
 
 // region "Availability"
-func (m *postgresDBRepo) SearchAvailabilityByDatesByRoom(start, end time.Time, roomID int) (bool, error) {
+func (m *postgresDBRepo) SearchAvailabilityByDatesByRoom(ctx context.Context, start, end time.Time, roomID int) (bool, error) {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	var availability int
@@ -418,9 +2099,9 @@ func (m *postgresDBRepo) SearchAvailabilityByDatesByRoom(start, end time.Time, r
 	return false, nil
 }
 
-func (m *postgresDBRepo) SearchAvailabilityByDates(start, end time.Time) ([]models.Room, error) {
+func (m *postgresDBRepo) SearchAvailabilityByDates(ctx context.Context, start, end time.Time) ([]models.Room, error) {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	var rooms []models.Room
@@ -430,7 +2111,8 @@ func (m *postgresDBRepo) SearchAvailabilityByDates(start, end time.Time) ([]mode
 				from 
 					rooms r
 				where 
-					r.id not in ( select rr.room_id from room_restrictions rr where $1 < rr.end_date and $2 > rr.start_date )`
+					r.archived_at is null
+					and r.id not in ( select rr.room_id from room_restrictions rr where $1 < rr.end_date and $2 > rr.start_date )`
 
 	rows, err := m.DB.QueryContext(ctx, query, start, end)
 	if err != nil {
@@ -458,9 +2140,9 @@ func (m *postgresDBRepo) SearchAvailabilityByDates(start, end time.Time) ([]mode
 
 //endregion
 
-func (m *postgresDBRepo) InsertBlockForRoom(id int, startDate time.Time) error {
+func (m *postgresDBRepo) InsertBlockForRoom(ctx context.Context, id int, startDate time.Time) error {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	stmt := `insert into room_restrictions (start_date, end_date, room_id, 
@@ -468,9 +2150,11 @@ func (m *postgresDBRepo) InsertBlockForRoom(id int, startDate time.Time) error {
 				($1, $2, $3, $4, $5, $6, $7) `
 
 	_, err := m.DB.ExecContext(ctx, stmt,
-		startDate, startDate.AddDate(0, 0, 1), id, 2, 0, time.Now(), time.Now())
+		startDate, startDate.AddDate(0, 0, 1), id, 2, nil, time.Now(), time.Now())
 
-	if err != nil {
+	if isExclusionViolation(err) {
+		return &repository.BookingConflictError{RoomID: id, StartDate: startDate, EndDate: startDate.AddDate(0, 0, 1)}
+	} else if err != nil {
 		log.Println(err)
 		return err
 	}
@@ -478,9 +2162,9 @@ func (m *postgresDBRepo) InsertBlockForRoom(id int, startDate time.Time) error {
 	return nil
 }
 
-func (m *postgresDBRepo) DeleteBlocksForRoom(id int, blocks string) error {
+func (m *postgresDBRepo) DeleteBlocksForRoom(ctx context.Context, id int, blocks string) error {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	//stmt := `delete from room_restrictions where room_id = $1 and id in ($2)`
@@ -0,0 +1,159 @@
+package dbrepo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jackc/pgconn"
+	"github.com/patrickoliveros/bookings/internal/repository"
+	"github.com/patrickoliveros/bookings/models"
+)
+
+func TestPostgresRepo_GetCalendarForRoom(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	repo := NewPostGresRepo(db, nil)
+	now := time.Now()
+
+	rows := sqlmock.NewRows([]string{"id", "reservation_id", "restriction_id", "room_id", "start_date", "end_date",
+		"created_at", "updated_at", "reference", "first_name", "last_name", "status", "sequence", "updated_at"}).
+		AddRow(1, 7, 1, 1, date("2022-02-01"), date("2022-02-03"), now, now, "A1B2C3D4", "Jane", "Doe", "pending", 2, now).
+		AddRow(2, nil, 2, 1, date("2022-02-10"), date("2022-02-11"), now, now, "", "", "", "", 0, nil)
+
+	mock.ExpectQuery("from room_restrictions rr").WithArgs(1, date("2022-01-01")).WillReturnRows(rows)
+
+	restrictions, err := repo.GetCalendarForRoom(context.Background(), 1, date("2022-01-01"))
+	if err != nil {
+		t.Fatalf("expected the owner block to be read, got %v", err)
+	}
+
+	if len(restrictions) != 2 {
+		t.Fatalf("expected the booking and the block, got %+v", restrictions)
+	}
+	if res := restrictions[0].Reservation; restrictions[0].ReservationID != 7 || res.Reference != "A1B2C3D4" || res.Sequence != 2 {
+		t.Errorf("expected the booking with its reservation, got %+v", restrictions[0])
+	}
+	if restrictions[1].ReservationID != 0 || restrictions[1].Reservation.ID != 0 {
+		t.Errorf("expected the block without a reservation, got %+v", restrictions[1])
+	}
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPostgresRepo_InsertBlockForRoom(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	repo := NewPostGresRepo(db, nil)
+
+	mock.ExpectExec("insert into room_restrictions").
+		WithArgs(date("2022-02-10"), date("2022-02-11"), 1, 2, nil, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	if err = repo.InsertBlockForRoom(context.Background(), 1, date("2022-02-10")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("expected the block to be stored without a reservation: %v", err)
+	}
+}
+
+func TestPostgresRepo_InsertBlockForRoomConflict(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	repo := NewPostGresRepo(db, nil)
+
+	mock.ExpectExec("insert into room_restrictions").
+		WillReturnError(&pgconn.PgError{Code: exclusionViolation, ConstraintName: "room_restrictions_no_overlap"})
+
+	err = repo.InsertBlockForRoom(context.Background(), 1, date("2022-02-10"))
+
+	var conflict *repository.BookingConflictError
+	if !errors.As(err, &conflict) || conflict.RoomID != 1 || !conflict.EndDate.Equal(date("2022-02-11")) {
+		t.Errorf("expected a BookingConflictError for the night, got %v", err)
+	}
+}
+
+func TestPostgresRepo_ChangeBookingDatesClosed(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	repo := NewPostGresRepo(db, nil)
+	res := models.Reservation{ID: 7, RoomID: 1, StartDate: date("2022-02-10"), EndDate: date("2022-02-12")}
+
+	// staff cancelled the booking after the guest loaded it
+	mock.ExpectBegin()
+	mock.ExpectQuery("select id from rooms").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery("select status, cancellation_requested_at is not null from reservations").WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"status", "requested"}).AddRow(models.StatusCancelled, false))
+	mock.ExpectRollback()
+
+	err = repo.ChangeBookingDates(context.Background(), res, models.OutboxMessage{To: "guest@here.com"})
+
+	var closed *repository.BookingClosedError
+	if !errors.As(err, &closed) || closed.Status != models.StatusCancelled {
+		t.Errorf("expected a BookingClosedError, got %v", err)
+	}
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("expected nothing to be written: %v", err)
+	}
+}
+
+func TestPostgresRepo_InsertPasswordReset(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	repo := NewPostGresRepo(db, nil)
+	reset := models.PasswordReset{UserID: 1, TokenHash: "hash", ExpiresAt: time.Now().Add(time.Hour)}
+
+	// the link and its email are written together
+	mock.ExpectBegin()
+	mock.ExpectQuery("insert into password_resets").WithArgs(1, "hash", reset.ExpiresAt, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	mock.ExpectQuery("insert into mail_outbox").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(9))
+	mock.ExpectCommit()
+
+	if id, err := repo.InsertPasswordReset(context.Background(), reset, models.OutboxMessage{To: "desk@here.com"}); err != nil || id != 3 {
+		t.Errorf("expected reset 3, got %d %v", id, err)
+	}
+
+	// a link whose email can't be queued is not kept
+	mock.ExpectBegin()
+	mock.ExpectQuery("insert into password_resets").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+	mock.ExpectQuery("insert into mail_outbox").WillReturnError(errors.New("outbox is gone"))
+	mock.ExpectRollback()
+
+	if _, err := repo.InsertPasswordReset(context.Background(), reset, models.OutboxMessage{To: "desk@here.com"}); err == nil {
+		t.Error("expected the outbox error")
+	}
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"context"
+	"fmt"
 	"time"
 
 	"github.com/patrickoliveros/bookings/models"
@@ -9,30 +11,130 @@ import (
 type DatabaseRepo interface {
 
 	// Users
-	GetAllUsers() bool
-	GetUserByID(id int) (models.User, error)
-	UpdateUser(u models.User) error
-	Authenticate(email, testPassword string) (int, string, string, error)
+	GetAllUsers(ctx context.Context) ([]models.User, error)
+	GetUserByID(ctx context.Context, id int) (models.User, error)
+	GetUserByEmail(ctx context.Context, email string) (models.User, error)
+	InsertUser(ctx context.Context, u models.User) (int, error)
+	UpdateUser(ctx context.Context, u models.User) error
+	DeactivateUser(ctx context.Context, id int, deactivated bool) error
+	UpdatePassword(ctx context.Context, id int, passwordHash string) error
+
+	// Login throttling
+	RecordLoginAttempt(ctx context.Context, attempt models.LoginAttempt) error
+	GetLoginAttempts(ctx context.Context, limit int) ([]models.LoginAttempt, error)
+	GetFailedLoginsByIP(ctx context.Context, ip string, since time.Time) (int, time.Time, error)
+	IncrementFailedLogins(ctx context.Context, userID int) (int, error)
+	LockUser(ctx context.Context, userID int, until time.Time) error
+	UnlockUser(ctx context.Context, userID int) error
+
+	// Two-factor authentication
+	EnableTwoFactor(ctx context.Context, userID int, secret string, recoveryCodeHashes []string) error
+	DisableTwoFactor(ctx context.Context, userID int) error
+	UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error)
+	ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error
+	UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error)
+	CountRecoveryCodes(ctx context.Context, userID int) (int, error)
+
+	// Staff sessions
+	InsertUserSession(ctx context.Context, session models.UserSession) (int, error)
+	GetUserSessionByKey(ctx context.Context, key string) (models.UserSession, error)
+	GetActiveUserSessions(ctx context.Context, userID int) ([]models.UserSession, error)
+	TouchUserSession(ctx context.Context, id int, ip string) error
+	RevokeUserSession(ctx context.Context, userID, id int) error
+	RevokeUserSessions(ctx context.Context, userID, keepID int) error
+
+	// API keys
+	InsertAPIKey(ctx context.Context, key models.APIKey) (int, error)
+	GetAPIKeys(ctx context.Context) ([]models.APIKey, error)
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (models.APIKey, error)
+	TouchAPIKey(ctx context.Context, id int) error
+	RevokeAPIKey(ctx context.Context, id int) error
+
+	// Mail outbox
+	InsertOutboxMessage(ctx context.Context, msg models.OutboxMessage) (int, error)
+	ClaimOutboxMessages(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxMessage, error)
+	MarkOutboxMessageSent(ctx context.Context, id int) error
+	FailOutboxMessage(ctx context.Context, id int, lastError string, retryAt time.Time) error
+	GetOutboxMessages(ctx context.Context, status string, limit int) ([]models.OutboxMessage, error)
+	RetryOutboxMessage(ctx context.Context, id int) error
+	DiscardOutboxMessage(ctx context.Context, id int) error
+
+	// Password resets
+	InsertPasswordReset(ctx context.Context, reset models.PasswordReset, outbox ...models.OutboxMessage) (int, error)
+	GetPasswordReset(ctx context.Context, tokenHash string) (models.PasswordReset, error)
+	ResetPassword(ctx context.Context, tokenHash, passwordHash string) (int, error)
+	Authenticate(ctx context.Context, email, testPassword string) (int, string, string, error)
 
 	// Rooms
-	GetAllRooms() ([]models.Room, error)
-	GetRoomByID(id int) (models.Room, error)
+	GetAllRooms(ctx context.Context) ([]models.Room, error)
+	GetActiveRooms(ctx context.Context) ([]models.Room, error)
+	GetRoomByID(ctx context.Context, id int) (models.Room, error)
+	GetRoomBySlug(ctx context.Context, slug string) (models.Room, error)
+	InsertRoom(ctx context.Context, room models.Room) (int, error)
+	UpdateRoom(ctx context.Context, room models.Room) error
+	ArchiveRoom(ctx context.Context, id int, archived bool) error
+	GetRoomByCalendarToken(ctx context.Context, token string) (models.Room, error)
+	SetRoomCalendarToken(ctx context.Context, id int, token string) error
+
+	// Seasonal rates
+	GetSeasonalRatesForRoom(ctx context.Context, roomID int) ([]models.SeasonalRate, error)
+	InsertSeasonalRate(ctx context.Context, rate models.SeasonalRate) (int, error)
+	DeleteSeasonalRate(ctx context.Context, id int) error
 
 	// Reservations
-	GetAllReservations(onlyNew bool) ([]models.Reservation, error)
-	GetReservationById(id int) (models.Reservation, error)
-	InsertReservation(res models.Reservation) (int, error)
-	UpdateReservation(res models.Reservation) error
-	DeleteReservation(id int) error
-	MarkProcessedReservation(id, processed int) error
+	GetAllReservations(ctx context.Context, status string) ([]models.Reservation, error)
+	GetReservationById(ctx context.Context, id int) (models.Reservation, error)
+	GetReservationByReference(ctx context.Context, reference, email string) (models.Reservation, error)
+	InsertReservation(ctx context.Context, res models.Reservation) (int, error)
+	UpdateReservation(ctx context.Context, res models.Reservation, outbox ...models.OutboxMessage) error
+	TransitionReservation(ctx context.Context, id int, to string, userID int, note string, outbox ...models.OutboxMessage) error
+	GetReservationHistory(ctx context.Context, id int) ([]models.ReservationStatusChange, error)
+	CreateBooking(ctx context.Context, res models.Reservation, outbox ...models.OutboxMessage) (int, error)
+	ChangeBookingDates(ctx context.Context, res models.Reservation, outbox ...models.OutboxMessage) error
+	RequestCancellation(ctx context.Context, id int, outbox ...models.OutboxMessage) error
 
 	// Room Restrictions
-	InsertRoomRestriction(res models.RoomRestriction) error
-	GetRestrictionsForRoomByDate(roomID int, start, end time.Time) ([]models.RoomRestriction, error)
-	InsertBlockForRoom(id int, startDate time.Time) error
-	DeleteBlocksForRoom(id int, blocks string) error
+	InsertRoomRestriction(ctx context.Context, res models.RoomRestriction) error
+	GetRestrictionsForRoomByDate(ctx context.Context, roomID int, start, end time.Time) ([]models.RoomRestriction, error)
+	InsertBlockForRoom(ctx context.Context, id int, startDate time.Time) error
+	DeleteBlocksForRoom(ctx context.Context, id int, blocks string) error
+	GetCalendarForRoom(ctx context.Context, roomID int, since time.Time) ([]models.RoomRestriction, error)
 
 	// Availability
-	SearchAvailabilityByDatesByRoom(start, end time.Time, roomID int) (bool, error)
-	SearchAvailabilityByDates(start, end time.Time) ([]models.Room, error)
+	SearchAvailabilityByDatesByRoom(ctx context.Context, start, end time.Time, roomID int) (bool, error)
+	SearchAvailabilityByDates(ctx context.Context, start, end time.Time) ([]models.Room, error)
+}
+
+// BookingConflictError is returned when a booking overlaps dates that are
+// already taken for the room
+type BookingConflictError struct {
+	RoomID    int
+	StartDate time.Time
+	EndDate   time.Time
+}
+
+func (e *BookingConflictError) Error() string {
+	return fmt.Sprintf("room %d is not available from %s to %s",
+		e.RoomID, e.StartDate.Format("2006-01-02"), e.EndDate.Format("2006-01-02"))
+}
+
+// BookingClosedError is returned when the dates of a reservation can no longer be changed,
+// because it has started, was cancelled, or the guest asked to cancel it
+type BookingClosedError struct {
+	ID     int
+	Status string
+}
+
+func (e *BookingClosedError) Error() string {
+	return fmt.Sprintf("the dates of %s reservation %d can no longer be changed", e.Status, e.ID)
+}
+
+// InvalidTransitionError is returned when a reservation cannot move between two statuses
+type InvalidTransitionError struct {
+	From string
+	To   string
+}
+
+func (e *InvalidTransitionError) Error() string {
+	return fmt.Sprintf("a %s reservation cannot become %s", e.From, e.To)
 }
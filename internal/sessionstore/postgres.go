@@ -0,0 +1,121 @@
+// Package sessionstore keeps scs sessions somewhere other than the memory of a single process
+package sessionstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+)
+
+// defaultQueryTimeout is used when no query timeout is given
+const defaultQueryTimeout = 3 * time.Second
+
+// PostgresStore is an scs.Store that keeps sessions in the sessions table, so they
+// survive restarts and are shared by every instance of the application
+type PostgresStore struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+	stopCleanup  chan bool
+}
+
+// NewPostgres returns a store using db. Expired sessions are deleted every
+// cleanupInterval; 0 turns the cleanup off.
+func NewPostgres(db *sql.DB, queryTimeout, cleanupInterval time.Duration) *PostgresStore {
+	p := &PostgresStore{
+		db:           db,
+		queryTimeout: queryTimeout,
+	}
+
+	if cleanupInterval > 0 {
+		p.stopCleanup = make(chan bool)
+		go p.startCleanup(cleanupInterval)
+	}
+
+	return p
+}
+
+// Find returns the data of an unexpired session
+func (p *PostgresStore) Find(token string) ([]byte, bool, error) {
+	ctx, cancel := p.withTimeout()
+	defer cancel()
+
+	var b []byte
+
+	err := p.db.QueryRowContext(ctx, `select data from sessions where token = $1 and expiry > $2`,
+		token, time.Now()).Scan(&b)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	return b, true, nil
+}
+
+// Commit saves a session, replacing its data and expiry if it already exists
+func (p *PostgresStore) Commit(token string, b []byte, expiry time.Time) error {
+	ctx, cancel := p.withTimeout()
+	defer cancel()
+
+	_, err := p.db.ExecContext(ctx, `insert into sessions (token, data, expiry) values ($1, $2, $3)
+		on conflict (token) do update set data = excluded.data, expiry = excluded.expiry`, token, b, expiry)
+
+	return err
+}
+
+// Delete removes a session; deleting one that does not exist is not an error
+func (p *PostgresStore) Delete(token string) error {
+	ctx, cancel := p.withTimeout()
+	defer cancel()
+
+	_, err := p.db.ExecContext(ctx, `delete from sessions where token = $1`, token)
+
+	return err
+}
+
+// DeleteExpired removes every expired session and returns how many there were
+func (p *PostgresStore) DeleteExpired() (int64, error) {
+	ctx, cancel := p.withTimeout()
+	defer cancel()
+
+	result, err := p.db.ExecContext(ctx, `delete from sessions where expiry < $1`, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// StopCleanup ends the background cleanup, before the database is closed
+func (p *PostgresStore) StopCleanup() {
+	if p.stopCleanup != nil {
+		p.stopCleanup <- true
+	}
+}
+
+func (p *PostgresStore) startCleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := p.DeleteExpired(); err != nil {
+				log.Println(">>> Could not delete expired sessions:", err)
+			}
+		case <-p.stopCleanup:
+			return
+		}
+	}
+}
+
+func (p *PostgresStore) withTimeout() (context.Context, context.CancelFunc) {
+	timeout := defaultQueryTimeout
+	if p.queryTimeout > 0 {
+		timeout = p.queryTimeout
+	}
+
+	return context.WithTimeout(context.Background(), timeout)
+}
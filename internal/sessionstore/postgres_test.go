@@ -0,0 +1,153 @@
+package sessionstore
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// now matches a time argument within a second of the current time
+type now struct{}
+
+func (now) Match(v driver.Value) bool {
+	t, ok := v.(time.Time)
+	return ok && time.Since(t) < time.Second && time.Until(t) < time.Second
+}
+
+func TestPostgresStore_Commit(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	store := NewPostgres(db, 0, 0)
+	expiry := time.Now().Add(time.Hour)
+
+	// committing an existing token replaces its data and expiry
+	mock.ExpectExec(`insert into sessions .+ on conflict \(token\) do update set data = excluded.data, expiry = excluded.expiry`).
+		WithArgs("abc", []byte("data"), expiry).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err = store.Commit("abc", []byte("data"), expiry); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPostgresStore_Find(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	store := NewPostgres(db, 0, 0)
+
+	mock.ExpectQuery(`select data from sessions where token = \$1 and expiry > \$2`).
+		WithArgs("abc", now{}).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow([]byte("data")))
+
+	b, found, err := store.Find("abc")
+	if err != nil || !found || string(b) != "data" {
+		t.Errorf("expected the session data, got %q %v %v", b, found, err)
+	}
+
+	// an expired or unknown session is not found, which is not an error
+	mock.ExpectQuery(`select data from sessions`).
+		WithArgs("expired", now{}).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}))
+
+	b, found, err = store.Find("expired")
+	if err != nil || found || b != nil {
+		t.Errorf("expected no session, got %q %v %v", b, found, err)
+	}
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPostgresStore_Delete(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	store := NewPostgres(db, 0, 0)
+
+	mock.ExpectExec(`delete from sessions where token = \$1`).
+		WithArgs("abc").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err = store.Delete("abc"); err != nil {
+		t.Errorf("expected deleting a missing session to succeed, got %v", err)
+	}
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPostgresStore_DeleteExpired(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	store := NewPostgres(db, 0, 0)
+
+	mock.ExpectExec(`delete from sessions where expiry < \$1`).
+		WithArgs(now{}).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	if n, err := store.DeleteExpired(); err != nil || n != 3 {
+		t.Errorf("expected 3 expired sessions to be deleted, got %d %v", n, err)
+	}
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPostgresStore_Cleanup(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(`delete from sessions where expiry < \$1`).
+		WithArgs(now{}).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	store := NewPostgres(db, 0, 10*time.Millisecond)
+
+	deadline := time.Now().Add(time.Second)
+	for mock.ExpectationsWereMet() != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the cleanup to delete expired sessions")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// StopCleanup only returns once the goroutine has received it
+	stopped := make(chan struct{})
+	go func() {
+		store.StopCleanup()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("expected the cleanup to stop")
+	}
+}
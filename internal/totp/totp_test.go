@@ -0,0 +1,76 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 key of the RFC 6238 test vectors, "12345678901234567890"
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// the last 6 digits of the 8 digit codes in RFC 6238 appendix B
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, test := range tests {
+		code, err := Code(rfcSecret, Step(time.Unix(test.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if code != test.code {
+			t.Errorf("at %d expected %s, got %s", test.unix, test.code, code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret := NewSecret()
+	now := time.Now()
+
+	code, _ := Code(secret, Step(now))
+
+	step, ok := Validate(secret, code, now, 0)
+	if !ok || step != Step(now) {
+		t.Fatalf("expected the current code to be valid")
+	}
+
+	if _, ok := Validate(secret, code, now.Add(Period), 0); !ok {
+		t.Error("expected a code from the previous period to be valid")
+	}
+
+	if _, ok := Validate(secret, code, now.Add(3*Period), 0); ok {
+		t.Error("expected an old code to be refused")
+	}
+
+	if _, ok := Validate(secret, code, now, step); ok {
+		t.Error("expected a used code to be refused")
+	}
+
+	if _, ok := Validate(secret, "12345", now, 0); ok {
+		t.Error("expected a short code to be refused")
+	}
+}
+
+func TestHashRecoveryCode(t *testing.T) {
+	codes := NewRecoveryCodes()
+	if len(codes) != RecoveryCodes || len(codes[0]) != 11 {
+		t.Fatalf("unexpected codes %v", codes)
+	}
+
+	if HashRecoveryCode(codes[0]) != HashRecoveryCode(" "+strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))) {
+		t.Error("expected case, spaces and dashes to be ignored")
+	}
+}
@@ -1,23 +1,30 @@
 package main
 
 import (
+	"context"
 	"encoding/gob"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/patrickoliveros/bookings/api"
 	"github.com/patrickoliveros/bookings/internal/config"
 	"github.com/patrickoliveros/bookings/internal/driver"
 	"github.com/patrickoliveros/bookings/internal/helpers"
+	"github.com/patrickoliveros/bookings/internal/logging"
 	"github.com/patrickoliveros/bookings/internal/mailer"
 	"github.com/patrickoliveros/bookings/internal/pages"
 	"github.com/patrickoliveros/bookings/internal/renders"
+	"github.com/patrickoliveros/bookings/internal/repository/dbrepo"
+	"github.com/patrickoliveros/bookings/internal/sessionstore"
 	"github.com/patrickoliveros/bookings/models"
-	mail "github.com/xhit/go-simple-mail/v2"
 
 	"github.com/alexedwards/scs/v2"
 
@@ -31,18 +38,26 @@ var session *scs.SessionManager
 var infoLog *log.Logger
 var errorLog *log.Logger
 var appConnectionString string
+var settings config.Settings
+
+// sessionCleanupInterval is how often expired sessions are deleted from the database
+const sessionCleanupInterval = 5 * time.Minute
+
+// emailTemplatesDirectory holds the layouts and named templates the mailer renders
+const emailTemplatesDirectory = "./email-templates"
 
 func main() {
 	parseApplicationFlags()
 
+	if flag.NArg() > 0 {
+		os.Exit(runCommand(flag.Args()))
+	}
+
 	db, err := runApplication()
 	if err != nil {
 		panic(err)
 	}
 
-	defer db.SQL.Close()
-	defer close(app.MailChannel)
-
 	log.Printf(">>> Starting application on port %s...", app.PortNumber)
 
 	srv := &http.Server{
@@ -50,10 +65,76 @@ func main() {
 		Handler: routes(&app),
 	}
 
-	err = srv.ListenAndServe()
-	if err != nil {
-		panic(err)
+	os.Exit(serveUntilShutdown(srv, db))
+}
+
+// serveUntilShutdown runs the server until it fails or the process is told to stop,
+// then shuts everything down and returns the exit status
+func serveUntilShutdown(srv *http.Server, db *driver.DB) int {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	serverErrors := make(chan error, 1)
+	go func() {
+		serverErrors <- srv.ListenAndServe()
+	}()
+
+	status := 0
+
+	select {
+	case err := <-serverErrors:
+		log.Println(">>> Server stopped unexpectedly:", err)
+		status = 1
+	case sig := <-stop:
+		log.Printf(">>> Received %s, shutting down...", sig)
 	}
+
+	if !shutdown(srv, db) {
+		status = 1
+	}
+
+	log.Println(">>> Application stopped")
+
+	return status
+}
+
+// shutdown stops accepting connections, waits for active requests, stops the mail
+// worker and closes the database. It returns false if something did not finish cleanly.
+func shutdown(srv *http.Server, db *driver.DB) bool {
+	clean := true
+	timeout := time.Duration(settings.ShutdownTimeout) * time.Second
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Println(">>> Active requests did not finish in time:", err)
+		clean = false
+	}
+
+	// messages the worker has not sent yet stay in the outbox until it starts again
+	log.Println(">>> Stopping mail worker...")
+
+	mailCtx, mailCancel := context.WithTimeout(context.Background(), timeout)
+	defer mailCancel()
+
+	if err := mailer.StopWorker(mailCtx); err != nil {
+		log.Println(">>> Could not stop the mail worker:", err)
+		clean = false
+	}
+
+	if store, ok := session.Store.(*sessionstore.PostgresStore); ok {
+		store.StopCleanup()
+	}
+
+	if db != nil {
+		if err := db.SQL.Close(); err != nil {
+			log.Println(">>> Could not close the database:", err)
+			clean = false
+		}
+	}
+
+	return clean
 }
 
 func printConfiguration() {
@@ -63,10 +144,28 @@ func printConfiguration() {
 	fmt.Println("In Production -", app.InProduction)
 	fmt.Println("Use Cache -", app.UseCache)
 	fmt.Println("Use Secure -", app.UseSecure)
+	fmt.Println("Site URL -", settings.SiteURL)
+	fmt.Println("Two-Factor Role -", settings.TwoFactorRole)
+	fmt.Println("API Rate Limit -", fmt.Sprintf("%d a minute", settings.APIRateLimit))
+	fmt.Println("Shutdown Timeout -", time.Duration(settings.ShutdownTimeout)*time.Second)
 	fmt.Println("\n\n-------------------------------------------")
 	fmt.Println("Database Settings")
 	fmt.Println("-------------------------------------------")
+	fmt.Println("Repository -", settings.Repository)
+	fmt.Println("Session Store -", settings.SessionStoreKind())
 	fmt.Println("Connection String -", appConnectionString)
+	fmt.Println("\n\n-------------------------------------------")
+	fmt.Println("Mail Settings")
+	fmt.Println("-------------------------------------------")
+	fmt.Println("Mail Transport -", settings.Mail.Transport)
+	switch settings.Mail.Transport {
+	case config.MailTransportSMTP:
+		fmt.Println("Mail Server -", fmt.Sprintf("%s:%d", settings.Mail.Host, settings.Mail.Port))
+		fmt.Println("Mail Encryption -", settings.Mail.Encryption)
+	case config.MailTransportFile:
+		fmt.Println("Mail Directory -", settings.Mail.Directory)
+	}
+	fmt.Println("Front Desk -", settings.Mail.FrontDesk)
 	fmt.Println("")
 }
 
@@ -78,44 +177,48 @@ func registerModels() {
 	gob.Register(models.RoomRestriction{})
 	gob.Register(models.MailData{})
 	gob.Register(map[string]int{})
+	gob.Register(time.Time{})
 }
 
 func runApplication() (*driver.DB, error) {
 
 	registerModels()
 
+	var db *driver.DB
+	var err error
+
 	// pingDatabase()
-	db, err := tryConnectDatabase()
+	if settings.Repository != config.RepositoryMemory {
+		db, err = tryConnectDatabase()
+	}
 
 	// setup default non-overridable values
 	setupDefaultAppConfig()
 	printConfiguration()
 	setupSession()
+	setupSessionStore(db)
 	setupDependencies()
 	setupApplicationTemplates()
-	setupMailServer()
-	setupMailChannel()
+	setupMailer()
 	setupRepo(db)
 
 	return db, err
 }
 
-func setupMailChannel() {
-	mailChannel := make(chan models.MailData)
-	app.MailChannel = mailChannel
+func setupMailer() {
+	sender, err := mailer.NewSender(settings.Mail)
+	if err != nil {
+		log.Fatal("cannot set up mail: ", err)
+	}
 
-	log.Println(">>> Starting mail listener...")
-	mailer.ListenForMail()
-}
+	tc, err := mailer.CreateTemplateCache(emailTemplatesDirectory)
+	if err != nil {
+		log.Fatal("cannot create email template cache: ", err)
+	}
 
-func setupMailServer() {
-	app.MailServer.Host = "192.168.50.146"
-	app.MailServer.Port = 1025
-	app.MailServer.KeepAlive = false
-	app.MailServer.ConnectTimeout = 10 * time.Second
-	app.MailServer.SendTimeout = 10 * time.Second
+	app.MailTemplates = tc
 
-	mailer.NewMailer(&app)
+	mailer.NewMailer(&app, sender)
 }
 
 func tryConnectDatabase() (*driver.DB, error) {
@@ -131,13 +234,6 @@ func tryConnectDatabase() (*driver.DB, error) {
 	return db, nil
 }
 
-// getDbConnectionString() sets the hardcoded dbvalues
-func getDbConnectionString() string {
-	return fmt.Sprintf("host=%s port=%d user=%s "+
-		"password=%s dbname=%s",
-		"your-db-server", 5433, "your-db-user", "your-db-password", "your-db-name")
-}
-
 func setDbConnectionString(host, dbname, port, user, password, ssl string) {
 	appConnectionString = fmt.Sprintf("host=%s port=%s user=%s "+
 		"password=%s dbname=%s sslmode=%s",
@@ -179,21 +275,65 @@ func parseFlags(dbName, dbUser, dbPassword, dbServer, dbPort, dbSsl string) {
 	}
 
 	if len(list) > 0 {
-		fmt.Println("Missing required flags: ")
-		for _, x := range list {
-			fmt.Println("\t>>", x)
-		}
-		os.Exit(1)
+		exitWithProblems("Missing required flags: ", list)
 	}
 
 	setDbConnectionString(dbServer, dbName, dbPort, dbUser, dbPassword, dbSsl)
 }
 
+// parseConfigFile loads settings from a json or yaml file, with BOOKINGS_*
+// environment variables taking precedence over the file and a non-empty
+// repository over both
+func parseConfigFile(path, environment, repository string) {
+	s, err := config.LoadSettings(path, environment, repository)
+	if err != nil {
+		var settingsErr *config.SettingsError
+		if errors.As(err, &settingsErr) {
+			exitWithProblems(fmt.Sprintf("Invalid configuration in %s: ", path), settingsErr.Problems)
+		}
+
+		log.Fatal(err)
+	}
+
+	settings = s
+
+	app.InProduction = settings.InProduction
+	app.UseCache = settings.UseCache
+	appConnectionString = settings.Database.ConnectionString()
+}
+
+// loadDefaultSettings uses the hardcoded settings, still allowing
+// BOOKINGS_* environment variables and a non-empty repository to override them
+func loadDefaultSettings(repository string) {
+	settings = config.DefaultSettings()
+
+	list := settings.ApplyEnvironment(os.LookupEnv)
+	if repository != "" {
+		settings.Repository = repository
+	}
+	list = append(list, settings.Validate()...)
+
+	if len(list) > 0 {
+		exitWithProblems("Invalid environment settings: ", list)
+	}
+}
+
+func exitWithProblems(title string, list []string) {
+	fmt.Println(title)
+	for _, x := range list {
+		fmt.Println("\t>>", x)
+	}
+	os.Exit(1)
+}
+
 // parseApplicationFlags processes items from the command line
 func parseApplicationFlags() {
 	appConfig := flag.String("config", "default", "Config Source?")
+	configFile := flag.String("configfile", "config.json", "Config file (.json, .yml or .yaml) when config is 'json'?")
+	environment := flag.String("env", "development", "Environment to read from a yaml config file?")
 	inProduction := flag.Bool("production", false, "Application is running in production?")
 	useCache := flag.Bool("cache", true, "Use template cache?")
+	repoSource := flag.String("repo", "", "Repository (postgres, memory)? Overrides the config source when set")
 
 	// configurable dbSettings
 	dbName := flag.String("dbname", "", "Database name?")                                // empty string means required
@@ -209,25 +349,50 @@ func parseApplicationFlags() {
 	app.InProduction = *inProduction
 	app.UseCache = *useCache
 
+	switch *repoSource {
+	case "", config.RepositoryPostgres, config.RepositoryMemory:
+	default:
+		exitWithProblems("Invalid flags: ", []string{"repo must be 'postgres' or 'memory'"})
+	}
+
 	switch *appConfig {
 	case "flags":
-		parseFlags(*dbName, *dbUser, *dbPassword, *dbServer, *dbPort, *dbSSL)
+		loadDefaultSettings(*repoSource)
+
+		// the database flags are only required when there is a database to connect to
+		if settings.Repository != config.RepositoryMemory {
+			parseFlags(*dbName, *dbUser, *dbPassword, *dbServer, *dbPort, *dbSSL)
+		}
 	case "json":
+		parseConfigFile(*configFile, *environment, *repoSource)
+
+		// flags given on the command line win over the file
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "production":
+				app.InProduction = *inProduction
+			case "cache":
+				app.UseCache = *useCache
+			}
+		})
 	case "default":
-		// will use json, but for this purpose we will set things by default
-		// todo: implement reading config from an input file
-		setupApplicationConfig()
+		setupApplicationConfig(*repoSource)
 	default:
 		log.Fatal("Missing configuration source. Please specify if `config` values would be 'default', 'flags', or 'json'")
 	}
 }
 
 func setupDefaultAppConfig() {
-	app.PortNumber = ":8080"
-	app.SiteSuffix = "Sample Go Web Application"
-	app.MailServer = mail.NewSMTPClient()
+	app.PortNumber = settings.PortNumber
+	app.SiteSuffix = settings.SiteSuffix
+	app.SiteURL = strings.TrimRight(settings.SiteURL, "/")
+	app.TwoFactorRole = settings.TwoFactorRole
+	app.APIRateLimit = settings.APIRateLimit
 	app.RootDirectory, _ = os.Getwd()
-	app.UseSecure = false
+	app.UseSecure = settings.UseSecure
+	app.QueryTimeout = time.Duration(settings.Database.QueryTimeout) * time.Second
+	app.Pricing = settings.Pricing
+	app.FrontDesk = settings.Mail.FrontDesk
 
 	infoLog = log.New(os.Stdout, "INFO:\t", log.Ldate|log.Ltime)
 	app.InfoLog = infoLog
@@ -236,11 +401,12 @@ func setupDefaultAppConfig() {
 	app.ErrorLog = errorLog
 }
 
-func setupApplicationConfig() {
+func setupApplicationConfig(repository string) {
 	app.InProduction = false
 	app.UseCache = false
 
-	appConnectionString = getDbConnectionString()
+	loadDefaultSettings(repository)
+	appConnectionString = settings.Database.ConnectionString()
 }
 
 func setupApplicationTemplates() {
@@ -255,11 +421,24 @@ func setupApplicationTemplates() {
 // setupDependencies bootstraps references appConfig to other packages that needs it
 func setupDependencies() {
 	helpers.AppConfig = &app
+	logging.NewHelpers(&app)
 }
 
 func setupRepo(db *driver.DB) {
-	repo := pages.NewRepo(&app, db)
+	var repo *pages.Repository
+
+	if settings.Repository == config.RepositoryMemory {
+		log.Printf(">>> Using in-memory repository, log in as %s / %s", dbrepo.MemoryAdminEmail, dbrepo.MemoryAdminPassword)
+		repo = pages.NewMemoryRepo(&app)
+	} else {
+		repo = pages.NewRepo(&app, db)
+	}
+
 	pages.NewPageHandlers(repo)
+	api.NewHandlers(api.NewRepo(&app, repo.DB))
+
+	log.Println(">>> Starting mail worker...")
+	mailer.StartWorker(repo.DB)
 }
 
 func setupSession() {
@@ -271,3 +450,17 @@ func setupSession() {
 
 	app.Session = session
 }
+
+// setupSessionStore moves sessions into the database when session_store asks for it;
+// otherwise they stay in memory and are lost on restart
+func setupSessionStore(db *driver.DB) {
+	if settings.SessionStoreKind() != config.RepositoryPostgres {
+		return
+	}
+
+	if db == nil {
+		exitWithProblems("Invalid configuration: ", []string{"session_store \"postgres\" needs the postgres repository"})
+	}
+
+	session.Store = sessionstore.NewPostgres(db.SQL, app.QueryTimeout, sessionCleanupInterval)
+}
@@ -9,8 +9,10 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/patrickoliveros/bookings/internal/config"
 	"github.com/patrickoliveros/bookings/internal/helpers"
 	"github.com/patrickoliveros/bookings/internal/renders"
+	"github.com/patrickoliveros/bookings/models"
 )
 
 var functions = template.FuncMap{
@@ -19,6 +21,11 @@ var functions = template.FuncMap{
 	"iterate":      helpers.Iterate,
 	"add":          helpers.Add,
 	"calendarDate": helpers.CalendarDate,
+	"amount":       helpers.Amount,
+	"money":        helpers.Money,
+	"statusLabel":  models.StatusLabel,
+	"roleName":     models.RoleName,
+	"device":       helpers.Device,
 }
 
 func TestRun(t *testing.T) {
@@ -33,7 +40,7 @@ func TestRun(t *testing.T) {
 func TestMain(m *testing.M) {
 
 	registerModels()
-	setupApplicationConfig()
+	setupApplicationConfig(config.RepositoryMemory)
 	setupDependencies()
 	setupSession()
 
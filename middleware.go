@@ -1,9 +1,15 @@
 package main
 
 import (
+	"database/sql"
+	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/justinas/nosurf"
+	"github.com/patrickoliveros/bookings/internal/logging"
+	"github.com/patrickoliveros/bookings/internal/pages"
+	"github.com/patrickoliveros/bookings/models"
 )
 
 // func WriteToConsole(next http.Handler) http.Handler {
@@ -24,6 +30,10 @@ func NoSurf(next http.Handler) http.Handler {
 		SameSite: http.SameSiteLaxMode,
 	})
 
+	// the versioned API is called by apps and partner sites with an API key instead of a
+	// cookie, so a forged request from a browser can't carry any credentials
+	csrfHandler.ExemptRegexp("^/api/v1/")
+
 	return csrfHandler
 }
 
@@ -31,17 +41,72 @@ func SessionLoad(next http.Handler) http.Handler {
 	return app.Session.LoadAndSave(next)
 }
 
+// Auth lets only logged in staff through. The user is loaded on every request so a
+// changed access level or a removed account takes effect straight away.
 func Auth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
-		exists := app.Session.Exists(r.Context(), "user_id")
+		id := app.Session.GetInt(r.Context(), "user_id")
 
-		if !exists {
+		if id == 0 {
 			app.Session.Put(r.Context(), "error", "Log in first!")
 			http.Redirect(w, r, "/login", http.StatusSeeOther)
 			return
 		}
 
+		user, err := pages.Repo.DB.GetUserByID(r.Context(), id)
+		current := err == nil && sessionIsCurrent(r, user)
+		if current {
+			// a session that was revoked, or started before sessions were recorded, has to log in again
+			current, err = pages.Repo.CheckUserSession(r, user)
+		}
+
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && !current) {
+			_ = app.Session.Destroy(r.Context())
+			app.Session.Put(r.Context(), "error", "Log in first!")
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		} else if err != nil {
+			logging.ServerError(w, err)
+			return
+		}
+
+		app.Session.Put(r.Context(), "access_level", user.AccessLevel)
+
+		// staff whose role needs two-factor authentication can only set it up until they have
+		if pages.Repo.TwoFactorRequired(user) && !user.HasTwoFactor() && !strings.HasPrefix(r.URL.Path, "/admin/two-factor") {
+			app.Session.Put(r.Context(), "error", "Set up two-factor authentication first!")
+			http.Redirect(w, r, "/admin/two-factor", http.StatusSeeOther)
+			return
+		}
+
 		next.ServeHTTP(w, r)
 	})
 }
+
+// sessionIsCurrent reports whether the session may still act for user: they are active,
+// have a role, and have not changed their password since the session logged in
+func sessionIsCurrent(r *http.Request, user models.User) bool {
+	if user.Role() == "" || !user.IsActive() {
+		return false
+	}
+
+	changed := user.PasswordChangedAt
+
+	return changed.IsZero() || !changed.After(app.Session.GetTime(r.Context(), "logged_in_at"))
+}
+
+// RequireRole answers with a 403 page unless the logged in user has role. It runs after Auth.
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			if !models.HasRole(app.Session.GetInt(r.Context(), "access_level"), role) {
+				pages.Repo.Forbidden(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
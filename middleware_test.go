@@ -3,7 +3,12 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
+
+	"github.com/patrickoliveros/bookings/internal/pages"
+	"github.com/patrickoliveros/bookings/models"
 )
 
 func TestNoSurf(t *testing.T) {
@@ -30,3 +35,93 @@ func TestSessionLoad(t *testing.T) {
 		t.Error(fmt.Sprintf("type is not http.Handler but is %T", v))
 	}
 }
+
+func TestAuth(t *testing.T) {
+	var tstHandler myHandler
+	h := Auth(&tstHandler)
+
+	req, _ := http.NewRequest("GET", "/admin/dashboard", nil)
+	ctx, _ := app.Session.Load(req.Context(), "")
+	req = req.WithContext(ctx)
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/login" {
+		t.Errorf("expected a redirect to /login, got %d %s", rr.Code, rr.Header().Get("Location"))
+	}
+}
+
+func TestAuth_RevokedSession(t *testing.T) {
+	pages.NewPageHandlers(pages.NewTestRepo(&app))
+	db := pages.Repo.DB
+
+	var tests = []struct {
+		name   string
+		revoke bool
+		status int
+		key    string
+	}{
+		{"active", false, http.StatusOK, "active-key"},
+		{"revoked", true, http.StatusSeeOther, "revoked-key"},
+		{"unrecorded", false, http.StatusSeeOther, ""},
+	}
+
+	for _, e := range tests {
+		var tstHandler myHandler
+		h := Auth(&tstHandler)
+
+		req, _ := http.NewRequest("GET", "/admin/dashboard", nil)
+		ctx, _ := app.Session.Load(req.Context(), "")
+		req = req.WithContext(ctx)
+
+		if e.key != "" {
+			id, _ := db.InsertUserSession(ctx, models.UserSession{UserID: 1, Key: e.key, ExpiresAt: time.Now().Add(time.Hour)})
+			if e.revoke {
+				_ = db.RevokeUserSession(ctx, 1, id)
+			}
+		}
+
+		app.Session.Put(ctx, "user_id", 1)
+		app.Session.Put(ctx, "session_key", e.key)
+
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if rr.Code != e.status {
+			t.Errorf("%s session: expected %d, got %d", e.name, e.status, rr.Code)
+		}
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	var tests = []struct {
+		accessLevel int
+		role        string
+		status      int
+	}{
+		{models.AccessFrontDesk, models.RoleFrontDesk, http.StatusOK},
+		{models.AccessFrontDesk, models.RoleManager, http.StatusForbidden},
+		{models.AccessManager, models.RoleManager, http.StatusOK},
+		{models.AccessManager, models.RoleOwner, http.StatusForbidden},
+		{models.AccessOwner, models.RoleManager, http.StatusOK},
+		{0, models.RoleFrontDesk, http.StatusForbidden},
+	}
+
+	for _, e := range tests {
+		var tstHandler myHandler
+		h := RequireRole(e.role)(&tstHandler)
+
+		req, _ := http.NewRequest("GET", "/admin/rooms", nil)
+		ctx, _ := app.Session.Load(req.Context(), "")
+		req = req.WithContext(ctx)
+		app.Session.Put(ctx, "access_level", e.accessLevel)
+
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if rr.Code != e.status {
+			t.Errorf("access level %d as %s: expected %d, got %d", e.accessLevel, e.role, e.status, rr.Code)
+		}
+	}
+}
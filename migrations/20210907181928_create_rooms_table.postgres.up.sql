@@ -0,0 +1,6 @@
+CREATE TABLE rooms (
+  id SERIAL PRIMARY KEY,
+  room_name VARCHAR (255) NOT NULL DEFAULT '',
+  created_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP NOT NULL
+);
@@ -2,4 +2,4 @@ INSERT INTO public.rooms (room_name,created_at,updated_at) VALUES
 	 ('Generals Quarters',NOW(), NOW()),
 	 ('Majors Suite', NOW(),NOW())
 
-	 ON CONFLICT ON ID DO NOTHING
\ No newline at end of file
+	 ON CONFLICT DO NOTHING
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE reservations DROP COLUMN reference;
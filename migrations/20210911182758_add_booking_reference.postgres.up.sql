@@ -0,0 +1 @@
+ALTER TABLE reservations ADD COLUMN reference VARCHAR (20) NULL;
@@ -0,0 +1,29 @@
+-- btree_gist lets the integer room_id share a gist index with the date range
+create extension if not exists btree_gist;
+
+-- the constraint cannot be added while overlapping restrictions exist, so list them
+-- and stop here; see "Database migrations" in the README for how to clean them up.
+do $$
+declare
+	overlaps text;
+begin
+	select string_agg(format('room %s: restriction %s (%s to %s) and %s (%s to %s)',
+			a.room_id, a.id, a.start_date, a.end_date, b.id, b.start_date, b.end_date), E'\n')
+	into overlaps
+	from room_restrictions a
+	join room_restrictions b on b.room_id = a.room_id and b.id > a.id
+		and daterange(a.start_date, a.end_date, '[)') && daterange(b.start_date, b.end_date, '[)');
+
+	if overlaps is not null then
+		raise exception 'room_restrictions has overlapping rows, remove or move them first:%', E'\n' || overlaps;
+	end if;
+end
+$$;
+
+-- a room can never have two restrictions covering the same night.
+-- ranges are half open, so a departure day can be the next arrival day.
+alter table room_restrictions add constraint room_restrictions_no_overlap
+	exclude using gist (
+		room_id with =,
+		daterange(start_date, end_date, '[)') with &&
+	);
@@ -0,0 +1,9 @@
+DROP INDEX rooms_slug_idx;
+
+ALTER TABLE rooms
+  DROP COLUMN slug,
+  DROP COLUMN description,
+  DROP COLUMN capacity,
+  DROP COLUMN amenities,
+  DROP COLUMN photos,
+  DROP COLUMN archived_at;
@@ -0,0 +1,28 @@
+ALTER TABLE rooms
+  ADD COLUMN slug VARCHAR (255) NULL,
+  ADD COLUMN description TEXT NOT NULL DEFAULT '',
+  ADD COLUMN capacity INTEGER NOT NULL DEFAULT 2,
+  ADD COLUMN amenities JSONB NOT NULL DEFAULT '[]',
+  ADD COLUMN photos JSONB NOT NULL DEFAULT '[]',
+  ADD COLUMN archived_at TIMESTAMP NULL;
+
+-- keep the urls the rooms were published under
+UPDATE rooms SET
+  slug = 'generals-quarters',
+  description = 'Your home away from home, set on the majestic waters of the Atlantic Ocean, this will be a vacation to remember.',
+  amenities = '["Ocean view", "Queen bed", "Free wifi"]',
+  photos = '["/static/images/rooms/generals-quarters.png"]'
+  WHERE room_name = 'Generals Quarters';
+
+UPDATE rooms SET
+  slug = 'majors-suite',
+  description = 'Your home away from home, set on the majestic waters of the Atlantic Ocean, this will be a vacation to remember.',
+  capacity = 4,
+  amenities = '["Ocean view", "King bed", "Sitting room", "Free wifi"]',
+  photos = '["/static/images/rooms/marjors-suite.png"]'
+  WHERE room_name = 'Majors Suite';
+
+UPDATE rooms SET slug = 'room-' || id WHERE slug IS NULL;
+
+ALTER TABLE rooms ALTER COLUMN slug SET NOT NULL;
+CREATE UNIQUE INDEX rooms_slug_idx ON rooms (slug);
@@ -0,0 +1,9 @@
+ALTER TABLE reservations
+  DROP COLUMN total_amount,
+  DROP COLUMN quote;
+
+DROP TABLE IF EXISTS seasonal_rates;
+
+ALTER TABLE rooms
+  DROP COLUMN weekend_rate,
+  DROP COLUMN nightly_rate;
@@ -0,0 +1,27 @@
+-- rates are stored in cents
+ALTER TABLE rooms
+  ADD COLUMN nightly_rate INTEGER NOT NULL DEFAULT 0,
+  ADD COLUMN weekend_rate INTEGER NOT NULL DEFAULT 0;
+
+UPDATE rooms SET nightly_rate = 8900, weekend_rate = 9900 WHERE slug = 'generals-quarters';
+UPDATE rooms SET nightly_rate = 12900, weekend_rate = 14900 WHERE slug = 'majors-suite';
+
+CREATE TABLE seasonal_rates (
+  id SERIAL PRIMARY KEY,
+  room_id INTEGER NOT NULL REFERENCES rooms (id) ON DELETE CASCADE,
+  name VARCHAR (255) NOT NULL,
+  start_date DATE NOT NULL,
+  end_date DATE NOT NULL,
+  nightly_rate INTEGER NOT NULL,
+  weekend_rate INTEGER NOT NULL DEFAULT 0,
+  created_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP NOT NULL,
+  CHECK (end_date >= start_date)
+);
+
+CREATE INDEX seasonal_rates_room_id_idx ON seasonal_rates (room_id);
+
+-- the quote is kept as it was when the guest booked
+ALTER TABLE reservations
+  ADD COLUMN quote JSONB NOT NULL DEFAULT '{}',
+  ADD COLUMN total_amount INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1 @@
+ALTER TABLE reservations DROP COLUMN cancellation_requested_at;
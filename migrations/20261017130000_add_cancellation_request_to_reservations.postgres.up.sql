@@ -0,0 +1 @@
+ALTER TABLE reservations ADD COLUMN cancellation_requested_at TIMESTAMP NULL;
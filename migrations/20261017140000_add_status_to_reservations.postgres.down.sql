@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS reservation_status_changes;
+
+ALTER TABLE reservations ADD COLUMN processed INTEGER NOT NULL DEFAULT 0;
+
+UPDATE reservations SET processed = 1 WHERE status <> 'pending';
+
+DROP INDEX reservations_status_idx;
+
+ALTER TABLE reservations DROP CONSTRAINT reservations_status_check;
+
+ALTER TABLE reservations DROP COLUMN status;
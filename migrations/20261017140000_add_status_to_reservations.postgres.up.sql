@@ -0,0 +1,27 @@
+ALTER TABLE reservations ADD COLUMN status VARCHAR (20) NOT NULL DEFAULT 'pending';
+
+-- processed reservations had been looked at by the desk
+UPDATE reservations SET status = 'confirmed' WHERE processed = 1;
+
+ALTER TABLE reservations ADD CONSTRAINT reservations_status_check
+  CHECK (status IN ('pending', 'confirmed', 'checked-in', 'checked-out', 'cancelled', 'no-show'));
+
+ALTER TABLE reservations DROP COLUMN processed;
+
+CREATE INDEX reservations_status_idx ON reservations (status);
+
+CREATE TABLE reservation_status_changes (
+  id SERIAL PRIMARY KEY,
+  reservation_id INTEGER NOT NULL REFERENCES reservations (id) ON DELETE CASCADE,
+  from_status VARCHAR (20) NOT NULL DEFAULT '',
+  to_status VARCHAR (20) NOT NULL,
+  note TEXT NOT NULL DEFAULT '',
+  user_id INTEGER NULL REFERENCES users (id) ON DELETE SET NULL,
+  created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX reservation_status_changes_reservation_id_idx ON reservation_status_changes (reservation_id);
+
+-- give existing reservations a starting point in their history
+INSERT INTO reservation_status_changes (reservation_id, from_status, to_status, note, created_at)
+  SELECT id, '', status, 'Status when the lifecycle was introduced', created_at FROM reservations;
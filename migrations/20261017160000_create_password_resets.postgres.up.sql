@@ -0,0 +1,13 @@
+ALTER TABLE users ADD COLUMN password_changed_at TIMESTAMP NULL;
+
+CREATE TABLE password_resets (
+  id SERIAL PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  token_hash VARCHAR (64) NOT NULL,
+  expires_at TIMESTAMP NOT NULL,
+  used_at TIMESTAMP NULL,
+  created_at TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX password_resets_token_hash_idx ON password_resets (token_hash);
+CREATE INDEX password_resets_user_id_idx ON password_resets (user_id);
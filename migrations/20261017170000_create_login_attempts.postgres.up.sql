@@ -0,0 +1,14 @@
+ALTER TABLE users ADD COLUMN failed_logins INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN locked_until TIMESTAMP NULL;
+
+CREATE TABLE login_attempts (
+  id SERIAL PRIMARY KEY,
+  email VARCHAR (255) NOT NULL,
+  user_id INTEGER NULL REFERENCES users (id) ON DELETE SET NULL,
+  ip_address VARCHAR (64) NOT NULL,
+  succeeded BOOLEAN NOT NULL,
+  created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX login_attempts_ip_address_idx ON login_attempts (ip_address, created_at);
+CREATE INDEX login_attempts_created_at_idx ON login_attempts (created_at);
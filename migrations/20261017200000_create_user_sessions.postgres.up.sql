@@ -0,0 +1,14 @@
+CREATE TABLE user_sessions (
+  id SERIAL PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  session_key VARCHAR (64) NOT NULL,
+  user_agent VARCHAR (512) NOT NULL DEFAULT '',
+  ip_address VARCHAR (64) NOT NULL DEFAULT '',
+  created_at TIMESTAMP NOT NULL,
+  last_seen_at TIMESTAMP NOT NULL,
+  expires_at TIMESTAMP NOT NULL,
+  revoked_at TIMESTAMP NULL
+);
+
+CREATE UNIQUE INDEX user_sessions_session_key_idx ON user_sessions (session_key);
+CREATE INDEX user_sessions_user_id_idx ON user_sessions (user_id, expires_at);
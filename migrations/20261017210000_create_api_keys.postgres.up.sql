@@ -0,0 +1,13 @@
+CREATE TABLE api_keys (
+  id SERIAL PRIMARY KEY,
+  name VARCHAR (255) NOT NULL,
+  prefix VARCHAR (16) NOT NULL,
+  key_hash VARCHAR (64) NOT NULL,
+  scopes JSONB NOT NULL DEFAULT '[]',
+  created_by INTEGER NOT NULL REFERENCES users (id),
+  created_at TIMESTAMP NOT NULL,
+  last_used_at TIMESTAMP NULL,
+  revoked_at TIMESTAMP NULL
+);
+
+CREATE UNIQUE INDEX api_keys_key_hash_idx ON api_keys (key_hash);
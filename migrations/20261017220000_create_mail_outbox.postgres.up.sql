@@ -0,0 +1,18 @@
+CREATE TABLE mail_outbox (
+  id SERIAL PRIMARY KEY,
+  to_address VARCHAR (255) NOT NULL,
+  from_address VARCHAR (255) NOT NULL,
+  subject VARCHAR (255) NOT NULL,
+  html_body TEXT NOT NULL,
+  text_body TEXT NOT NULL,
+  status VARCHAR (16) NOT NULL DEFAULT 'pending',
+  attempts INTEGER NOT NULL DEFAULT 0,
+  next_attempt_at TIMESTAMP NOT NULL,
+  last_error TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP NOT NULL,
+  sent_at TIMESTAMP NULL
+);
+
+CREATE INDEX mail_outbox_due_idx ON mail_outbox (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX mail_outbox_status_idx ON mail_outbox (status, created_at);
@@ -0,0 +1,5 @@
+ALTER TABLE mail_outbox
+  DROP COLUMN attachments;
+
+ALTER TABLE reservations
+  DROP COLUMN sequence;
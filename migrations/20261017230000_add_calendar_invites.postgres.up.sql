@@ -0,0 +1,7 @@
+-- counts the changes to a reservation, so calendar clients replace older invites
+ALTER TABLE reservations
+  ADD COLUMN sequence INTEGER NOT NULL DEFAULT 0;
+
+-- files sent with the email, such as calendar invites
+ALTER TABLE mail_outbox
+  ADD COLUMN attachments JSONB NOT NULL DEFAULT '[]';
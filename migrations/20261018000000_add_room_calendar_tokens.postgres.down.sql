@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS rooms_calendar_token_idx;
+
+ALTER TABLE rooms
+  DROP COLUMN calendar_token;
@@ -0,0 +1,5 @@
+-- the secret in the address of a room's calendar feed, null when the room has none
+ALTER TABLE rooms
+  ADD COLUMN calendar_token VARCHAR (64) NULL;
+
+CREATE UNIQUE INDEX rooms_calendar_token_idx ON rooms (calendar_token);
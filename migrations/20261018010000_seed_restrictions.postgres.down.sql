@@ -0,0 +1,3 @@
+DELETE FROM restrictions r
+	WHERE r.id IN (1, 2)
+	AND NOT EXISTS (SELECT 1 FROM room_restrictions rr WHERE rr.restriction_id = r.id);
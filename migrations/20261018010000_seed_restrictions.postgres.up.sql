@@ -0,0 +1,11 @@
+-- the application refers to these by id: 1 is a reservation, 2 an owner block.
+-- the original seed was left commented out, so add them here without touching
+-- databases where they were inserted by hand.
+INSERT INTO public.restrictions (id, restriction_name, created_at, updated_at) VALUES
+	 (1, 'Reservation', NOW(), NOW()),
+	 (2, 'Owners Block', NOW(), NOW())
+
+	 ON CONFLICT (id) DO NOTHING;
+
+-- inserting explicit ids does not move the sequence, so the next restriction would collide
+SELECT setval('restrictions_id_seq', (SELECT MAX(id) FROM restrictions));
@@ -0,0 +1,10 @@
+// Package migrations embeds the sql migrations so the binary can apply them itself.
+// The files keep soda's naming, so the directory still works with soda as well.
+package migrations
+
+import "embed"
+
+// Files holds every sql migration in this directory
+//
+//go:embed *.sql
+var Files embed.FS
@@ -1,7 +1,86 @@
 package models
 
+import "time"
+
 type Article struct {
 	Title   string `json:"Title"`
 	Desc    string `json:"desc"`
 	Content string `json:"content"`
 }
+
+// APIResponse is the envelope of every successful API response. Meta is only set on lists.
+type APIResponse struct {
+	Data interface{} `json:"data"`
+	Meta *APIPage    `json:"meta,omitempty"`
+}
+
+// APIPage describes which part of a list a response holds
+type APIPage struct {
+	Page    int `json:"page"`
+	PerPage int `json:"per_page"`
+	Total   int `json:"total"`
+}
+
+// APIErrorResponse is the envelope of every failed API response
+type APIErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// APIError says what went wrong. Fields holds the messages of invalid input, by field.
+type APIError struct {
+	Code    string              `json:"code"`
+	Message string              `json:"message"`
+	Fields  map[string][]string `json:"fields,omitempty"`
+}
+
+// APIRoom is a room as the API shows it. Rates are in cents.
+type APIRoom struct {
+	ID          int      `json:"id"`
+	Name        string   `json:"name"`
+	Slug        string   `json:"slug"`
+	Description string   `json:"description"`
+	Capacity    int      `json:"capacity"`
+	NightlyRate int      `json:"nightly_rate"`
+	WeekendRate int      `json:"weekend_rate"`
+	Amenities   []string `json:"amenities"`
+	Photos      []string `json:"photos"`
+}
+
+// APIAvailableRoom is a room that is free for the searched dates, with the price of the stay
+type APIAvailableRoom struct {
+	APIRoom
+	Quote Quote `json:"quote"`
+}
+
+// APIReservation is a reservation as the API shows it
+type APIReservation struct {
+	Reference             string    `json:"reference"`
+	Status                string    `json:"status"`
+	FirstName             string    `json:"first_name"`
+	LastName              string    `json:"last_name"`
+	Email                 string    `json:"email"`
+	Phone                 string    `json:"phone"`
+	RoomID                int       `json:"room_id"`
+	RoomName              string    `json:"room_name"`
+	StartDate             string    `json:"start_date"`
+	EndDate               string    `json:"end_date"`
+	CancellationRequested bool      `json:"cancellation_requested"`
+	Quote                 Quote     `json:"quote"`
+	CreatedAt             time.Time `json:"created_at"`
+}
+
+// APIReservationRequest is the body of a request to book a room
+type APIReservationRequest struct {
+	RoomID    int    `json:"room_id"`
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+	Phone     string `json:"phone"`
+}
+
+// APICancellationRequest is the body of a guest's request to cancel a booking
+type APICancellationRequest struct {
+	Email string `json:"email"`
+}
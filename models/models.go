@@ -7,22 +7,133 @@ import (
 
 // User is the user model
 type User struct {
+	ID            int
+	FirstName     string
+	LastName      string
+	Email         string
+	Password      string
+	AccessLevel   int
+	DeactivatedAt time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+
+	// PasswordChangedAt ends every session that logged in before it
+	PasswordChangedAt time.Time
+
+	// FailedLogins counts failures since the last successful login; while
+	// LockedUntil is in the future the account cannot log in
+	FailedLogins int
+	LockedUntil  time.Time
+
+	// TOTPSecret is set once two-factor authentication is enabled; TOTPLastStep is
+	// the last code period used, so a code cannot be used twice
+	TOTPSecret    string
+	TOTPEnabledAt time.Time
+	TOTPLastStep  int64
+}
+
+// IsActive reports whether the user may still log in
+func (u User) IsActive() bool {
+	return u.DeactivatedAt.IsZero()
+}
+
+// IsLocked reports whether failed logins have locked the account at now
+func (u User) IsLocked(now time.Time) bool {
+	return now.Before(u.LockedUntil)
+}
+
+// HasTwoFactor reports whether the user logs in with a one-time code as well as their password
+func (u User) HasTwoFactor() bool {
+	return u.TOTPSecret != ""
+}
+
+// LoginAttempt is a row of the login audit log. UserID is 0 when the email is unknown.
+type LoginAttempt struct {
+	ID        int
+	Email     string
+	UserID    int
+	IPAddress string
+	Succeeded bool
+	CreatedAt time.Time
+}
+
+// UserSession is a staff login, kept so users and owners can see where an account
+// is logged in and end those sessions. Key is stored in the scs session.
+type UserSession struct {
+	ID         int
+	UserID     int
+	Key        string
+	UserAgent  string
+	IPAddress  string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+	RevokedAt  time.Time
+}
+
+// IsActive reports whether the session can still be used at now
+func (s UserSession) IsActive(now time.Time) bool {
+	return s.RevokedAt.IsZero() && now.Before(s.ExpiresAt)
+}
+
+// APIKey lets a program use the API with the scopes it was given. Only a hash of the
+// key is stored, with its first characters in Prefix so staff can tell keys apart.
+type APIKey struct {
+	ID            int
+	Name          string
+	Prefix        string
+	KeyHash       string
+	Scopes        []string
+	CreatedBy     int
+	CreatedByName string
+	CreatedAt     time.Time
+	LastUsedAt    time.Time
+	RevokedAt     time.Time
+}
+
+// IsActive reports whether the key can still be used
+func (k APIKey) IsActive() bool {
+	return k.RevokedAt.IsZero()
+}
+
+// PasswordReset is a single-use password reset link. Only a hash of its token is stored.
+type PasswordReset struct {
+	ID        int
+	UserID    int
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    time.Time
+	CreatedAt time.Time
+}
+
+// IsUsable reports whether the link can still reset a password at now
+func (p PasswordReset) IsUsable(now time.Time) bool {
+	return p.UsedAt.IsZero() && now.Before(p.ExpiresAt)
+}
+
+// Room is the room model
+type Room struct {
 	ID          int
-	FirstName   string
-	LastName    string
-	Email       string
-	Password    string
-	AccessLevel int
+	RoomName    string
+	Slug        string
+	Description string
+	Capacity    int
+	NightlyRate int
+	WeekendRate int
+	Amenities   []string
+	Photos      []string
+	ArchivedAt  time.Time
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
+
+	// CalendarToken is the secret in the address of the room's calendar feed,
+	// empty when the room has no feed
+	CalendarToken string
 }
 
-// Room is the room model
-type Room struct {
-	ID        int
-	RoomName  string
-	CreatedAt time.Time
-	UpdatedAt time.Time
+// IsArchived reports whether the room has been taken out of the catalogue
+func (r Room) IsArchived() bool {
+	return !r.ArchivedAt.IsZero()
 }
 
 // Restriction is the restriction model
@@ -46,9 +157,58 @@ type Reservation struct {
 	CreatedAt        time.Time
 	UpdatedAt        time.Time
 	Room             Room
-	Processed        int
+	Status           string
 	ReadableRoomName string
 	Reference        string
+	Quote            Quote
+
+	// CancellationRequestedAt is when the guest asked to cancel, zero if they haven't
+	CancellationRequestedAt time.Time
+
+	// Sequence counts the changes to the reservation's guest, dates or status. Calendar
+	// invites carry it so that clients replace the event they already have.
+	Sequence int
+}
+
+// SeasonalRate overrides a room's rates for the nights from StartDate to EndDate, both included
+type SeasonalRate struct {
+	ID          int
+	RoomID      int
+	Name        string
+	StartDate   time.Time
+	EndDate     time.Time
+	NightlyRate int
+	WeekendRate int
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// Quote is the itemised price of a stay. Amounts are in cents.
+type Quote struct {
+	Currency string        `json:"currency"`
+	Nights   []NightCharge `json:"nights"`
+	Fees     []Charge      `json:"fees"`
+	Taxes    []Charge      `json:"taxes"`
+	Subtotal int           `json:"subtotal"`
+	Total    int           `json:"total"`
+}
+
+// NightCharge is the price of one night and the rate it was charged at
+type NightCharge struct {
+	Date   time.Time `json:"date"`
+	Rate   string    `json:"rate"`
+	Amount int       `json:"amount"`
+}
+
+// Charge is a named fee or tax
+type Charge struct {
+	Name   string `json:"name"`
+	Amount int    `json:"amount"`
+}
+
+// IsEmpty reports whether no price was worked out, as for reservations made before pricing
+func (q Quote) IsEmpty() bool {
+	return len(q.Nights) == 0
 }
 
 // RoomRestriction is the room restriction model
@@ -73,5 +233,10 @@ type MailData struct {
 	Subject     string
 	ContentHtml template.HTML
 	Content     string
-	Template    string
+
+	// Template names the email template the message is made from, the default one shows Content
+	Template string
+	Data     map[string]interface{}
+
+	Attachments []Attachment
 }
@@ -0,0 +1,66 @@
+package models
+
+import "time"
+
+// Outbox message statuses
+const (
+	OutboxPending   = "pending"
+	OutboxSent      = "sent"
+	OutboxDead      = "dead"
+	OutboxDiscarded = "discarded"
+)
+
+// OutboxStatuses lists every status of an outbox message
+var OutboxStatuses = []string{
+	OutboxPending,
+	OutboxSent,
+	OutboxDead,
+	OutboxDiscarded,
+}
+
+// IsOutboxStatus reports whether status is one of OutboxStatuses
+func IsOutboxStatus(status string) bool {
+	for _, s := range OutboxStatuses {
+		if s == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// OutboxMessage is a rendered email in the mail outbox. Pending messages are sent once
+// NextAttemptAt has passed; dead ones failed for good and wait for staff to retry or discard them.
+type OutboxMessage struct {
+	ID            int
+	To            string
+	From          string
+	Subject       string
+	HTMLBody      string
+	TextBody      string
+	Status        string
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	SentAt        time.Time
+	Attachments   []Attachment
+}
+
+// Attachment is a file sent with an email
+type Attachment struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Data        []byte `json:"data"`
+}
+
+// IsStuck reports whether the message failed and still waits to be delivered or dealt with
+func (m OutboxMessage) IsStuck() bool {
+	return m.Status == OutboxDead || (m.Status == OutboxPending && m.Attempts > 0)
+}
+
+// CanRetry reports whether staff may send the message again or discard it
+func (m OutboxMessage) CanRetry() bool {
+	return m.Status == OutboxPending || m.Status == OutboxDead
+}
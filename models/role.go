@@ -0,0 +1,64 @@
+package models
+
+// Access levels stored in users.access_level. Each role may do everything the roles
+// below it can.
+const (
+	AccessFrontDesk = 1
+	AccessManager   = 2
+	AccessOwner     = 3
+)
+
+// Role names used by routes and templates
+const (
+	RoleFrontDesk = "front-desk"
+	RoleManager   = "manager"
+	RoleOwner     = "owner"
+)
+
+var roleAccessLevels = map[string]int{
+	RoleFrontDesk: AccessFrontDesk,
+	RoleManager:   AccessManager,
+	RoleOwner:     AccessOwner,
+}
+
+// RoleName returns the role of an access level, or "" if it has none
+func RoleName(accessLevel int) string {
+	switch {
+	case accessLevel >= AccessOwner:
+		return RoleOwner
+	case accessLevel == AccessManager:
+		return RoleManager
+	case accessLevel == AccessFrontDesk:
+		return RoleFrontDesk
+	}
+
+	return ""
+}
+
+// IsRole reports whether name is one of the roles
+func IsRole(name string) bool {
+	_, ok := roleAccessLevels[name]
+	return ok
+}
+
+// HasRole reports whether an access level is enough for a role. Unknown roles are never granted.
+func HasRole(accessLevel int, role string) bool {
+	required, ok := roleAccessLevels[role]
+	return ok && accessLevel >= required
+}
+
+// Role returns the name of the user's role
+func (u User) Role() string {
+	return RoleName(u.AccessLevel)
+}
+
+// HasRole reports whether the user may act as role
+func (u User) HasRole(role string) bool {
+	return HasRole(u.AccessLevel, role)
+}
+
+// HasRole reports whether the logged in user may act as role, so templates can
+// hide actions with {{if .HasRole "manager"}}
+func (td *TemplateData) HasRole(role string) bool {
+	return HasRole(td.AccessLevel, role)
+}
@@ -0,0 +1,33 @@
+package models
+
+// Scopes an API key can be given. A key may only use the endpoints its scopes allow.
+const (
+	ScopeReadAvailability  = "read-availability"
+	ScopeReadReservations  = "read-reservations"
+	ScopeWriteReservations = "write-reservations"
+)
+
+// APIScopes lists every scope, in the order admin screens show them
+var APIScopes = []string{ScopeReadAvailability, ScopeReadReservations, ScopeWriteReservations}
+
+// IsScope reports whether name is one of the scopes
+func IsScope(name string) bool {
+	for _, s := range APIScopes {
+		if s == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasScope reports whether the key was given scope
+func (k APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
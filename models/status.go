@@ -0,0 +1,83 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Reservation statuses
+const (
+	StatusPending    = "pending"
+	StatusConfirmed  = "confirmed"
+	StatusCheckedIn  = "checked-in"
+	StatusCheckedOut = "checked-out"
+	StatusCancelled  = "cancelled"
+	StatusNoShow     = "no-show"
+)
+
+// ReservationStatuses lists every status in the order a stay goes through them
+var ReservationStatuses = []string{
+	StatusPending,
+	StatusConfirmed,
+	StatusCheckedIn,
+	StatusCheckedOut,
+	StatusCancelled,
+	StatusNoShow,
+}
+
+// statusTransitions maps each status to the ones it can move to.
+// Checked-out, cancelled and no-show are final.
+var statusTransitions = map[string][]string{
+	StatusPending:   {StatusConfirmed, StatusCancelled},
+	StatusConfirmed: {StatusCheckedIn, StatusCancelled, StatusNoShow},
+	StatusCheckedIn: {StatusCheckedOut},
+}
+
+// ReservationStatusChange is one row of a reservation's status history. From is
+// empty for the row written when the reservation is created.
+type ReservationStatusChange struct {
+	ID            int
+	ReservationID int
+	FromStatus    string
+	ToStatus      string
+	Note          string
+	UserID        int
+	CreatedAt     time.Time
+}
+
+// IsReservationStatus reports whether status is one of ReservationStatuses
+func IsReservationStatus(status string) bool {
+	for _, s := range ReservationStatuses {
+		if s == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CanTransition reports whether a reservation may move from one status to another
+func CanTransition(from, to string) bool {
+	for _, s := range statusTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NextStatuses returns the statuses the reservation can move to
+func (r Reservation) NextStatuses() []string {
+	return statusTransitions[r.Status]
+}
+
+// IsActive reports whether the reservation still holds its room
+func (r Reservation) IsActive() bool {
+	return r.Status == StatusPending || r.Status == StatusConfirmed || r.Status == StatusCheckedIn
+}
+
+// StatusLabel turns a status like "checked-in" into "Checked In"
+func StatusLabel(status string) string {
+	return strings.Title(strings.Replace(status, "-", " ", -1))
+}
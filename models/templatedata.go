@@ -16,5 +16,6 @@ type TemplateData struct {
 	Form            *forms.Form
 	IsAuthenticated bool
 	UserDisplayName string
+	AccessLevel     int
 	SiteSuffix      string
 }
@@ -6,8 +6,9 @@ import (
 	"github.com/patrickoliveros/bookings/api"
 	"github.com/patrickoliveros/bookings/internal/config"
 	"github.com/patrickoliveros/bookings/internal/pages"
+	"github.com/patrickoliveros/bookings/models"
 
-	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 )
 
@@ -42,13 +43,20 @@ func getRequests(mux *chi.Mux) {
 	mux.Get("/reservation-summary", pages.Repo.SummaryMakeReservationPage)
 	mux.Get("/contact", pages.Repo.ContactPage)
 
-	mux.Get("/rooms/generals-quarters", pages.Repo.RoomsGeneral)
-	mux.Get("/rooms/majors-suite", pages.Repo.RoomsMajor)
+	mux.Get("/rooms", pages.Repo.RoomsPage)
+	mux.Get("/rooms/{slug}", pages.Repo.RoomPage)
+	mux.Get("/calendars/{token}.ics", pages.Repo.RoomCalendarFeed)
 	mux.Get("/choose-room/{id}", pages.Repo.ChooseRoom)
 	mux.Get("/book-room", pages.Repo.BookRoom)
 
+	mux.Get("/manage-booking", pages.Repo.ManageBookingPage)
+	mux.Get("/manage-booking/booking", pages.Repo.ManagedBookingPage)
+
 	mux.Get("/login", pages.Repo.LoginPage)
 	mux.Get("/logout", pages.Repo.LogoutPage)
+	mux.Get("/forgot-password", pages.Repo.ForgotPasswordPage)
+	mux.Get("/reset-password/{token}", pages.Repo.ResetPasswordPage)
+	mux.Get("/login/two-factor", pages.Repo.TwoFactorLoginPage)
 
 	mux.Get("/favicon.ico", pages.Repo.Favicon)
 }
@@ -58,12 +66,21 @@ func postRequests(mux *chi.Mux) {
 	mux.Post("/make-reservation", pages.Repo.PostMakeReservationPage)
 	mux.Post("/availability", pages.Repo.AvailabilityReservationsPage)
 
+	mux.Post("/manage-booking", pages.Repo.PostManageBookingPage)
+	mux.Post("/manage-booking/contact", pages.Repo.PostManageContact)
+	mux.Post("/manage-booking/dates", pages.Repo.PostManageDates)
+	mux.Post("/manage-booking/cancel", pages.Repo.PostManageCancel)
+
 	mux.Post("/login", pages.Repo.PostLoginPage)
+	mux.Post("/forgot-password", pages.Repo.PostForgotPasswordPage)
+	mux.Post("/reset-password/{token}", pages.Repo.PostResetPasswordPage)
+	mux.Post("/login/two-factor", pages.Repo.PostTwoFactorLoginPage)
 }
 
 func setSecurePages(mux *chi.Mux) {
 	mux.Route("/admin", func(mux chi.Router) {
-		// mux.Use(helpers.Auth)
+		mux.Use(Auth)
+		mux.Use(RequireRole(models.RoleFrontDesk))
 
 		adminGetPages(mux)
 		adminPostPages(mux)
@@ -72,29 +89,91 @@ func setSecurePages(mux *chi.Mux) {
 
 func setAPIEndpoints(mux *chi.Mux) {
 	mux.Route("/api", func(mux chi.Router) {
-		// mux.Use(helpers.Auth)
-
-		// adminGetPages(mux)
-		// adminPostPages(mux)
 		mux.Get("/articles", api.GetArticles)
+		mux.Get("/openapi.json", api.OpenAPI)
+		mux.Get("/docs", api.Docs)
+
+		mux.Route("/v1", apiV1Endpoints)
 	})
 }
 
+// apiV1Endpoints answer in JSON, errors included, and keep no session. Every route
+// needs an API key with the scope it declares.
+func apiV1Endpoints(mux chi.Router) {
+	mux.Use(api.Repo.Authenticate)
+	mux.NotFound(api.NotFound)
+	mux.MethodNotAllowed(api.MethodNotAllowed)
+
+	availability := mux.With(api.RequireScope(models.ScopeReadAvailability))
+	availability.Get("/rooms", api.Repo.GetRooms)
+	availability.Get("/rooms/{id}", api.Repo.GetRoom)
+	availability.Get("/availability", api.Repo.GetAvailability)
+
+	mux.With(api.RequireScope(models.ScopeReadReservations)).Get("/reservations/{reference}", api.Repo.GetReservation)
+
+	reservations := mux.With(api.RequireScope(models.ScopeWriteReservations))
+	reservations.Post("/reservations", api.Repo.PostReservation)
+	reservations.Post("/reservations/{reference}/cancel", api.Repo.PostCancelReservation)
+}
+
+// adminGetPages are open to every role; routes needing more declare it with RequireRole
 func adminGetPages(mux chi.Router) {
 	mux.Get("/dashboard", pages.Repo.AdminDashBoard)
 	mux.Get("/reservations-new", pages.Repo.AdminReservationsNew)
 	mux.Get("/reservations-all", pages.Repo.AdminReservationsAll)
 	mux.Get("/reservations-calendar", pages.Repo.AdminReservationsCalendar)
 	mux.Get("/reservation/{id}", pages.Repo.AdminReservationsById)
-	mux.Get("/process-reservation/{id}", pages.Repo.AdminProcessReservation)
+	mux.Get("/two-factor", pages.Repo.AdminTwoFactor)
+	mux.Get("/sessions", pages.Repo.AdminSessions)
+
+	manager := mux.With(RequireRole(models.RoleManager))
+	manager.Get("/rooms", pages.Repo.AdminRoomsAll)
+	manager.Get("/rooms/new", pages.Repo.AdminRoomsNew)
+	manager.Get("/rooms/{id}", pages.Repo.AdminRoomsById)
+
+	owner := mux.With(RequireRole(models.RoleOwner))
+	owner.Get("/users", pages.Repo.AdminUsersAll)
+	owner.Get("/users/new", pages.Repo.AdminUsersNew)
+	owner.Get("/users/{id}", pages.Repo.AdminUserById)
+	owner.Get("/login-attempts", pages.Repo.AdminLoginAttempts)
+	owner.Get("/api-keys", pages.Repo.AdminAPIKeys)
+	owner.Get("/mail-outbox", pages.Repo.AdminMailOutbox)
 }
 
 func adminPostPages(mux chi.Router) {
 	mux.Post("/dashboard", pages.Repo.AdminDashBoard)
 	mux.Post("/reservations-new", pages.Repo.AdminReservationsNew)
 	mux.Post("/reservations-all", pages.Repo.AdminReservationsAll)
-	mux.Post("/reservations-calendar", pages.Repo.AdminPostReservationsCalendar)
 	mux.Post("/reservation/{id}", pages.Repo.AdminPostReservationsById)
+	mux.Post("/reservation/{id}/status", pages.Repo.AdminPostReservationStatus)
+	mux.Post("/two-factor", pages.Repo.AdminPostTwoFactor)
+	mux.Post("/two-factor/recovery-codes", pages.Repo.AdminPostRecoveryCodes)
+	mux.Post("/two-factor/disable", pages.Repo.AdminPostDisableTwoFactor)
+	mux.Post("/sessions/revoke-others", pages.Repo.AdminPostRevokeOtherSessions)
+	mux.Post("/sessions/{sessionID}/revoke", pages.Repo.AdminPostRevokeSession)
+
+	manager := mux.With(RequireRole(models.RoleManager))
+	manager.Post("/reservations-calendar", pages.Repo.AdminPostReservationsCalendar)
+	manager.Post("/rooms/new", pages.Repo.AdminPostRoomsNew)
+	manager.Post("/rooms/{id}", pages.Repo.AdminPostRoomsById)
+	manager.Post("/rooms/{id}/rates", pages.Repo.AdminPostSeasonalRate)
+	manager.Post("/rooms/{id}/rates/{rateID}/delete", pages.Repo.AdminPostDeleteSeasonalRate)
+
+	owner := mux.With(RequireRole(models.RoleOwner))
+	owner.Post("/rooms/{id}/archive", pages.Repo.AdminPostArchiveRoom)
+	owner.Post("/rooms/{id}/calendar-feed", pages.Repo.AdminPostRoomCalendarFeed)
+	owner.Post("/users/new", pages.Repo.AdminPostUsersNew)
+	owner.Post("/users/{id}", pages.Repo.AdminPostUserById)
+	owner.Post("/users/{id}/deactivate", pages.Repo.AdminPostDeactivateUser)
+	owner.Post("/users/{id}/reset-password", pages.Repo.AdminPostResetUserPassword)
+	owner.Post("/users/{id}/unlock", pages.Repo.AdminPostUnlockUser)
+	owner.Post("/users/{id}/reset-two-factor", pages.Repo.AdminPostResetTwoFactor)
+	owner.Post("/users/{id}/sessions/revoke", pages.Repo.AdminPostRevokeUserSessions)
+	owner.Post("/users/{id}/sessions/{sessionID}/revoke", pages.Repo.AdminPostRevokeUserSession)
+	owner.Post("/api-keys", pages.Repo.AdminPostAPIKeys)
+	owner.Post("/api-keys/{id}/revoke", pages.Repo.AdminPostRevokeAPIKey)
+	owner.Post("/mail-outbox/{id}/retry", pages.Repo.AdminPostRetryMail)
+	owner.Post("/mail-outbox/{id}/discard", pages.Repo.AdminPostDiscardMail)
 }
 
 func enableStaticFiles(mux *chi.Mux) {
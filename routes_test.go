@@ -2,9 +2,12 @@ package main
 
 import (
 	"fmt"
+	"net/http"
+	"strings"
 	"testing"
 
-	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/v5"
+	"github.com/patrickoliveros/bookings/api"
 	"github.com/patrickoliveros/bookings/internal/config"
 )
 
@@ -20,3 +23,32 @@ func TestRoutes(t *testing.T) {
 		t.Error(fmt.Sprintf("type is not *chi.Mux, but is %T", v))
 	}
 }
+
+func TestAPIEndpointsHaveSpec(t *testing.T) {
+	mux := chi.NewRouter()
+	setAPIEndpoints(mux)
+
+	spec := api.Spec()
+	routed := map[string]bool{}
+
+	err := chi.Walk(mux, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		method = strings.ToLower(method)
+		routed[method+" "+route] = true
+
+		if spec.Paths[route][method] == nil {
+			t.Errorf("%s %s is routed but missing from api.Spec", strings.ToUpper(method), route)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, item := range spec.Paths {
+		for method := range item {
+			if !routed[method+" "+path] {
+				t.Errorf("%s %s is in api.Spec but not routed", strings.ToUpper(method), path)
+			}
+		}
+	}
+}